@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log"
+	"net"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -12,6 +13,7 @@ import (
 	"github.com/madhiyono/base-api-nosql/internal/email"
 	"github.com/madhiyono/base-api-nosql/internal/handlers"
 	"github.com/madhiyono/base-api-nosql/internal/middleware"
+	"github.com/madhiyono/base-api-nosql/internal/models"
 	mongorepo "github.com/madhiyono/base-api-nosql/internal/repository/mongo"
 	"github.com/madhiyono/base-api-nosql/internal/routes"
 	"github.com/madhiyono/base-api-nosql/internal/services"
@@ -70,12 +72,23 @@ func main() {
 	authRepo := mongorepo.NewAuthRepository(db)
 	roleRepo := mongorepo.NewRoleRepository(db)
 	verifyRepo := mongorepo.NewVerificationRepository(db)
+	refreshRepo := mongorepo.NewRefreshTokenRepository(db)
+	resetRepo := mongorepo.NewPasswordResetRepository(db)
+	loginRepo := mongorepo.NewLoginHistoryRepository(db)
+	identityRepo := mongorepo.NewIdentityRepository(db)
+	apiKeyRepo := mongorepo.NewAPIKeyRepository(db)
+	sessionRepo := mongorepo.NewSessionRepository(db)
+	magicLinkRepo := mongorepo.NewMagicLinkRepository(db)
+	auditRepo := mongorepo.NewAuditLogRepository(db)
+	orgRepo := mongorepo.NewOrganizationRepository(db)
+	membershipRepo := mongorepo.NewMembershipRepository(db)
+	grantRepo := mongorepo.NewRoleGrantRepository(db)
 
 	// Initialize WebSocket service
 	wsService := services.NewWebSocketService(logger)
 
 	// Initialize email service
-	emailService := email.NewEmailService(verifyRepo, redisCache, logger, email.EmailConfig{
+	emailService := email.NewEmailService(verifyRepo, resetRepo, magicLinkRepo, redisCache, logger, email.EmailConfig{
 		SMTPHost:     cfg.Email.SMTPHost,
 		SMTPPort:     cfg.Email.SMTPPort,
 		SMTPUser:     cfg.Email.SMTPUser,
@@ -84,27 +97,139 @@ func main() {
 		FromName:     cfg.Email.FromName,
 		TemplatesDir: cfg.Email.TemplatesDir,
 		WorkerCount:  cfg.WorkerCount,
+
+		ResetPasswordURL: cfg.Email.ResetPasswordURL,
+		MagicLinkURL:     cfg.Email.MagicLinkURL,
 	})
 
+	// Create Indexes
+	if err := userRepo.EnsureIndexes(); err != nil {
+		logger.Fatal("Failed to Create User Indexes: %v", err)
+	}
+	if err := roleRepo.EnsureIndexes(); err != nil {
+		logger.Fatal("Failed to Create Role Indexes: %v", err)
+	}
+
+	// Protect Built-in Roles
+	if err := roleRepo.MarkSystem(models.SystemRoleNames); err != nil {
+		logger.Fatal("Failed to Mark System Roles: %v", err)
+	}
+
+	// Load JWT Signing Keys
+	jwtKeys := make([]auth.JWTKeyConfig, 0, len(cfg.JWT.Keys))
+	for _, key := range cfg.JWT.Keys {
+		jwtKeys = append(jwtKeys, auth.JWTKeyConfig(key))
+	}
+	keySet, err := auth.LoadKeySet(jwtKeys, cfg.JWT.SigningKeyID, cfg.JWTSecret, cfg.JWT.AcceptHS256)
+	if err != nil {
+		logger.Fatal("Failed to Load JWT Keys: %v", err)
+	}
+
+	// TOTP secrets are encrypted with their own key, never the JWT secret
+	if cfg.MFA.EncryptionKey == "" {
+		logger.Fatal("MFA Encryption Key Is Not Set (mfa.encryption_key or MFA_ENCRYPTION_KEY)")
+	}
+	if cfg.MFA.EncryptionKey == cfg.JWTSecret {
+		logger.Fatal("MFA Encryption Key Must Differ From the JWT Secret")
+	}
+
+	// Check Password Hashing Settings
+	if err := auth.PasswordHashingConfig(cfg.PasswordHashing).Validate(); err != nil {
+		logger.Fatal("Invalid Password Hashing Settings: %v", err)
+	}
+
+	// Load Password Policy
+	passwordPolicy, err := auth.NewPasswordPolicy(auth.PasswordPolicyConfig(cfg.PasswordPolicy))
+	if err != nil {
+		logger.Fatal("Failed to Load Password Policy: %v", err)
+	}
+
 	// Initialize Auth Service & Middleware
-	authService := auth.NewAuthService(authRepo, userRepo, roleRepo, cfg.JWTSecret)
+	authService := auth.NewAuthService(auth.Repositories{
+		Auth:          authRepo,
+		Users:         userRepo,
+		Roles:         roleRepo,
+		RefreshTokens: refreshRepo,
+		LoginHistory:  loginRepo,
+		Identities:    identityRepo,
+		APIKeys:       apiKeyRepo,
+		Sessions:      sessionRepo,
+		AuditLogs:     auditRepo,
+		Organizations: orgRepo,
+		Memberships:   membershipRepo,
+		RoleGrants:    grantRepo,
+	}, redisCache, auth.AuthConfig{
+		JWTSecret:       cfg.JWTSecret,
+		AccessTokenTTL:  cfg.AccessTokenTTL,
+		RefreshTokenTTL: cfg.RefreshTokenTTL,
+		Keys:            keySet,
+
+		MFAIssuer:        cfg.MFA.Issuer,
+		MFAEncryptionKey: cfg.MFA.EncryptionKey,
+
+		LoginProtection: auth.LoginProtectionConfig(cfg.LoginProtection),
+		PasswordHashing: auth.PasswordHashingConfig(cfg.PasswordHashing),
+		PasswordPolicy:  passwordPolicy,
+		Logger:          logger,
+	})
 	authMiddleware := auth.NewMiddleware(authService)
 
+	// Clear cached role permissions when another instance changes a role
+	go authService.ListenForRoleChanges(context.Background())
+
+	// Expire role grants and tell their users
+	go authService.SweepRoleGrants(context.Background(), time.Minute, func(grant *models.RoleGrant) {
+		wsService.BroadcastToUser(grant.UserID, models.WebSocketMessage{
+			Type:  "notification",
+			Event: "role_grant_expired",
+			Data: map[string]any{
+				"grant_id": grant.ID.Hex(),
+				"role_id":  grant.RoleID.Hex(),
+			},
+			Timestamp: time.Now(),
+		})
+	})
+
+	// Initialize OAuth Service
+	oauthProviders := make(map[string]auth.OAuthProviderConfig)
+	for name, provider := range cfg.OAuthProviders {
+		oauthProviders[name] = auth.OAuthProviderConfig(provider)
+	}
+	oauthService := auth.NewOAuthService(oauthProviders, redisCache, cfg.JWTSecret)
+
 	// Initialize Handlers
 	userHandler := handlers.NewUserHandler(userRepo, authService, storageService, redisCache, logger)
-	authHandler := handlers.NewAuthHandler(authRepo, verifyRepo, authService, emailService, logger)
+	authHandler := handlers.NewAuthHandler(userRepo, roleRepo, authRepo, verifyRepo, authService, oauthService, emailService, wsService, redisCache, logger)
+	accountHandler := handlers.NewAccountHandler(userRepo, authRepo, authService, emailService, wsService, redisCache, logger)
 	roleHandler := handlers.NewRoleHandler(roleRepo, authService, logger)
+	organizationHandler := handlers.NewOrganizationHandler(authService, redisCache, logger)
 	emailHandler := handlers.NewEmailHandler(emailService, logger)
 	wsHandler := handlers.NewWebSocketHandler(wsService, logger)
 
 	// Initialize Echo Instance
 	e := echo.New()
 
+	// Client IPs key rate limits and lockouts, so X-Forwarded-For is only
+	// read when the request comes from a configured proxy
+	if len(cfg.TrustedProxies) == 0 {
+		e.IPExtractor = echo.ExtractIPDirect()
+	} else {
+		trustOptions := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+		for _, proxy := range cfg.TrustedProxies {
+			_, network, err := net.ParseCIDR(proxy)
+			if err != nil {
+				logger.Fatal("Invalid Trusted Proxy %q: %v", proxy, err)
+			}
+			trustOptions = append(trustOptions, echo.TrustIPRange(network))
+		}
+		e.IPExtractor = echo.ExtractIPFromXFFHeader(trustOptions...)
+	}
+
 	// Initialize Middleware
 	middleware.Init(e, logger)
 
 	// Setup Routes
-	routes.Setup(e, userHandler, authHandler, roleHandler, emailHandler, wsHandler, authMiddleware)
+	routes.Setup(e, userHandler, authHandler, accountHandler, roleHandler, organizationHandler, emailHandler, wsHandler, authMiddleware)
 
 	// Start Server
 	logger.Info("Starting Server on Port %s", cfg.Port)
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -30,18 +31,89 @@ type EmailConfig struct {
 	FromEmail    string `yaml:"from_email"`
 	FromName     string `yaml:"from_name"`
 	TemplatesDir string `yaml:"templates_dir"`
+	// Page that receives password reset tokens (usually the frontend)
+	ResetPasswordURL string `yaml:"reset_password_url"`
+	// Page that receives magic link sign-in tokens
+	MagicLinkURL string `yaml:"magic_link_url"`
+}
+
+type MFAConfig struct {
+	Issuer        string `yaml:"issuer"`
+	EncryptionKey string `yaml:"encryption_key"`
+}
+
+type LoginProtectionConfig struct {
+	MaxAccountAttempts int           `yaml:"max_account_attempts"`
+	MaxIPAttempts      int           `yaml:"max_ip_attempts"`
+	DelayAfter         int           `yaml:"delay_after"`
+	MaxDelay           time.Duration `yaml:"max_delay"`
+	Window             time.Duration `yaml:"window"`
+	LockoutDuration    time.Duration `yaml:"lockout_duration"`
+}
+
+type PasswordHashingConfig struct {
+	Algorithm         string `yaml:"algorithm"`
+	BcryptCost        int    `yaml:"bcrypt_cost"`
+	Argon2Memory      uint32 `yaml:"argon2_memory"`
+	Argon2Iterations  uint32 `yaml:"argon2_iterations"`
+	Argon2Parallelism uint8  `yaml:"argon2_parallelism"`
+}
+
+type PasswordPolicyConfig struct {
+	MinLength             int    `yaml:"min_length"`
+	MaxLength             int    `yaml:"max_length"`
+	RequireUppercase      bool   `yaml:"require_uppercase"`
+	RequireLowercase      bool   `yaml:"require_lowercase"`
+	RequireDigit          bool   `yaml:"require_digit"`
+	RequireSymbol         bool   `yaml:"require_symbol"`
+	AllowPersonalInfo     bool   `yaml:"allow_personal_info"`
+	BreachedPasswordsFile string `yaml:"breached_passwords_file"`
+}
+
+type OAuthProviderConfig struct {
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	IssuerURL    string   `yaml:"issuer_url"`
+	AuthURL      string   `yaml:"auth_url"`
+	TokenURL     string   `yaml:"token_url"`
+	UserInfoURL  string   `yaml:"userinfo_url"`
+	RedirectURL  string   `yaml:"redirect_url"`
+	Scopes       []string `yaml:"scopes"`
+	TrustEmail   bool     `yaml:"trust_email"`
+}
+
+type JWTKeyConfig struct {
+	ID             string `yaml:"id"`
+	Algorithm      string `yaml:"algorithm"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"`
+}
+
+type JWTConfig struct {
+	SigningKeyID string         `yaml:"signing_key_id"`
+	Keys         []JWTKeyConfig `yaml:"keys"`
+	AcceptHS256  bool           `yaml:"accept_hs256"`
 }
 
 type Config struct {
-	Port         string        `yaml:"port"`
-	MongoURL     string        `yaml:"mongo_url"`
-	LogLevel     string        `yaml:"log_level"`
-	DatabaseName string        `yaml:"database_name"`
-	JWTSecret    string        `yaml:"jwt_secret"`
-	Redis        RedisConfig   `yaml:"redis"`
-	Storage      StorageConfig `yaml:"storage"`
-	Email        EmailConfig   `yaml:"email"`
-	WorkerCount  int           `yaml:"worker_count"`
+	Port            string                         `yaml:"port"`
+	MongoURL        string                         `yaml:"mongo_url"`
+	LogLevel        string                         `yaml:"log_level"`
+	TrustedProxies  []string                       `yaml:"trusted_proxies"`
+	DatabaseName    string                         `yaml:"database_name"`
+	JWTSecret       string                         `yaml:"jwt_secret"`
+	JWT             JWTConfig                      `yaml:"jwt"`
+	AccessTokenTTL  time.Duration                  `yaml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration                  `yaml:"refresh_token_ttl"`
+	MFA             MFAConfig                      `yaml:"mfa"`
+	LoginProtection LoginProtectionConfig          `yaml:"login_protection"`
+	PasswordHashing PasswordHashingConfig          `yaml:"password_hashing"`
+	PasswordPolicy  PasswordPolicyConfig           `yaml:"password_policy"`
+	OAuthProviders  map[string]OAuthProviderConfig `yaml:"oauth_providers"`
+	Redis           RedisConfig                    `yaml:"redis"`
+	Storage         StorageConfig                  `yaml:"storage"`
+	Email           EmailConfig                    `yaml:"email"`
+	WorkerCount     int                            `yaml:"worker_count"`
 }
 
 func LoadConfig(filename string) (*Config, error) {
@@ -68,6 +140,10 @@ func LoadConfig(filename string) (*Config, error) {
 		cfg.JWTSecret = jwtSecret
 	}
 
+	if mfaKey := os.Getenv("MFA_ENCRYPTION_KEY"); mfaKey != "" {
+		cfg.MFA.EncryptionKey = mfaKey
+	}
+
 	if redisAddr := os.Getenv("REDIS_ADDR"); redisAddr != "" {
 		cfg.Redis.Addr = redisAddr
 	}
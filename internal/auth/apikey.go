@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	apiKeyPrefix       = "bak_"
+	apiKeyPrefixLength = 12
+	// apiKeyTouchInterval limits how often last_used_at is written for busy keys
+	apiKeyTouchInterval = time.Minute
+	// MFAAPIKeyMaxTTL caps the lifetime of keys created after MFA, since they
+	// satisfy MFA requirements for as long as they live
+	MFAAPIKeyMaxTTL = 30 * 24 * time.Hour
+)
+
+// CreateAPIKey issues a named API key limited to a subset of the user's role
+// permissions. The plain key is returned once and only its hash is stored.
+// A key created after MFA expires within MFAAPIKeyMaxTTL.
+func (s *AuthService) CreateAPIKey(userID primitive.ObjectID, mfa bool, request *models.CreateAPIKeyRequest) (*models.APIKey, string, error) {
+	auth, err := s.authRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, "", fmt.Errorf("user not found")
+	}
+
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		return nil, "", fmt.Errorf("expiry must be in the future")
+	}
+
+	expiresAt := request.ExpiresAt
+	if mfa {
+		limit := time.Now().Add(MFAAPIKeyMaxTTL)
+		if expiresAt == nil || expiresAt.After(limit) {
+			expiresAt = &limit
+		}
+	}
+
+	for _, permission := range request.Permissions {
+		if permission.Resource == "" || permission.Action == "" {
+			return nil, "", fmt.Errorf("invalid permission")
+		}
+
+		// Deny entries only narrow the key further
+		if permission.IsDeny() {
+			continue
+		}
+
+		allowed, err := s.HasPermission(auth.RoleID, permission.Resource, permission.Action)
+		if err != nil {
+			return nil, "", err
+		}
+		if !allowed {
+			return nil, "", fmt.Errorf("permission %s:%s is not granted by your role", permission.Resource, permission.Action)
+		}
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	apiKey := &models.APIKey{
+		UserID:      userID,
+		Name:        request.Name,
+		Prefix:      key[:apiKeyPrefixLength],
+		KeyHash:     hashToken(key),
+		Permissions: request.Permissions,
+		MFA:         mfa,
+		ExpiresAt:   expiresAt,
+	}
+
+	if err := s.apiKeyRepo.Create(apiKey); err != nil {
+		return nil, "", err
+	}
+
+	return apiKey, key, nil
+}
+
+// ListAPIKeys returns the user's API keys, including revoked and expired ones
+func (s *AuthService) ListAPIKeys(userID primitive.ObjectID) ([]*models.APIKey, error) {
+	return s.apiKeyRepo.ListByUserID(userID)
+}
+
+// RevokeAPIKey revokes one of the user's API keys
+func (s *AuthService) RevokeAPIKey(userID, keyID primitive.ObjectID) error {
+	return s.apiKeyRepo.Revoke(keyID, userID)
+}
+
+// ValidateAPIKey looks up a live API key and its owner, and records its use
+func (s *AuthService) ValidateAPIKey(key string) (*models.APIKey, *models.UserAuth, error) {
+	apiKey, err := s.apiKeyRepo.GetByHash(hashToken(key))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid api key")
+	}
+
+	if apiKey.RevokedAt != nil {
+		return nil, nil, fmt.Errorf("api key has been revoked")
+	}
+
+	now := time.Now()
+	if apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt) {
+		return nil, nil, fmt.Errorf("api key has expired")
+	}
+
+	auth, err := s.authRepo.GetByUserID(apiKey.UserID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid api key")
+	}
+
+	if !auth.IsActive {
+		return nil, nil, fmt.Errorf("account is not activated")
+	}
+
+	// Best effort; a failed write must not reject the request
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyTouchInterval {
+		_ = s.apiKeyRepo.UpdateLastUsed(apiKey.ID)
+	}
+
+	return apiKey, auth, nil
+}
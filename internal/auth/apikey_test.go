@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// apiKeyCache never holds anything, so the role is read from its repository
+type apiKeyCache struct {
+	cache.Cache
+}
+
+func (apiKeyCache) Get(key string, dest any) error { return redis.Nil }
+
+func (apiKeyCache) SetWithTags(key string, value any, tags []string, expiration time.Duration) error {
+	return nil
+}
+
+type apiKeyAuthRepository struct {
+	repository.AuthRepository
+	auth *models.UserAuth
+}
+
+func (r *apiKeyAuthRepository) GetByUserID(userID primitive.ObjectID) (*models.UserAuth, error) {
+	return r.auth, nil
+}
+
+type apiKeyRoleRepository struct {
+	repository.RoleRepository
+	role *models.Role
+}
+
+func (r *apiKeyRoleRepository) GetByID(id primitive.ObjectID) (*models.Role, error) {
+	return r.role, nil
+}
+
+type apiKeyRepository struct {
+	repository.APIKeyRepository
+}
+
+func (apiKeyRepository) Create(apiKey *models.APIKey) error { return nil }
+
+func TestCreateAPIKeyExpiry(t *testing.T) {
+	inAWeek := time.Now().Add(7 * 24 * time.Hour)
+	inAYear := time.Now().Add(365 * 24 * time.Hour)
+
+	tests := []struct {
+		name      string
+		mfa       bool
+		expiresAt *time.Time
+		want      func(expiresAt *time.Time) bool
+	}{
+		{"no mfa, no expiry", false, nil, func(got *time.Time) bool { return got == nil }},
+		{"no mfa keeps expiry", false, &inAYear, func(got *time.Time) bool { return got.Equal(inAYear) }},
+		{"mfa without expiry is capped", true, nil, func(got *time.Time) bool {
+			return got != nil && time.Until(*got) <= MFAAPIKeyMaxTTL && time.Until(*got) > MFAAPIKeyMaxTTL-time.Minute
+		}},
+		{"mfa keeps a shorter expiry", true, &inAWeek, func(got *time.Time) bool { return got.Equal(inAWeek) }},
+		{"mfa caps a longer expiry", true, &inAYear, func(got *time.Time) bool { return got.Before(inAYear) && time.Until(*got) <= MFAAPIKeyMaxTTL }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role := &models.Role{ID: primitive.NewObjectID(), IsActive: true, Permissions: []models.Permission{models.NewPermission("users", "read")}}
+			userID := primitive.NewObjectID()
+			service := NewAuthService(Repositories{
+				Auth:    &apiKeyAuthRepository{auth: &models.UserAuth{UserID: userID, RoleID: role.ID, IsActive: true}},
+				Roles:   &apiKeyRoleRepository{role: role},
+				APIKeys: apiKeyRepository{},
+			}, apiKeyCache{}, AuthConfig{JWTSecret: "test-secret"})
+
+			apiKey, _, err := service.CreateAPIKey(userID, tt.mfa, &models.CreateAPIKeyRequest{
+				Name:        "script",
+				Permissions: []models.Permission{models.NewPermission("users", "read")},
+				ExpiresAt:   tt.expiresAt,
+			})
+			if err != nil {
+				t.Fatalf("CreateAPIKey() error = %v", err)
+			}
+			if !tt.want(apiKey.ExpiresAt) {
+				t.Errorf("CreateAPIKey() expires_at = %v", apiKey.ExpiresAt)
+			}
+		})
+	}
+}
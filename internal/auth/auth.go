@@ -2,71 +2,180 @@ package auth
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/madhiyono/base-api-nosql/internal/cache"
 	"github.com/madhiyono/base-api-nosql/internal/models"
 	"github.com/madhiyono/base-api-nosql/internal/repository"
+	"github.com/madhiyono/base-api-nosql/pkg/logger"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// Repositories are the stores the auth service reads and writes. Tests may
+// leave the ones they don't exercise nil.
+type Repositories struct {
+	Auth          repository.AuthRepository
+	Users         repository.UserRepository
+	Roles         repository.RoleRepository
+	RefreshTokens repository.RefreshTokenRepository
+	LoginHistory  repository.LoginHistoryRepository
+	Identities    repository.IdentityRepository
+	APIKeys       repository.APIKeyRepository
+	Sessions      repository.SessionRepository
+	AuditLogs     repository.AuditLogRepository
+	Organizations repository.OrganizationRepository
+	Memberships   repository.MembershipRepository
+	RoleGrants    repository.RoleGrantRepository
+}
+
 type AuthService struct {
-	authRepo repository.AuthRepository
-	userRepo repository.UserRepository
-	roleRepo repository.RoleRepository
-	jwtKey   []byte
-}
-
-func NewAuthService(
-	authRepo repository.AuthRepository,
-	userRepo repository.UserRepository,
-	roleRepo repository.RoleRepository,
-	jwtKey string,
-) *AuthService {
+	authRepo     repository.AuthRepository
+	userRepo     repository.UserRepository
+	roleRepo     repository.RoleRepository
+	refreshRepo  repository.RefreshTokenRepository
+	loginRepo    repository.LoginHistoryRepository
+	identityRepo repository.IdentityRepository
+	apiKeyRepo   repository.APIKeyRepository
+	sessionRepo  repository.SessionRepository
+	auditRepo    repository.AuditLogRepository
+	orgRepo      repository.OrganizationRepository
+	memberRepo   repository.MembershipRepository
+	grantRepo    repository.RoleGrantRepository
+	cache        cache.Cache
+	keys         *KeySet
+	mfaKey       []byte
+	hasher       *passwordHasher
+	roleCache    *roleCache
+	config       AuthConfig
+}
+
+func NewAuthService(repos Repositories, cache cache.Cache, config AuthConfig) *AuthService {
+	if config.AccessTokenTTL <= 0 {
+		config.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+	if config.RefreshTokenTTL <= 0 {
+		config.RefreshTokenTTL = DefaultRefreshTokenTTL
+	}
+	if config.MFAIssuer == "" {
+		config.MFAIssuer = DefaultMFAIssuer
+	}
+	config.LoginProtection = withLoginProtectionDefaults(config.LoginProtection)
+	config.PasswordHashing = withPasswordHashingDefaults(config.PasswordHashing)
+	if config.PasswordPolicy == nil {
+		// Without a breached password file this can't fail
+		config.PasswordPolicy, _ = NewPasswordPolicy(PasswordPolicyConfig{})
+	}
+	if config.Keys == nil {
+		config.Keys = NewHMACKeySet(config.JWTSecret)
+	}
+	if config.Logger == nil {
+		config.Logger = logger.New("info")
+	}
+
 	return &AuthService{
-		authRepo: authRepo,
-		userRepo: userRepo,
-		roleRepo: roleRepo,
-		jwtKey:   []byte(jwtKey),
+		authRepo:     repos.Auth,
+		userRepo:     repos.Users,
+		roleRepo:     repos.Roles,
+		refreshRepo:  repos.RefreshTokens,
+		loginRepo:    repos.LoginHistory,
+		identityRepo: repos.Identities,
+		apiKeyRepo:   repos.APIKeys,
+		sessionRepo:  repos.Sessions,
+		auditRepo:    repos.AuditLogs,
+		orgRepo:      repos.Organizations,
+		memberRepo:   repos.Memberships,
+		grantRepo:    repos.RoleGrants,
+		cache:        cache,
+		keys:         config.Keys,
+		mfaKey:       encryptionKey(config.MFAEncryptionKey),
+		hasher:       &passwordHasher{config: config.PasswordHashing},
+		roleCache:    newRoleCache(),
+		config:       config,
 	}
 }
 
+// HashPassword hashes a password with the configured algorithm
 func (s *AuthService) HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+	return s.hasher.hash(password)
 }
 
+// ValidatePassword checks a new password against the password policy and
+// returns a *PasswordPolicyError listing every violation
+func (s *AuthService) ValidatePassword(password, name, email string) error {
+	return s.config.PasswordPolicy.Validate(password, name, email)
+}
+
+// CheckPasswordHash verifies a password against an argon2id or bcrypt hash
 func (s *AuthService) CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	return s.hasher.verify(password, hash)
+}
+
+// NeedsRehash reports whether a hash should be replaced with one using the
+// configured algorithm and parameters
+func (s *AuthService) NeedsRehash(hash string) bool {
+	return s.hasher.needsRehash(hash)
+}
+
+// rehashPassword stores the password hashed with the current settings
+func (s *AuthService) rehashPassword(userID primitive.ObjectID, password string) error {
+	hashedPassword, err := s.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return s.authRepo.UpdatePassword(userID, hashedPassword)
 }
 
 func (s *AuthService) GenerateToken(user *models.User, roleID primitive.ObjectID) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+	return s.generateAccessToken(user, roleID, primitive.NilObjectID, "", false)
+}
+
+func (s *AuthService) generateAccessToken(user *models.User, roleID, tenantID primitive.ObjectID, sessionID string, mfa bool) (string, error) {
+	now := time.Now()
+	expirationTime := now.Add(s.config.AccessTokenTTL)
 
 	claims := &models.Claims{
-		UserID: user.ID,
-		Email:  user.Email,
-		RoleID: roleID,
+		UserID:    user.ID,
+		Email:     user.Email,
+		RoleID:    roleID,
+		TenantID:  tenantID,
+		SessionID: sessionID,
+		MFA:       mfa,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        primitive.NewObjectID().Hex(),
+			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.jwtKey)
+	return s.keys.sign(claims)
 }
 
+// ValidateToken validates an access token. Restricted tokens such as MFA
+// challenges are rejected.
 func (s *AuthService) ValidateToken(tokenString string) (*models.Claims, error) {
+	claims, err := s.parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != "" {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	return claims, nil
+}
+
+// JWKS returns the public keys downstream services use to verify tokens
+func (s *AuthService) JWKS() JWKSet {
+	return s.keys.JWKS()
+}
+
+func (s *AuthService) parseToken(tokenString string) (*models.Claims, error) {
 	claims := &models.Claims{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.jwtKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.keys.keyFunc)
 
 	if err != nil {
 		return nil, err
@@ -85,6 +194,10 @@ func (s *AuthService) Register(request *models.RegisterRequest) (*models.AuthRes
 		return nil, fmt.Errorf("user already exists")
 	}
 
+	if err := s.ValidatePassword(request.Password, request.Name, request.Email); err != nil {
+		return nil, err
+	}
+
 	// Create user
 	user := &models.User{
 		Name:  request.Name,
@@ -96,7 +209,7 @@ func (s *AuthService) Register(request *models.RegisterRequest) (*models.AuthRes
 	}
 
 	// Get default role (user role)
-	defaultRole, err := s.roleRepo.GetByName("user")
+	defaultRole, err := s.roleRepo.GetByName(models.DefaultRoleName)
 	if err != nil {
 		return nil, fmt.Errorf("default role not found")
 	}
@@ -120,23 +233,31 @@ func (s *AuthService) Register(request *models.RegisterRequest) (*models.AuthRes
 		return nil, err
 	}
 
-	// Generate token
-	token, err := s.GenerateToken(user, auth.RoleID)
+	session, err := s.startSession(user.ID, false, "", "")
 	if err != nil {
 		return nil, err
 	}
 
-	return &models.AuthResponse{
-		Token: token,
-		User:  user,
-		Role:  defaultRole,
-	}, nil
+	return s.issueTokens(user, defaultRole, session.ID, primitive.NilObjectID, false)
 }
 
 func (s *AuthService) Login(request *models.LoginRequest) (*models.AuthResponse, error) {
+	// Refuse before hashing anything while the account or IP is locked out
+	if err := s.checkLoginAllowed(request.Email, request.IPAddress); err != nil {
+		s.recordLoginEvent(&models.LoginEvent{
+			Email:     request.Email,
+			Event:     models.LoginEventBlocked,
+			Reason:    err.Error(),
+			IPAddress: request.IPAddress,
+			UserAgent: request.UserAgent,
+		})
+		return nil, err
+	}
+
 	// Get auth record
 	auth, err := s.authRepo.GetByEmail(request.Email)
 	if err != nil {
+		s.registerLoginFailure(request.Email, request.IPAddress, request.UserAgent, nil, "unknown account")
 		return nil, fmt.Errorf("invalid credentials")
 	}
 
@@ -147,35 +268,299 @@ func (s *AuthService) Login(request *models.LoginRequest) (*models.AuthResponse,
 
 	// Check password
 	if !s.CheckPasswordHash(request.Password, auth.Password) {
+		s.registerLoginFailure(request.Email, request.IPAddress, request.UserAgent, &auth.UserID, "invalid password")
 		return nil, fmt.Errorf("invalid credentials")
 	}
 
+	// Upgrade hashes made with an outdated algorithm or parameters while the
+	// plain password is at hand. Best effort, the login itself succeeded.
+	if s.NeedsRehash(auth.Password) {
+		if err := s.rehashPassword(auth.UserID, request.Password); err != nil {
+			s.config.Logger.Error("Failed to Upgrade Password Hash for User %s: %v", auth.UserID.Hex(), err)
+		}
+	}
+
 	// Get user details
 	user, err := s.userRepo.GetByID(auth.UserID.Hex())
 	if err != nil {
 		return nil, err
 	}
 
+	// Enrolled users must complete the second factor first
+	if auth.MFAEnabled {
+		s.recordLoginEvent(&models.LoginEvent{
+			UserID:    &auth.UserID,
+			Email:     auth.Email,
+			Event:     models.LoginEventSuccess,
+			Reason:    "password verified, mfa pending",
+			IPAddress: request.IPAddress,
+			UserAgent: request.UserAgent,
+		})
+		return s.mfaChallenge(user)
+	}
+
+	// Counters are only cleared once the login is complete, so a correct
+	// password can't wipe out failed MFA attempts
+	s.resetLoginFailures(request.Email)
+	s.recordLoginEvent(&models.LoginEvent{
+		UserID:    &auth.UserID,
+		Email:     auth.Email,
+		Event:     models.LoginEventSuccess,
+		IPAddress: request.IPAddress,
+		UserAgent: request.UserAgent,
+	})
+
 	// Get role details
 	role, err := s.roleRepo.GetByID(auth.RoleID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Generate token
-	token, err := s.GenerateToken(user, auth.RoleID)
+	// Start a new session and refresh token family for this login
+	session, err := s.startSession(user.ID, false, request.IPAddress, request.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user, role, session.ID, primitive.NilObjectID, false)
+}
+
+// LoginWithOAuth signs in the user behind an external identity. Unknown
+// identities are linked to the account with the same verified email, or a new
+// user with the default role is created.
+func (s *AuthService) LoginWithOAuth(profile *models.OAuthProfile, ipAddress, userAgent string) (*models.AuthResponse, error) {
+	auth, err := s.resolveOAuthAccount(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(auth.UserID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	event := &models.LoginEvent{
+		UserID:    &auth.UserID,
+		Email:     auth.Email,
+		Event:     models.LoginEventSuccess,
+		Reason:    "oauth: " + profile.Provider,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+	}
+
+	// The provider replaces the password, not the second factor
+	if auth.MFAEnabled {
+		event.Reason += ", mfa pending"
+		s.recordLoginEvent(event)
+		return s.mfaChallenge(user)
+	}
+	s.recordLoginEvent(event)
+
+	role, err := s.roleRepo.GetByID(auth.RoleID)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.startSession(user.ID, false, ipAddress, userAgent)
 	if err != nil {
 		return nil, err
 	}
 
-	return &models.AuthResponse{
-		Token: token,
-		User:  user,
-		Role:  role,
-	}, nil
+	return s.issueTokens(user, role, session.ID, primitive.NilObjectID, false)
 }
 
-// Check if user has permission
+// LoginWithMagicLink signs in the owner of a redeemed magic link. Following
+// the link proves control of the address, so a pending registration is activated.
+func (s *AuthService) LoginWithMagicLink(userID primitive.ObjectID, ipAddress, userAgent string) (*models.AuthResponse, error) {
+	auth, err := s.authRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sign-in link")
+	}
+
+	if !auth.IsActive {
+		if err := s.authRepo.ActivateUser(auth.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := s.userRepo.GetByID(auth.UserID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	event := &models.LoginEvent{
+		UserID:    &auth.UserID,
+		Email:     auth.Email,
+		Event:     models.LoginEventSuccess,
+		Reason:    "magic link",
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+	}
+
+	// The link replaces the password, not the second factor
+	if auth.MFAEnabled {
+		event.Reason += ", mfa pending"
+		s.recordLoginEvent(event)
+		return s.mfaChallenge(user)
+	}
+	s.recordLoginEvent(event)
+
+	role, err := s.roleRepo.GetByID(auth.RoleID)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.startSession(user.ID, false, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user, role, session.ID, primitive.NilObjectID, false)
+}
+
+func (s *AuthService) resolveOAuthAccount(profile *models.OAuthProfile) (*models.UserAuth, error) {
+	// Known identity. Identities are only linked to active accounts, so an
+	// inactive one was deactivated since.
+	if identity, err := s.identityRepo.GetByProviderSubject(profile.Provider, profile.Subject); err == nil {
+		auth, err := s.authRepo.GetByUserID(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !auth.IsActive {
+			return nil, fmt.Errorf("account is deactivated")
+		}
+		if err := s.identityRepo.UpdateLastLogin(identity.ID); err != nil {
+			return nil, err
+		}
+		return auth, nil
+	}
+
+	// Only a verified email may be matched or used for a new account,
+	// otherwise anyone could claim an existing account through a provider
+	if profile.Email == "" || !profile.EmailVerified {
+		return nil, fmt.Errorf("provider did not return a verified email")
+	}
+
+	auth, err := s.authRepo.GetByEmail(profile.Email)
+	if err == nil {
+		// The provider verified the address, finish a pending registration
+		if !auth.IsActive {
+			if err := s.authRepo.ActivateUser(auth.UserID); err != nil {
+				return nil, err
+			}
+			auth.IsActive = true
+		}
+	} else {
+		auth, err = s.createOAuthUser(profile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	identity := &models.Identity{
+		UserID:   auth.UserID,
+		Provider: profile.Provider,
+		Subject:  profile.Subject,
+		Email:    profile.Email,
+	}
+	if err := s.identityRepo.Create(identity); err != nil {
+		return nil, err
+	}
+
+	return auth, nil
+}
+
+// createOAuthUser registers a user the same way Register does, without a
+// password; one can be set later through the password reset flow
+func (s *AuthService) createOAuthUser(profile *models.OAuthProfile) (*models.UserAuth, error) {
+	name := profile.Name
+	if name == "" {
+		name = strings.Split(profile.Email, "@")[0]
+	}
+
+	user := &models.User{
+		Name:  name,
+		Email: profile.Email,
+	}
+
+	if err := s.userRepo.Create(user); err != nil {
+		return nil, err
+	}
+
+	// Get default role (user role)
+	defaultRole, err := s.roleRepo.GetByName(models.DefaultRoleName)
+	if err != nil {
+		return nil, fmt.Errorf("default role not found")
+	}
+
+	auth := &models.UserAuth{
+		UserID:   user.ID,
+		Email:    profile.Email,
+		RoleID:   defaultRole.ID,
+		IsActive: true,
+	}
+
+	if err := s.authRepo.Create(auth); err != nil {
+		return nil, err
+	}
+
+	return auth, nil
+}
+
+// VerifyPassword checks a user's current password
+func (s *AuthService) VerifyPassword(userID primitive.ObjectID, password string) error {
+	auth, err := s.authRepo.GetByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	if !s.CheckPasswordHash(password, auth.Password) {
+		return fmt.Errorf("invalid credentials")
+	}
+
+	return nil
+}
+
+// ChangePassword replaces the user's password after checking the current one
+func (s *AuthService) ChangePassword(userID primitive.ObjectID, currentPassword, newPassword string) error {
+	if err := s.VerifyPassword(userID, currentPassword); err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetByID(userID.Hex())
+	if err != nil {
+		return err
+	}
+
+	if err := s.ValidatePassword(newPassword, user.Name, user.Email); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return s.authRepo.UpdatePassword(userID, hashedPassword)
+}
+
+// HasPermission evaluates the role's effective permissions, including inherited ones
 func (s *AuthService) HasPermission(roleID primitive.ObjectID, resource, action string) (bool, error) {
-	return s.roleRepo.HasPermission(roleID, resource, action)
+	role, err := s.cachedRoleFor(roleID)
+	if err != nil {
+		return false, err
+	}
+
+	return models.Evaluate(role.Permissions, resource, action), nil
+}
+
+// IsAdminRole reports whether the role, with its inherited permissions, is
+// an admin role
+func (s *AuthService) IsAdminRole(roleID primitive.ObjectID) (bool, error) {
+	role, err := s.cachedRoleFor(roleID)
+	if err != nil {
+		return false, err
+	}
+
+	return managesRoles(role.Permissions), nil
 }
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/pkg/logger"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AuthConfig holds the configuration for the auth service
+type AuthConfig struct {
+	JWTSecret       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// Keys signs and verifies tokens. Defaults to HS256 with JWTSecret.
+	Keys *KeySet
+
+	// MFAEncryptionKey encrypts stored TOTP secrets (base64 encoded 32 bytes
+	// recommended). Required, and kept separate from JWTSecret so a leaked
+	// signing secret doesn't also expose the secrets.
+	MFAEncryptionKey string
+	// MFAIssuer is the account issuer shown in authenticator apps
+	MFAIssuer string
+
+	LoginProtection LoginProtectionConfig
+	PasswordHashing PasswordHashingConfig
+	// PasswordPolicy validates new passwords. Defaults to a minimum length of
+	// DefaultPasswordMinLength without a breached password list.
+	PasswordPolicy *PasswordPolicy
+
+	// Logger reports failures that don't fail the request
+	Logger *logger.Logger
+}
+
+// LoginProtectionConfig controls failed login counters and lockouts
+type LoginProtectionConfig struct {
+	MaxAccountAttempts int           // failures before the account is locked
+	MaxIPAttempts      int           // failures before the IP address is locked
+	DelayAfter         int           // failures before progressive delays start
+	MaxDelay           time.Duration // upper bound of a progressive delay
+	Window             time.Duration // how long failures are counted
+	LockoutDuration    time.Duration
+}
+
+// PasswordHashingConfig selects the algorithm for new password hashes. Hashes
+// with other parameters are upgraded on the next successful login.
+type PasswordHashingConfig struct {
+	Algorithm         string // argon2id or bcrypt
+	BcryptCost        int
+	Argon2Memory      uint32 // KiB
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+}
+
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+	DefaultMFAIssuer       = "Base API"
+)
+
+var DefaultLoginProtection = LoginProtectionConfig{
+	MaxAccountAttempts: 5,
+	MaxIPAttempts:      20,
+	DelayAfter:         3,
+	MaxDelay:           30 * time.Second,
+	Window:             15 * time.Minute,
+	LockoutDuration:    15 * time.Minute,
+}
+
+// DefaultPasswordHashing follows the OWASP argon2id recommendation
+var DefaultPasswordHashing = PasswordHashingConfig{
+	Algorithm:         HashArgon2id,
+	BcryptCost:        12,
+	Argon2Memory:      19 * 1024,
+	Argon2Iterations:  2,
+	Argon2Parallelism: 1,
+}
+
+// Validate checks the configured parameters, once unset fields are
+// defaulted, so a bad value fails at startup rather than on every login
+func (c PasswordHashingConfig) Validate() error {
+	c = withPasswordHashingDefaults(c)
+	if c.Algorithm != HashBcrypt && c.Algorithm != HashArgon2id {
+		return fmt.Errorf("unknown password hashing algorithm %q, use %s or %s", c.Algorithm, HashArgon2id, HashBcrypt)
+	}
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return validateArgon2Params(c.Argon2Memory, c.Argon2Iterations, c.Argon2Parallelism)
+}
+
+// withPasswordHashingDefaults fills unset fields from DefaultPasswordHashing
+func withPasswordHashingDefaults(config PasswordHashingConfig) PasswordHashingConfig {
+	if config.Algorithm == "" {
+		config.Algorithm = DefaultPasswordHashing.Algorithm
+	}
+	if config.BcryptCost == 0 {
+		config.BcryptCost = DefaultPasswordHashing.BcryptCost
+	}
+	if config.Argon2Memory == 0 {
+		config.Argon2Memory = DefaultPasswordHashing.Argon2Memory
+	}
+	if config.Argon2Iterations == 0 {
+		config.Argon2Iterations = DefaultPasswordHashing.Argon2Iterations
+	}
+	if config.Argon2Parallelism == 0 {
+		config.Argon2Parallelism = DefaultPasswordHashing.Argon2Parallelism
+	}
+	return config
+}
+
+// withLoginProtectionDefaults fills unset fields from DefaultLoginProtection
+func withLoginProtectionDefaults(config LoginProtectionConfig) LoginProtectionConfig {
+	if config.MaxAccountAttempts <= 0 {
+		config.MaxAccountAttempts = DefaultLoginProtection.MaxAccountAttempts
+	}
+	if config.MaxIPAttempts <= 0 {
+		config.MaxIPAttempts = DefaultLoginProtection.MaxIPAttempts
+	}
+	if config.DelayAfter <= 0 {
+		config.DelayAfter = DefaultLoginProtection.DelayAfter
+	}
+	if config.MaxDelay <= 0 {
+		config.MaxDelay = DefaultLoginProtection.MaxDelay
+	}
+	if config.Window <= 0 {
+		config.Window = DefaultLoginProtection.Window
+	}
+	if config.LockoutDuration <= 0 {
+		config.LockoutDuration = DefaultLoginProtection.LockoutDuration
+	}
+	return config
+}
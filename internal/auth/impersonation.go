@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// impersonationTTL is deliberately short and impersonation tokens are never refreshed
+const impersonationTTL = 15 * time.Minute
+
+var (
+	// ErrAlreadyImpersonating is returned when an impersonation token is used to impersonate again
+	ErrAlreadyImpersonating = errors.New("already impersonating")
+	// ErrImpersonateSelf is returned when an admin targets their own account
+	ErrImpersonateSelf = errors.New("cannot impersonate yourself")
+	// ErrImpersonationTargetNotFound is returned when the target user doesn't exist
+	ErrImpersonationTargetNotFound = errors.New("user not found")
+	// ErrImpersonationTargetInactive is returned when the target account is deactivated
+	ErrImpersonationTargetInactive = errors.New("account is deactivated")
+	// ErrImpersonateAdmin is returned when the target is an administrator
+	ErrImpersonateAdmin = errors.New("cannot impersonate an administrator")
+)
+
+// Impersonate issues a short-lived access token for the target user on behalf
+// of an admin. The token's act claim names the admin so every request made
+// with it can be attributed.
+func (s *AuthService) Impersonate(actor *models.Claims, targetUserID primitive.ObjectID, reason, ipAddress string) (*models.AuthResponse, error) {
+	if actor.Actor != nil {
+		return nil, ErrAlreadyImpersonating
+	}
+
+	if actor.UserID == targetUserID {
+		return nil, ErrImpersonateSelf
+	}
+
+	auth, err := s.authRepo.GetByUserID(targetUserID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrImpersonationTargetNotFound, err)
+	}
+
+	if !auth.IsActive {
+		return nil, ErrImpersonationTargetInactive
+	}
+
+	// Admins can't be impersonated, that would hand out their privileges
+	isAdmin, err := s.IsAdminRole(auth.RoleID)
+	if err != nil {
+		return nil, err
+	}
+	if isAdmin {
+		return nil, ErrImpersonateAdmin
+	}
+
+	user, err := s.userRepo.GetByID(auth.UserID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.roleRepo.GetByID(auth.RoleID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expirationTime := now.Add(impersonationTTL)
+
+	claims := &models.Claims{
+		UserID: user.ID,
+		Email:  user.Email,
+		RoleID: role.ID,
+		MFA:    actor.MFA,
+		Actor: &models.ActorClaim{
+			UserID: actor.UserID,
+			Email:  actor.Email,
+		},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        primitive.NewObjectID().Hex(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+		},
+	}
+
+	token, err := s.keys.sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.auditRepo.Create(&models.AuditLog{
+		ActorID:   actor.UserID,
+		SubjectID: user.ID,
+		Action:    models.AuditActionImpersonationStarted,
+		Reason:    reason,
+		TokenID:   claims.ID,
+		IPAddress: ipAddress,
+	}); err != nil {
+		return nil, err
+	}
+
+	return &models.AuthResponse{
+		Token:     token,
+		ExpiresAt: expirationTime,
+		User:      user,
+		Role:      role,
+	}, nil
+}
+
+// RecordAudit stores an audit entry
+func (s *AuthService) RecordAudit(entry *models.AuditLog) error {
+	return s.auditRepo.Create(entry)
+}
+
+// AuditLog returns entries where the user acted or was acted upon
+func (s *AuthService) AuditLog(userID primitive.ObjectID, limit int64) ([]*models.AuditLog, error) {
+	return s.auditRepo.ListByUserID(userID, limit)
+}
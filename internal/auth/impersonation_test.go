@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// impersonationCache never holds anything, nothing is revoked
+type impersonationCache struct {
+	cache.Cache
+}
+
+func (impersonationCache) Get(key string, dest any) error { return redis.Nil }
+
+func (impersonationCache) SetWithTags(key string, value any, tags []string, expiration time.Duration) error {
+	return nil
+}
+
+func (impersonationCache) Exists(key string) (bool, error) { return false, nil }
+
+type impersonationAuthRepository struct {
+	repository.AuthRepository
+	auths map[primitive.ObjectID]*models.UserAuth
+}
+
+func (r *impersonationAuthRepository) GetByUserID(userID primitive.ObjectID) (*models.UserAuth, error) {
+	auth, ok := r.auths[userID]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return auth, nil
+}
+
+type impersonationUserRepository struct {
+	repository.UserRepository
+}
+
+func (impersonationUserRepository) GetByID(id string) (*models.User, error) {
+	userID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	return &models.User{ID: userID, Email: userID.Hex() + "@example.com"}, nil
+}
+
+type impersonationRoleRepository struct {
+	repository.RoleRepository
+	roles map[primitive.ObjectID]*models.Role
+}
+
+func (r *impersonationRoleRepository) GetByID(id primitive.ObjectID) (*models.Role, error) {
+	role, ok := r.roles[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return role, nil
+}
+
+type impersonationAuditRepository struct {
+	repository.AuditLogRepository
+	entries []*models.AuditLog
+}
+
+func (r *impersonationAuditRepository) Create(entry *models.AuditLog) error {
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func TestImpersonate(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string // "member", "admin", "inactive", "self" or "missing"
+		nested  bool   // the actor is already impersonating
+		wantErr error
+	}{
+		{"member", "member", false, nil},
+		{"already impersonating", "member", true, ErrAlreadyImpersonating},
+		{"self", "self", false, ErrImpersonateSelf},
+		{"missing user", "missing", false, ErrImpersonationTargetNotFound},
+		{"deactivated user", "inactive", false, ErrImpersonationTargetInactive},
+		{"administrator", "admin", false, ErrImpersonateAdmin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin := &models.Role{ID: primitive.NewObjectID(), Name: "admin", IsActive: true,
+				Permissions: []models.Permission{models.NewPermission("*", "*")}}
+			member := &models.Role{ID: primitive.NewObjectID(), Name: "member", IsActive: true}
+			actorID := primitive.NewObjectID()
+			auths := map[primitive.ObjectID]*models.UserAuth{
+				actorID: {UserID: actorID, RoleID: admin.ID, IsActive: true},
+			}
+
+			var targetID primitive.ObjectID
+			switch tt.target {
+			case "member", "inactive":
+				targetID = primitive.NewObjectID()
+				auths[targetID] = &models.UserAuth{UserID: targetID, RoleID: member.ID, IsActive: tt.target == "member"}
+			case "admin":
+				targetID = primitive.NewObjectID()
+				auths[targetID] = &models.UserAuth{UserID: targetID, RoleID: admin.ID, IsActive: true}
+			case "self":
+				targetID = actorID
+			case "missing":
+				targetID = primitive.NewObjectID()
+			}
+
+			audit := &impersonationAuditRepository{}
+			service := NewAuthService(Repositories{
+				Auth:  &impersonationAuthRepository{auths: auths},
+				Users: impersonationUserRepository{},
+				Roles: &impersonationRoleRepository{roles: map[primitive.ObjectID]*models.Role{
+					admin.ID: admin, member.ID: member,
+				}},
+				AuditLogs: audit,
+			}, impersonationCache{}, AuthConfig{JWTSecret: "test-secret"})
+
+			actor := &models.Claims{UserID: actorID, RoleID: admin.ID}
+			if tt.nested {
+				actor.Actor = &models.ActorClaim{UserID: primitive.NewObjectID()}
+			}
+
+			result, err := service.Impersonate(actor, targetID, "support ticket", "127.0.0.1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Impersonate() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(audit.entries) != 0 {
+					t.Errorf("audit entry recorded for a refused impersonation")
+				}
+				return
+			}
+
+			claims, err := service.ValidateToken(result.Token)
+			if err != nil {
+				t.Fatalf("ValidateToken() error = %v", err)
+			}
+			if claims.UserID != targetID || claims.Actor == nil || claims.Actor.UserID != actorID {
+				t.Errorf("token claims = %+v, want user %s acted on by %s", claims, targetID.Hex(), actorID.Hex())
+			}
+		})
+	}
+}
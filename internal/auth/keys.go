@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+func init() {
+	// Issue times carry milliseconds, so a token issued right after a
+	// "revoke all sessions" in the same second isn't taken for an older one
+	jwt.TimePrecision = time.Millisecond
+}
+
+// JWTKeyConfig describes one asymmetric key. Keys without a private key file
+// are only used to verify tokens, e.g. a retired key during rotation.
+type JWTKeyConfig struct {
+	ID             string
+	Algorithm      string
+	PrivateKeyFile string
+	PublicKeyFile  string
+}
+
+type jwtKey struct {
+	id         string
+	method     jwt.SigningMethod
+	privateKey crypto.PrivateKey
+	publicKey  crypto.PublicKey
+}
+
+// KeySet signs tokens with one active key and verifies them with every
+// configured key, selected by the kid header
+type KeySet struct {
+	signing      *jwtKey
+	verification map[string]*jwtKey
+	hmacSecret   []byte
+	acceptHMAC   bool
+}
+
+// NewHMACKeySet signs and verifies with the shared secret only (HS256)
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{
+		verification: make(map[string]*jwtKey),
+		hmacSecret:   []byte(secret),
+		acceptHMAC:   true,
+	}
+}
+
+// LoadKeySet loads asymmetric keys from PEM files. Without keys it falls back
+// to HS256 with the shared secret. acceptHMAC keeps accepting HS256 tokens
+// while migrating from the shared secret.
+func LoadKeySet(configs []JWTKeyConfig, signingKeyID, secret string, acceptHMAC bool) (*KeySet, error) {
+	if len(configs) == 0 {
+		return NewHMACKeySet(secret), nil
+	}
+
+	keySet := &KeySet{
+		verification: make(map[string]*jwtKey),
+		hmacSecret:   []byte(secret),
+		acceptHMAC:   acceptHMAC && secret != "",
+	}
+
+	for _, config := range configs {
+		key, err := loadKey(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load jwt key %q: %w", config.ID, err)
+		}
+		if _, exists := keySet.verification[key.id]; exists {
+			return nil, fmt.Errorf("duplicate jwt key id %q", key.id)
+		}
+		keySet.verification[key.id] = key
+	}
+
+	signing, ok := keySet.verification[signingKeyID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q is not configured", signingKeyID)
+	}
+	if signing.privateKey == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", signingKeyID)
+	}
+	keySet.signing = signing
+
+	return keySet, nil
+}
+
+func loadKey(config JWTKeyConfig) (*jwtKey, error) {
+	if config.ID == "" {
+		return nil, fmt.Errorf("key id is required")
+	}
+
+	key := &jwtKey{id: config.ID}
+
+	switch config.Algorithm {
+	case AlgorithmRS256:
+		key.method = jwt.SigningMethodRS256
+	case AlgorithmEdDSA:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", config.Algorithm)
+	}
+
+	if config.PrivateKeyFile != "" {
+		data, err := os.ReadFile(config.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		switch config.Algorithm {
+		case AlgorithmRS256:
+			privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			key.privateKey, key.publicKey = privateKey, &privateKey.PublicKey
+		case AlgorithmEdDSA:
+			privateKey, err := jwt.ParseEdPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			key.privateKey, key.publicKey = privateKey, privateKey.(ed25519.PrivateKey).Public()
+		}
+		return key, nil
+	}
+
+	if config.PublicKeyFile == "" {
+		return nil, fmt.Errorf("private_key_file or public_key_file is required")
+	}
+
+	data, err := os.ReadFile(config.PublicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.Algorithm {
+	case AlgorithmRS256:
+		key.publicKey, err = jwt.ParseRSAPublicKeyFromPEM(data)
+	case AlgorithmEdDSA:
+		key.publicKey, err = jwt.ParseEdPublicKeyFromPEM(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// sign signs the claims with the active key and sets the kid header
+func (k *KeySet) sign(claims jwt.Claims) (string, error) {
+	if k.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.hmacSecret)
+	}
+
+	token := jwt.NewWithClaims(k.signing.method, claims)
+	token.Header["kid"] = k.signing.id
+	return token.SignedString(k.signing.privateKey)
+}
+
+// keyFunc picks the verification key for a token and rejects algorithm mismatches
+func (k *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if !k.acceptHMAC {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return k.hmacSecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.verification[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %q", kid)
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.publicKey, nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public verification keys. The shared HS256 secret is never published.
+func (k *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+
+	for _, key := range k.verification {
+		jwk := JWK{
+			KeyID:     key.id,
+			Use:       "sig",
+			Algorithm: key.method.Alg(),
+		}
+
+		switch publicKey := key.publicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+
+	return set
+}
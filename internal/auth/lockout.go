@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginBlockedError is returned while an account or IP address is locked out
+// or has to wait before its next attempt
+type LoginBlockedError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LoginBlockedError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("login locked, retry after %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("login throttled, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+func accountSubject(email string) string {
+	return "account:" + models.NormalizeEmail(email)
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
+
+// checkLoginAllowed fails with a LoginBlockedError while the account or IP is
+// locked out or inside a progressive delay
+func (s *AuthService) checkLoginAllowed(email, ip string) error {
+	subjects := []string{accountSubject(email)}
+	if ip != "" {
+		subjects = append(subjects, ipSubject(ip))
+	}
+
+	for _, subject := range subjects {
+		ttl, err := s.cache.TTL(cache.LoginLockPrefix + subject)
+		if err != nil {
+			return err
+		}
+		if ttl > 0 {
+			return &LoginBlockedError{RetryAfter: ttl, Locked: true}
+		}
+
+		ttl, err = s.cache.TTL(cache.LoginDelayPrefix + subject)
+		if err != nil {
+			return err
+		}
+		if ttl > 0 {
+			return &LoginBlockedError{RetryAfter: ttl}
+		}
+	}
+
+	return nil
+}
+
+// registerLoginFailure counts a failed attempt against the account and the IP
+// and applies delays or a lockout once the thresholds are reached
+func (s *AuthService) registerLoginFailure(email, ip, userAgent string, userID *primitive.ObjectID, reason string) {
+	policy := s.config.LoginProtection
+
+	s.recordLoginEvent(&models.LoginEvent{
+		UserID:    userID,
+		Email:     email,
+		Event:     models.LoginEventFailure,
+		Reason:    reason,
+		IPAddress: ip,
+		UserAgent: userAgent,
+	})
+
+	account := accountSubject(email)
+	count, err := s.cache.Increment(cache.LoginFailurePrefix+account, policy.Window)
+	if err == nil {
+		if count >= int64(policy.MaxAccountAttempts) {
+			s.cache.Set(cache.LoginLockPrefix+account, true, policy.LockoutDuration)
+			s.cache.Delete(cache.LoginFailurePrefix + account)
+			s.recordLoginEvent(&models.LoginEvent{
+				UserID:    userID,
+				Email:     email,
+				Event:     models.LoginEventAccountLocked,
+				Reason:    fmt.Sprintf("%d failed attempts, locked for %s", count, policy.LockoutDuration),
+				IPAddress: ip,
+				UserAgent: userAgent,
+			})
+		} else if count >= int64(policy.DelayAfter) {
+			s.cache.Set(cache.LoginDelayPrefix+account, true, progressiveDelay(count-int64(policy.DelayAfter), policy.MaxDelay))
+		}
+	}
+
+	if ip == "" {
+		return
+	}
+
+	address := ipSubject(ip)
+	count, err = s.cache.Increment(cache.LoginFailurePrefix+address, policy.Window)
+	if err == nil && count >= int64(policy.MaxIPAttempts) {
+		s.cache.Set(cache.LoginLockPrefix+address, true, policy.LockoutDuration)
+		s.cache.Delete(cache.LoginFailurePrefix + address)
+		s.recordLoginEvent(&models.LoginEvent{
+			UserID:    userID,
+			Email:     email,
+			Event:     models.LoginEventIPLocked,
+			Reason:    fmt.Sprintf("%d failed attempts from this IP, locked for %s", count, policy.LockoutDuration),
+			IPAddress: ip,
+			UserAgent: userAgent,
+		})
+	}
+}
+
+// resetLoginFailures clears the account counters after a successful login.
+// IP counters are kept so one valid account can't hide guessing on others.
+func (s *AuthService) resetLoginFailures(email string) {
+	account := accountSubject(email)
+	s.cache.Delete(cache.LoginFailurePrefix + account)
+	s.cache.Delete(cache.LoginDelayPrefix + account)
+}
+
+// UnlockAccount lifts a lockout on the user's account (admin only)
+func (s *AuthService) UnlockAccount(userID, actorID primitive.ObjectID) error {
+	auth, err := s.authRepo.GetByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	account := accountSubject(auth.Email)
+	for _, prefix := range []string{cache.LoginLockPrefix, cache.LoginDelayPrefix, cache.LoginFailurePrefix} {
+		if err := s.cache.Delete(prefix + account); err != nil {
+			return err
+		}
+	}
+
+	s.recordLoginEvent(&models.LoginEvent{
+		UserID:  &auth.UserID,
+		Email:   auth.Email,
+		Event:   models.LoginEventAccountUnlocked,
+		ActorID: &actorID,
+	})
+
+	return nil
+}
+
+// LoginHistory returns the user's most recent login events
+func (s *AuthService) LoginHistory(userID primitive.ObjectID, limit int64) ([]*models.LoginEvent, error) {
+	return s.loginRepo.ListByUserID(userID, limit)
+}
+
+// recordLoginEvent stores a history entry. History is best-effort and never
+// fails a login.
+func (s *AuthService) recordLoginEvent(event *models.LoginEvent) {
+	s.loginRepo.Create(event)
+}
+
+// progressiveDelay doubles the wait for every failure past the threshold
+func progressiveDelay(step int64, max time.Duration) time.Duration {
+	if step > 16 {
+		return max
+	}
+	delay := time.Second << step
+	if delay > max {
+		return max
+	}
+	return delay
+}
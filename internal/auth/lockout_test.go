@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// lockoutCache keeps the failure counters in memory. Nothing here expires.
+type lockoutCache struct {
+	cache.Cache
+	counters map[string]int64
+	flags    map[string]bool
+}
+
+func (c *lockoutCache) Increment(key string, expiration time.Duration) (int64, error) {
+	c.counters[key]++
+	return c.counters[key], nil
+}
+
+func (c *lockoutCache) TTL(key string) (time.Duration, error) {
+	if c.flags[key] {
+		return time.Minute, nil
+	}
+	return 0, nil
+}
+
+func (c *lockoutCache) Set(key string, value any, expiration time.Duration) error {
+	c.flags[key] = true
+	return nil
+}
+
+func (c *lockoutCache) Delete(key string) error {
+	delete(c.counters, key)
+	delete(c.flags, key)
+	return nil
+}
+
+type lockoutAuthRepository struct {
+	repository.AuthRepository
+	auth *models.UserAuth
+}
+
+func (r *lockoutAuthRepository) GetByEmail(email string) (*models.UserAuth, error) {
+	return r.auth, nil
+}
+
+type lockoutUserRepository struct {
+	repository.UserRepository
+	user *models.User
+}
+
+func (r *lockoutUserRepository) GetByID(id string) (*models.User, error) {
+	return r.user, nil
+}
+
+type lockoutLoginHistory struct {
+	repository.LoginHistoryRepository
+}
+
+func (lockoutLoginHistory) Create(event *models.LoginEvent) error { return nil }
+
+func TestLoginKeepsFailuresUntilMFA(t *testing.T) {
+	const email = "mfa@example.com"
+	user := &models.User{ID: primitive.NewObjectID(), Email: email}
+	memory := &lockoutCache{counters: map[string]int64{}, flags: map[string]bool{}}
+	auth := &lockoutAuthRepository{}
+	service := NewAuthService(Repositories{
+		Auth:         auth,
+		Users:        &lockoutUserRepository{user: user},
+		LoginHistory: lockoutLoginHistory{},
+	}, memory, AuthConfig{JWTSecret: "test-secret"})
+
+	hash, err := service.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	auth.auth = &models.UserAuth{UserID: user.ID, Email: email, Password: hash, IsActive: true, MFAEnabled: true}
+
+	// Two wrong codes on an earlier challenge
+	service.registerLoginFailure(email, "", "", &user.ID, "invalid mfa code")
+	service.registerLoginFailure(email, "", "", &user.ID, "invalid mfa code")
+
+	response, err := service.Login(&models.LoginRequest{Email: email, Password: "correct horse battery"})
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if !response.MFARequired {
+		t.Fatal("Login() did not ask for the second factor")
+	}
+
+	if got := memory.counters[cache.LoginFailurePrefix+accountSubject(email)]; got != 2 {
+		t.Errorf("failure counter = %d after a password login, want 2", got)
+	}
+}
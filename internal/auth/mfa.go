@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// mfaChallenge returns a short-lived token that can only be exchanged for a
+// full session through VerifyMFA
+func (s *AuthService) mfaChallenge(user *models.User) (*models.AuthResponse, error) {
+	now := time.Now()
+	expirationTime := now.Add(mfaChallengeTTL)
+
+	claims := &models.Claims{
+		UserID:  user.ID,
+		Email:   user.Email,
+		Purpose: models.TokenPurposeMFAPending,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        primitive.NewObjectID().Hex(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+		},
+	}
+
+	token, err := s.keys.sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresAt:   expirationTime,
+	}, nil
+}
+
+// VerifyMFA completes a login that is waiting for a TOTP or recovery code
+func (s *AuthService) VerifyMFA(request *models.MFAVerifyRequest) (*models.AuthResponse, error) {
+	claims, err := s.parseToken(request.MFAToken)
+	if err != nil || claims.Purpose != models.TokenPurposeMFAPending {
+		return nil, fmt.Errorf("invalid mfa token")
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	if err := s.checkLoginAllowed(claims.Email, request.IPAddress); err != nil {
+		return nil, err
+	}
+
+	// Challenges are single-use
+	revoked, err := s.IsTokenRevoked(claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, fmt.Errorf("invalid mfa token")
+	}
+
+	auth, err := s.authRepo.GetByUserID(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !auth.IsActive {
+		return nil, fmt.Errorf("account is deactivated")
+	}
+
+	ok, err := s.checkSecondFactor(auth, request.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		s.registerLoginFailure(auth.Email, request.IPAddress, request.UserAgent, &auth.UserID, "invalid mfa code")
+		return nil, fmt.Errorf("invalid mfa code")
+	}
+
+	if err := s.RevokeToken(claims); err != nil {
+		return nil, err
+	}
+
+	s.resetLoginFailures(auth.Email)
+	s.recordLoginEvent(&models.LoginEvent{
+		UserID:    &auth.UserID,
+		Email:     auth.Email,
+		Event:     models.LoginEventSuccess,
+		Reason:    "mfa verified",
+		IPAddress: request.IPAddress,
+		UserAgent: request.UserAgent,
+	})
+
+	user, err := s.userRepo.GetByID(auth.UserID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.roleRepo.GetByID(auth.RoleID)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.startSession(user.ID, true, request.IPAddress, request.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user, role, session.ID, primitive.NilObjectID, true)
+}
+
+// EnrollMFA generates a new TOTP secret for the user. It only takes effect
+// after ConfirmMFA, so a half-finished enrollment never locks anyone out.
+func (s *AuthService) EnrollMFA(userID primitive.ObjectID, password string) (*models.MFAEnrollResponse, error) {
+	auth, err := s.authRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.CheckPasswordHash(password, auth.Password) {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+
+	if auth.MFAEnabled {
+		return nil, fmt.Errorf("mfa is already enabled")
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := encryptSecret(s.mfaKey, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authRepo.SetMFASecret(userID, encrypted); err != nil {
+		return nil, err
+	}
+
+	return &models.MFAEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: totpURI(s.config.MFAIssuer, auth.Email, secret),
+	}, nil
+}
+
+// ConfirmMFA enables MFA once the user proves their app produces valid codes
+// and returns the one-time recovery codes
+func (s *AuthService) ConfirmMFA(userID primitive.ObjectID, code string) ([]string, error) {
+	auth, err := s.authRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if auth.MFAEnabled {
+		return nil, fmt.Errorf("mfa is already enabled")
+	}
+
+	if auth.MFASecret == "" {
+		return nil, fmt.Errorf("mfa enrollment not started")
+	}
+
+	ok, err := s.checkTOTP(auth, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid mfa code")
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authRepo.EnableMFA(userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableMFA turns MFA off after checking both the password and a second factor
+func (s *AuthService) DisableMFA(userID primitive.ObjectID, password, code string) error {
+	auth, err := s.authRepo.GetByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	if !auth.MFAEnabled {
+		return fmt.Errorf("mfa is not enabled")
+	}
+
+	if !s.CheckPasswordHash(password, auth.Password) {
+		return fmt.Errorf("invalid credentials")
+	}
+
+	ok, err := s.checkSecondFactor(auth, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("invalid mfa code")
+	}
+
+	return s.authRepo.DisableMFA(userID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the user
+func (s *AuthService) RegenerateRecoveryCodes(userID primitive.ObjectID, code string) ([]string, error) {
+	auth, err := s.authRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !auth.MFAEnabled {
+		return nil, fmt.Errorf("mfa is not enabled")
+	}
+
+	ok, err := s.checkTOTP(auth, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid mfa code")
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authRepo.SetRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// RoleRequiresMFA reports whether tokens for the role must have passed MFA
+func (s *AuthService) RoleRequiresMFA(roleID primitive.ObjectID) (bool, error) {
+	role, err := s.cachedRoleFor(roleID)
+	if err != nil {
+		return false, err
+	}
+
+	return role.RequireMFA, nil
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code
+func (s *AuthService) checkSecondFactor(auth *models.UserAuth, code string) (bool, error) {
+	ok, err := s.checkTOTP(auth, code)
+	if err != nil || ok {
+		return ok, err
+	}
+
+	return s.authRepo.UseRecoveryCode(auth.UserID, hashToken(normalizeRecoveryCode(code)))
+}
+
+// checkTOTP validates a TOTP code and rejects codes that were already used
+func (s *AuthService) checkTOTP(auth *models.UserAuth, code string) (bool, error) {
+	if auth.MFASecret == "" {
+		return false, nil
+	}
+
+	secret, err := decryptSecret(s.mfaKey, auth.MFASecret)
+	if err != nil {
+		return false, err
+	}
+
+	counter, ok := validateTOTP(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	// Claim the step in one call so two requests can't both use the code.
+	// It is remembered for as long as it can still validate.
+	usedKey := fmt.Sprintf("%s%s:%d", cache.MFAUsedCodePrefix, auth.UserID.Hex(), counter)
+	ttl := time.Duration((2*totpSkew+1)*totpPeriod) * time.Second
+	claimed, err := s.cache.SetNX(usedKey, true, ttl)
+	if err != nil {
+		return false, err
+	}
+
+	return claimed, nil
+}
+
+// generateRecoveryCodes returns the plain codes for the user and their hashes for storage
+func generateRecoveryCodes() ([]string, []string, error) {
+	const charset = "abcdefghjkmnpqrstuvwxyz23456789"
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 10)
+		for j := range raw {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+			if err != nil {
+				return nil, nil, err
+			}
+			raw[j] = charset[n.Int64()]
+		}
+
+		codes[i] = string(raw[:5]) + "-" + string(raw[5:])
+		hashes[i] = hashToken(string(raw))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
@@ -5,10 +5,14 @@ import (
 	"strings"
 
 	"github.com/labstack/echo/v4"
+	"github.com/madhiyono/base-api-nosql/internal/models"
 	"github.com/madhiyono/base-api-nosql/pkg/response"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// APIKeyHeader carries a personal API key
+const APIKeyHeader = "X-API-Key"
+
 type Middleware struct {
 	authService *AuthService
 }
@@ -19,10 +23,14 @@ func NewMiddleware(authService *AuthService) *Middleware {
 	}
 }
 
-// JWTAuth middleware for authentication
+// JWTAuth middleware for authentication. Requests without a bearer token may
+// authenticate with an API key in the X-API-Key header instead.
 func (m *Middleware) JWTAuth(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		authHeader := c.Request().Header.Get("Authorization")
+		if authHeader == "" && c.Request().Header.Get(APIKeyHeader) != "" {
+			return m.apiKeyAuth(next, c)
+		}
 		if authHeader == "" {
 			return response.Error(c, http.StatusUnauthorized, "Missing Authorization Token", nil)
 		}
@@ -41,40 +49,119 @@ func (m *Middleware) JWTAuth(next echo.HandlerFunc) echo.HandlerFunc {
 			return response.Error(c, http.StatusUnauthorized, "Invalid or Expired Token", nil)
 		}
 
+		// Reject tokens that were logged out or revoked by an admin
+		revoked, err := m.authService.IsTokenRevoked(claims)
+		if err != nil {
+			return response.InternalServerError(c, "Failed to Validate Token", nil)
+		}
+		if revoked {
+			return response.Error(c, http.StatusUnauthorized, "Invalid or Expired Token", nil)
+		}
+
 		// Store user info in context
 		c.Set("user_id", claims.UserID)
 		c.Set("email", claims.Email)
 		c.Set("role_id", claims.RoleID)
+		c.Set("tenant_id", claims.TenantID)
+		c.Set("token_id", claims.ID)
+		c.Set("session_id", claims.SessionID)
+		c.Set("claims", claims)
+
+		m.authService.TouchSession(claims.SessionID)
+
+		if claims.Actor != nil {
+			c.Set("actor_id", claims.Actor.UserID)
+			return m.auditImpersonation(next, c, claims)
+		}
 
 		return next(c)
 	}
 }
 
-// RequirePermission middleware for permission-based authorization
-func (m *Middleware) RequirePermission(resource, action string) echo.MiddlewareFunc {
-	return func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			roleID, ok := c.Get("role_id").(primitive.ObjectID)
-			if !ok {
-				return response.Error(c, http.StatusForbidden, "Invalid Role", nil)
-			}
+// auditImpersonation runs the request and records it with both identities
+func (m *Middleware) auditImpersonation(next echo.HandlerFunc, c echo.Context, claims *models.Claims) error {
+	err := next(c)
 
-			// Check if user has required permission
-			hasPermission, err := m.authService.HasPermission(roleID, resource, action)
-			if err != nil {
-				return response.InternalServerError(c, "Failed to Check Permissions", err)
-			}
+	status := c.Response().Status
+	if httpErr, ok := err.(*echo.HTTPError); ok {
+		status = httpErr.Code
+	}
 
-			if !hasPermission {
-				return response.Error(c, http.StatusForbidden, "Insufficient Permissions", nil)
-			}
+	m.authService.RecordAudit(&models.AuditLog{
+		ActorID:   claims.Actor.UserID,
+		SubjectID: claims.UserID,
+		Action:    models.AuditActionImpersonatedRequest,
+		Method:    c.Request().Method,
+		Path:      c.Request().URL.Path,
+		Status:    status,
+		TokenID:   claims.ID,
+		IPAddress: c.RealIP(),
+	})
+
+	return err
+}
 
-			return next(c)
+// DenyImpersonation middleware rejects requests made with an impersonation token
+func (m *Middleware) DenyImpersonation(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if claims, ok := c.Get("claims").(*models.Claims); ok && claims.Actor != nil {
+			return response.Error(c, http.StatusForbidden, "Not Allowed While Impersonating", nil)
 		}
+		return next(c)
 	}
 }
 
-// RequireAdmin middleware for admin-only access
+// DenyTenant middleware rejects requests made within an organization, for
+// platform-wide administration
+func (m *Middleware) DenyTenant(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if tenantID, ok := c.Get("tenant_id").(primitive.ObjectID); ok && !tenantID.IsZero() {
+			return response.Error(c, http.StatusForbidden, "Not Allowed Within an Organization", nil)
+		}
+		return next(c)
+	}
+}
+
+// TenantID returns the organization the request acts in, zero for the default scope
+func TenantID(c echo.Context) primitive.ObjectID {
+	tenantID, _ := c.Get("tenant_id").(primitive.ObjectID)
+	return tenantID
+}
+
+// apiKeyAuth authenticates the request with an API key and sets the same
+// context values as a token, plus the key itself
+func (m *Middleware) apiKeyAuth(next echo.HandlerFunc, c echo.Context) error {
+	apiKey, auth, err := m.authService.ValidateAPIKey(c.Request().Header.Get(APIKeyHeader))
+	if err != nil {
+		return response.Error(c, http.StatusUnauthorized, "Invalid or Expired API Key", nil)
+	}
+
+	c.Set("user_id", auth.UserID)
+	c.Set("email", auth.Email)
+	c.Set("role_id", auth.RoleID)
+	c.Set("tenant_id", primitive.NilObjectID) // API keys act in the default scope
+	c.Set("api_key", apiKey)
+
+	return next(c)
+}
+
+// DenyAPIKey middleware rejects requests authenticated with an API key
+func (m *Middleware) DenyAPIKey(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if _, ok := c.Get("api_key").(*models.APIKey); ok {
+			return response.Error(c, http.StatusForbidden, "API Keys Cannot Access This Resource", nil)
+		}
+		return next(c)
+	}
+}
+
+// RequirePermission middleware for permission-based authorization
+func (m *Middleware) RequirePermission(resource, action string) echo.MiddlewareFunc {
+	return m.Authorize(Allow(resource, action))
+}
+
+// RequireAdmin middleware for admin-only access. API keys are never enough:
+// administration needs a token from a session that passed MFA.
 func (m *Middleware) RequireAdmin() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -82,18 +169,75 @@ func (m *Middleware) RequireAdmin() echo.MiddlewareFunc {
 			if !ok {
 				return response.Error(c, http.StatusForbidden, "Invalid Role", nil)
 			}
+			if _, ok := c.Get("api_key").(*models.APIKey); ok {
+				return response.Error(c, http.StatusForbidden, "API Keys Cannot Access Admin Routes", nil)
+			}
 
 			// Check if user has admin permissions (can manage roles)
-			hasPermission, err := m.authService.HasPermission(roleID, "roles", "create")
+			permissions, err := m.authService.principalPermissions(principal(c, roleID), "")
 			if err != nil {
 				return response.InternalServerError(c, "Failed to Check Admin Permissions", err)
 			}
 
-			if !hasPermission {
+			if !managesRoles(permissions) {
 				return response.Error(c, http.StatusForbidden, "Admin Access Required", nil)
 			}
 
+			if ok, err := m.mfaSatisfied(c, roleID); err != nil {
+				return response.InternalServerError(c, "Failed to Check Admin Permissions", err)
+			} else if !ok {
+				return response.Error(c, http.StatusForbidden, "Multi-Factor Authentication Required", nil)
+			}
+
 			return next(c)
 		}
 	}
 }
+
+// apiKeyAllows limits API key requests to the permissions granted to the key
+func apiKeyAllows(c echo.Context, resource, action string) bool {
+	apiKey, ok := c.Get("api_key").(*models.APIKey)
+	if !ok {
+		return true
+	}
+	return apiKey.Allows(resource, action)
+}
+
+// hasMFA reports whether the request's token or API key was issued after
+// multi-factor authentication
+func hasMFA(c echo.Context) bool {
+	if claims, ok := c.Get("claims").(*models.Claims); ok && claims.MFA {
+		return true
+	}
+	// Keys from before MFA keys were given an expiry don't count
+	if apiKey, ok := c.Get("api_key").(*models.APIKey); ok && apiKey.MFA && apiKey.ExpiresAt != nil {
+		return true
+	}
+	return false
+}
+
+// principal describes the caller for permission checks
+func principal(c echo.Context, roleID primitive.ObjectID) Principal {
+	userID, _ := c.Get("user_id").(primitive.ObjectID)
+	return Principal{
+		UserID:   userID,
+		RoleID:   roleID,
+		TenantID: TenantID(c),
+		MFA:      hasMFA(c),
+	}
+}
+
+// mfaSatisfied reports whether the token meets the role's MFA requirement,
+// which admin roles always have
+func (m *Middleware) mfaSatisfied(c echo.Context, roleID primitive.ObjectID) (bool, error) {
+	if hasMFA(c) {
+		return true, nil
+	}
+
+	requiresMFA, err := m.authService.RoleRequiresMFA(roleID)
+	if err != nil {
+		return false, err
+	}
+
+	return !requiresMFA, nil
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// adminCheckCache never holds anything, so every check reads the repositories
+type adminCheckCache struct {
+	cache.Cache
+}
+
+func (adminCheckCache) Get(key string, dest any) error { return redis.Nil }
+
+func (adminCheckCache) Set(key string, value any, expiration time.Duration) error { return nil }
+
+func (adminCheckCache) SetWithTags(key string, value any, tags []string, expiration time.Duration) error {
+	return nil
+}
+
+type adminCheckRoleRepository struct {
+	repository.RoleRepository
+	role *models.Role
+}
+
+func (r *adminCheckRoleRepository) GetByID(id primitive.ObjectID) (*models.Role, error) {
+	return r.role, nil
+}
+
+type adminCheckGrantRepository struct {
+	repository.RoleGrantRepository
+}
+
+func (adminCheckGrantRepository) ListUnexpiredByUserID(userID primitive.ObjectID, now time.Time) ([]*models.RoleGrant, error) {
+	return nil, nil
+}
+
+func TestRequireAdmin(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name        string
+		permissions []models.Permission
+		mfa         bool
+		apiKey      *models.APIKey
+		want        int
+	}{
+		{"admin with mfa", []models.Permission{models.NewPermission("*", "*")}, true, nil, http.StatusOK},
+		{"admin role without the mfa flag still needs mfa", []models.Permission{models.NewPermission("*", "*")}, false, nil, http.StatusForbidden},
+		{"role manager without mfa", []models.Permission{models.NewPermission(models.ResourceRoles, models.ActionCreate)}, false, nil, http.StatusForbidden},
+		{"role deleter with mfa", []models.Permission{models.NewPermission(models.ResourceRoles, models.ActionDelete)}, true, nil, http.StatusOK},
+		{
+			"api key created after mfa",
+			[]models.Permission{models.NewPermission("*", "*")}, false,
+			&models.APIKey{MFA: true, ExpiresAt: &expiresAt, Permissions: []models.Permission{models.NewPermission("*", "*")}},
+			http.StatusForbidden,
+		},
+		{"not an admin", []models.Permission{models.NewPermission("users", "read")}, true, nil, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role := &models.Role{ID: primitive.NewObjectID(), IsActive: true, Permissions: tt.permissions}
+			service := NewAuthService(Repositories{
+				Roles:      &adminCheckRoleRepository{role: role},
+				RoleGrants: adminCheckGrantRepository{},
+			}, adminCheckCache{}, AuthConfig{JWTSecret: "test-secret"})
+			userID := primitive.NewObjectID()
+
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/admin", nil), rec)
+			c.Set("user_id", userID)
+			c.Set("role_id", role.ID)
+			if tt.apiKey != nil {
+				c.Set("api_key", tt.apiKey)
+			} else {
+				c.Set("claims", &models.Claims{UserID: userID, RoleID: role.ID, MFA: tt.mfa})
+			}
+
+			handler := NewMiddleware(service).RequireAdmin()(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+			if err := handler(c); err != nil {
+				t.Fatalf("handler error = %v", err)
+			}
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasMFA(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		claims *models.Claims
+		apiKey *models.APIKey
+		want   bool
+	}{
+		{"token after mfa", &models.Claims{MFA: true}, nil, true},
+		{"token without mfa", &models.Claims{}, nil, false},
+		{"api key after mfa", nil, &models.APIKey{MFA: true, ExpiresAt: &expiresAt}, true},
+		{"api key after mfa without expiry", nil, &models.APIKey{MFA: true}, false},
+		{"api key without mfa", nil, &models.APIKey{ExpiresAt: &expiresAt}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+			if tt.claims != nil {
+				c.Set("claims", tt.claims)
+			}
+			if tt.apiKey != nil {
+				c.Set("api_key", tt.apiKey)
+			}
+			if got := hasMFA(c); got != tt.want {
+				t.Errorf("hasMFA() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,400 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+)
+
+const (
+	// OAuthStateTTL is how long a started login can be completed
+	OAuthStateTTL = 10 * time.Minute
+	// OAuthStateCookie holds the signed state binding a login to the browser
+	// that started it
+	OAuthStateCookie = "oauth_state"
+)
+
+// ErrOAuthStateMismatch is returned when the callback's state wasn't issued
+// to the browser completing the login
+var ErrOAuthStateMismatch = errors.New("oauth state does not match this browser")
+
+// OAuthProviderConfig describes an OAuth2/OIDC identity provider. When
+// IssuerURL is set, missing endpoints are read from its discovery document,
+// so any OIDC provider (including a local mock server) only needs an issuer.
+type OAuthProviderConfig struct {
+	ClientID     string
+	ClientSecret string
+	IssuerURL    string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	RedirectURL  string
+	Scopes       []string
+	// TrustEmail treats the provider's email as verified even without an
+	// email_verified claim (e.g. GitHub, which only exposes verified emails)
+	TrustEmail bool
+}
+
+// Known providers only need client credentials and a redirect URL
+var oauthPresets = map[string]OAuthProviderConfig{
+	"google": {
+		IssuerURL: "https://accounts.google.com",
+		Scopes:    []string{"openid", "email", "profile"},
+	},
+	"github": {
+		AuthURL:     "https://github.com/login/oauth/authorize",
+		TokenURL:    "https://github.com/login/oauth/access_token",
+		UserInfoURL: "https://api.github.com/user",
+		Scopes:      []string{"read:user", "user:email"},
+		TrustEmail:  true,
+	},
+}
+
+type oauthProvider struct {
+	name       string
+	config     OAuthProviderConfig
+	mutex      sync.Mutex
+	discovered bool
+}
+
+// oauthState is kept in the cache between the redirect and the callback
+type oauthState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+type OAuthService struct {
+	providers  map[string]*oauthProvider
+	cache      cache.Cache
+	httpClient *http.Client
+	// stateKey signs the state cookie
+	stateKey []byte
+}
+
+func NewOAuthService(providers map[string]OAuthProviderConfig, cache cache.Cache, secret string) *OAuthService {
+	service := &OAuthService{
+		providers:  make(map[string]*oauthProvider),
+		cache:      cache,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		stateKey:   []byte("oauth-state:" + secret),
+	}
+
+	for name, config := range providers {
+		if preset, ok := oauthPresets[name]; ok {
+			config = withPreset(config, preset)
+		}
+		service.providers[name] = &oauthProvider{name: name, config: config}
+	}
+
+	return service
+}
+
+// Providers returns the names of the configured providers
+func (s *OAuthService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AuthCodeURL starts a login: it stores a state and PKCE verifier and returns
+// the provider URL to redirect the user to, and the signed state to set in
+// the OAuthStateCookie cookie. Exchange refuses a callback whose state
+// doesn't match that cookie, so an attacker can't finish a login they
+// started in the victim's browser (login CSRF).
+func (s *OAuthService) AuthCodeURL(providerName string) (string, string, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomURLString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	verifier, err := randomURLString(64)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := s.cache.Set(cache.OAuthStatePrefix+state, oauthState{
+		Provider:     providerName,
+		CodeVerifier: verifier,
+	}, OAuthStateTTL); err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", provider.config.ClientID)
+	params.Set("redirect_uri", provider.config.RedirectURL)
+	params.Set("scope", strings.Join(provider.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(provider.config.AuthURL, "?") {
+		separator = "&"
+	}
+
+	return provider.config.AuthURL + separator + params.Encode(), s.signState(state), nil
+}
+
+// Exchange finishes a login: it checks the state against the signed state
+// from the browser's cookie, redeems the code with the PKCE verifier and
+// fetches the user's profile
+func (s *OAuthService) Exchange(providerName, state, signedState, code string) (*models.OAuthProfile, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	if state == "" || code == "" {
+		return nil, fmt.Errorf("missing state or code")
+	}
+	if !hmac.Equal([]byte(signedState), []byte(s.signState(state))) {
+		return nil, ErrOAuthStateMismatch
+	}
+
+	// States are single-use, reading one consumes it
+	var stored oauthState
+	if err := s.cache.GetDel(cache.OAuthStatePrefix+state, &stored); err != nil {
+		if cache.IsNotFound(err) {
+			return nil, fmt.Errorf("invalid or expired state")
+		}
+		return nil, err
+	}
+
+	if stored.Provider != providerName {
+		return nil, fmt.Errorf("state does not match provider")
+	}
+
+	accessToken, err := s.exchangeCode(provider, code, stored.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.fetchProfile(provider, accessToken)
+}
+
+// signState binds the state to the cookie; only this server can produce the
+// signature, so a cookie can't be forged for a state started elsewhere
+func (s *OAuthService) signState(state string) string {
+	mac := hmac.New(sha256.New, s.stateKey)
+	mac.Write([]byte(state))
+	return state + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *OAuthService) provider(name string) (*oauthProvider, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown oauth provider: %s", name)
+	}
+
+	// Discovery is retried until it succeeds once
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	if !provider.discovered {
+		if err := s.discover(provider); err != nil {
+			return nil, err
+		}
+		provider.discovered = true
+	}
+
+	return provider, nil
+}
+
+// discover fills missing endpoints from the issuer's OIDC discovery document
+func (s *OAuthService) discover(provider *oauthProvider) error {
+	config := &provider.config
+	if config.IssuerURL == "" || (config.AuthURL != "" && config.TokenURL != "" && config.UserInfoURL != "") {
+		return nil
+	}
+
+	discoveryURL := strings.TrimSuffix(config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	resp, err := s.httpClient.Get(discoveryURL)
+	if err != nil {
+		return fmt.Errorf("oidc discovery for %s failed: %w", provider.name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc discovery for %s failed: status %d", provider.name, resp.StatusCode)
+	}
+
+	var document struct {
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		return fmt.Errorf("oidc discovery for %s failed: %w", provider.name, err)
+	}
+
+	if config.AuthURL == "" {
+		config.AuthURL = document.AuthorizationEndpoint
+	}
+	if config.TokenURL == "" {
+		config.TokenURL = document.TokenEndpoint
+	}
+	if config.UserInfoURL == "" {
+		config.UserInfoURL = document.UserInfoEndpoint
+	}
+
+	return nil
+}
+
+func (s *OAuthService) exchangeCode(provider *oauthProvider, code, verifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.config.RedirectURL)
+	form.Set("client_id", provider.config.ClientID)
+	form.Set("client_secret", provider.config.ClientSecret)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequest(http.MethodPost, provider.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return "", fmt.Errorf("code exchange failed: %s %s", token.Error, token.ErrorDescription)
+	}
+
+	return token.AccessToken, nil
+}
+
+func (s *OAuthService) fetchProfile(provider *oauthProvider, accessToken string) (*models.OAuthProfile, error) {
+	req, err := http.NewRequest(http.MethodGet, provider.config.UserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo request failed: status %d", resp.StatusCode)
+	}
+
+	var claims map[string]any
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("invalid userinfo response: %w", err)
+	}
+
+	// OIDC providers use "sub", GitHub style APIs use a numeric "id"
+	subject := claimString(claims, "sub")
+	if subject == "" {
+		subject = claimString(claims, "id")
+	}
+	if subject == "" {
+		return nil, fmt.Errorf("userinfo response has no subject")
+	}
+
+	name := claimString(claims, "name")
+	if name == "" {
+		name = claimString(claims, "login")
+	}
+
+	emailVerified := provider.config.TrustEmail
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		emailVerified = verified
+	case string:
+		emailVerified, _ = strconv.ParseBool(verified)
+	}
+
+	return &models.OAuthProfile{
+		Provider:      provider.name,
+		Subject:       subject,
+		Email:         models.NormalizeEmail(claimString(claims, "email")),
+		EmailVerified: emailVerified,
+		Name:          name,
+	}, nil
+}
+
+func claimString(claims map[string]any, key string) string {
+	switch value := claims[key].(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	default:
+		return ""
+	}
+}
+
+func withPreset(config, preset OAuthProviderConfig) OAuthProviderConfig {
+	if config.IssuerURL == "" {
+		config.IssuerURL = preset.IssuerURL
+	}
+	if config.AuthURL == "" {
+		config.AuthURL = preset.AuthURL
+	}
+	if config.TokenURL == "" {
+		config.TokenURL = preset.TokenURL
+	}
+	if config.UserInfoURL == "" {
+		config.UserInfoURL = preset.UserInfoURL
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = preset.Scopes
+	}
+	if preset.TrustEmail {
+		config.TrustEmail = true
+	}
+	return config
+}
+
+func randomURLString(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
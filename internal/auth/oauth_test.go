@@ -0,0 +1,457 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// oauthStateCache keeps login states in memory. Nothing here expires.
+type oauthStateCache struct {
+	cache.Cache
+	values map[string][]byte
+}
+
+func newOAuthStateCache() *oauthStateCache {
+	return &oauthStateCache{values: map[string][]byte{}}
+}
+
+func (c *oauthStateCache) Set(key string, value any, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	c.values[key] = data
+	return nil
+}
+
+func (c *oauthStateCache) GetDel(key string, dest any) error {
+	data, ok := c.values[key]
+	if !ok {
+		return redis.Nil
+	}
+	delete(c.values, key)
+	return json.Unmarshal(data, dest)
+}
+
+type oauthIdentityRepository struct {
+	repository.IdentityRepository
+	identities []*models.Identity
+}
+
+func (r *oauthIdentityRepository) Create(identity *models.Identity) error {
+	identity.ID = primitive.NewObjectID()
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *oauthIdentityRepository) GetByProviderSubject(provider, subject string) (*models.Identity, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *oauthIdentityRepository) UpdateLastLogin(id primitive.ObjectID) error { return nil }
+
+// oauthAuthRepository holds credentials by user ID
+type oauthAuthRepository struct {
+	repository.AuthRepository
+	auths map[primitive.ObjectID]*models.UserAuth
+}
+
+func (r *oauthAuthRepository) Create(auth *models.UserAuth) error {
+	auth.ID = primitive.NewObjectID()
+	r.auths[auth.UserID] = auth
+	return nil
+}
+
+func (r *oauthAuthRepository) GetByUserID(userID primitive.ObjectID) (*models.UserAuth, error) {
+	auth, ok := r.auths[userID]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	copied := *auth
+	return &copied, nil
+}
+
+func (r *oauthAuthRepository) GetByEmail(email string) (*models.UserAuth, error) {
+	for _, auth := range r.auths {
+		if auth.Email == models.NormalizeEmail(email) {
+			copied := *auth
+			return &copied, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *oauthAuthRepository) ActivateUser(userID primitive.ObjectID) error {
+	r.auths[userID].IsActive = true
+	return nil
+}
+
+type oauthUserRepository struct {
+	repository.UserRepository
+	users map[primitive.ObjectID]*models.User
+}
+
+func (r *oauthUserRepository) Create(user *models.User) error {
+	user.ID = primitive.NewObjectID()
+	r.users[user.ID] = user
+	return nil
+}
+
+type oauthRoleRepository struct {
+	repository.RoleRepository
+	role *models.Role
+}
+
+func (r *oauthRoleRepository) GetByName(name string) (*models.Role, error) {
+	if name != r.role.Name {
+		return nil, mongo.ErrNoDocuments
+	}
+	return r.role, nil
+}
+
+// mockOIDCServer is a minimal OIDC provider. The token endpoint only accepts
+// a verifier matching the challenge of the last authorization request.
+type mockOIDCServer struct {
+	*httptest.Server
+	challenge string
+	claims    map[string]any
+}
+
+func newMockOIDCServer(t *testing.T) *mockOIDCServer {
+	t.Helper()
+
+	mock := &mockOIDCServer{claims: map[string]any{
+		"sub":            "subject-1",
+		"email":          "Jane@Example.com",
+		"email_verified": true,
+		"name":           "Jane",
+	}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"authorization_endpoint": mock.URL + "/authorize",
+			"token_endpoint":         mock.URL + "/token",
+			"userinfo_endpoint":      mock.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "good-code" ||
+			base64.RawURLEncoding.EncodeToString(verifier[:]) != mock.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "access-token"})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(mock.claims)
+	})
+
+	mock.Server = httptest.NewServer(mux)
+	t.Cleanup(mock.Close)
+	return mock
+}
+
+// start begins a login and records its PKCE challenge with the provider
+func (m *mockOIDCServer) start(t *testing.T, service *OAuthService, provider string) (state, signedState string) {
+	t.Helper()
+
+	authURL, signedState, err := service.AuthCodeURL(provider)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() returned invalid URL: %v", err)
+	}
+	m.challenge = parsed.Query().Get("code_challenge")
+	return parsed.Query().Get("state"), signedState
+}
+
+func TestOAuthDiscovery(t *testing.T) {
+	mock := newMockOIDCServer(t)
+
+	tests := []struct {
+		name     string
+		config   OAuthProviderConfig
+		wantAuth string
+		wantErr  bool
+	}{
+		{"issuer only", OAuthProviderConfig{IssuerURL: mock.URL}, mock.URL + "/authorize", false},
+		{"issuer with trailing slash", OAuthProviderConfig{IssuerURL: mock.URL + "/"}, mock.URL + "/authorize", false},
+		{
+			"configured endpoint wins",
+			OAuthProviderConfig{IssuerURL: mock.URL, AuthURL: "https://login.example.com/auth"},
+			"https://login.example.com/auth", false,
+		},
+		{"discovery fails", OAuthProviderConfig{IssuerURL: mock.URL + "/missing"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewOAuthService(map[string]OAuthProviderConfig{"mock": tt.config}, newOAuthStateCache(), "secret")
+
+			authURL, _, err := service.AuthCodeURL("mock")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AuthCodeURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !strings.HasPrefix(authURL, tt.wantAuth+"?") {
+				t.Errorf("AuthCodeURL() = %s, want endpoint %s", authURL, tt.wantAuth)
+			}
+
+			query, _ := url.Parse(authURL)
+			if method := query.Query().Get("code_challenge_method"); method != "S256" {
+				t.Errorf("code_challenge_method = %q, want S256", method)
+			}
+		})
+	}
+}
+
+func TestOAuthExchange(t *testing.T) {
+	tests := []struct {
+		name string
+		// tamper changes what the callback presents, given the started login
+		tamper  func(state, signedState, otherState, otherSigned string) (string, string, string)
+		replay  bool
+		pkce    func(challenge string) string
+		wantErr error
+		failed  bool
+	}{
+		{
+			name: "valid login",
+			tamper: func(state, signedState, _, _ string) (string, string, string) {
+				return state, signedState, "good-code"
+			},
+		},
+		{
+			name: "missing cookie",
+			tamper: func(state, _, _, _ string) (string, string, string) {
+				return state, "", "good-code"
+			},
+			wantErr: ErrOAuthStateMismatch,
+		},
+		{
+			name: "cookie from another login",
+			tamper: func(state, _, _, otherSigned string) (string, string, string) {
+				return state, otherSigned, "good-code"
+			},
+			wantErr: ErrOAuthStateMismatch,
+		},
+		{
+			name: "attacker state with victim cookie",
+			tamper: func(_, signedState, otherState, _ string) (string, string, string) {
+				return otherState, signedState, "good-code"
+			},
+			wantErr: ErrOAuthStateMismatch,
+		},
+		{
+			name: "forged signature",
+			tamper: func(state, _, _, _ string) (string, string, string) {
+				return state, state + ".forged", "good-code"
+			},
+			wantErr: ErrOAuthStateMismatch,
+		},
+		{
+			name: "state used twice",
+			tamper: func(state, signedState, _, _ string) (string, string, string) {
+				return state, signedState, "good-code"
+			},
+			replay: true,
+			failed: true,
+		},
+		{
+			name: "wrong code",
+			tamper: func(state, signedState, _, _ string) (string, string, string) {
+				return state, signedState, "bad-code"
+			},
+			failed: true,
+		},
+		{
+			name: "verifier does not match challenge",
+			tamper: func(state, signedState, _, _ string) (string, string, string) {
+				return state, signedState, "good-code"
+			},
+			pkce:   func(challenge string) string { return challenge + "x" },
+			failed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockOIDCServer(t)
+			service := NewOAuthService(map[string]OAuthProviderConfig{
+				"mock": {IssuerURL: mock.URL, ClientID: "client", RedirectURL: "https://app.example.com/callback"},
+			}, newOAuthStateCache(), "secret")
+
+			otherState, otherSigned := mock.start(t, service, "mock")
+			state, signedState := mock.start(t, service, "mock")
+			if tt.pkce != nil {
+				mock.challenge = tt.pkce(mock.challenge)
+			}
+
+			state, signedState, code := tt.tamper(state, signedState, otherState, otherSigned)
+			if tt.replay {
+				if _, err := service.Exchange("mock", state, signedState, code); err != nil {
+					t.Fatalf("first Exchange() error = %v", err)
+				}
+			}
+
+			profile, err := service.Exchange("mock", state, signedState, code)
+			if tt.wantErr != nil || tt.failed {
+				if err == nil {
+					t.Fatalf("Exchange() succeeded, want error")
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("Exchange() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+
+			want := models.OAuthProfile{
+				Provider:      "mock",
+				Subject:       "subject-1",
+				Email:         "jane@example.com",
+				EmailVerified: true,
+				Name:          "Jane",
+			}
+			if *profile != want {
+				t.Errorf("Exchange() = %+v, want %+v", *profile, want)
+			}
+		})
+	}
+}
+
+func TestResolveOAuthAccount(t *testing.T) {
+	tests := []struct {
+		name         string
+		profile      models.OAuthProfile
+		linked       bool // the subject is already linked to the existing account
+		pending      bool // the existing account is inactive
+		wantExisting bool
+		wantCreated  bool
+		wantErr      bool
+	}{
+		{
+			name:         "known identity",
+			profile:      models.OAuthProfile{Provider: "mock", Subject: "linked", Email: "other@example.com"},
+			linked:       true,
+			wantExisting: true,
+		},
+		{
+			name:    "known identity of a deactivated account",
+			profile: models.OAuthProfile{Provider: "mock", Subject: "linked", Email: "other@example.com"},
+			linked:  true,
+			pending: true,
+			wantErr: true,
+		},
+		{
+			name:         "verified email links existing account",
+			profile:      models.OAuthProfile{Provider: "mock", Subject: "new", Email: "jane@example.com", EmailVerified: true},
+			wantExisting: true,
+		},
+		{
+			name:         "verified email activates pending account",
+			profile:      models.OAuthProfile{Provider: "mock", Subject: "new", Email: "jane@example.com", EmailVerified: true},
+			pending:      true,
+			wantExisting: true,
+		},
+		{
+			name:    "unverified email is not linked",
+			profile: models.OAuthProfile{Provider: "mock", Subject: "new", Email: "jane@example.com"},
+			wantErr: true,
+		},
+		{
+			name:    "missing email",
+			profile: models.OAuthProfile{Provider: "mock", Subject: "new", EmailVerified: true},
+			wantErr: true,
+		},
+		{
+			name:        "new email creates account",
+			profile:     models.OAuthProfile{Provider: "mock", Subject: "new", Email: "new@example.com", EmailVerified: true, Name: "New"},
+			wantCreated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaultRole := &models.Role{ID: primitive.NewObjectID(), Name: models.DefaultRoleName, IsActive: true}
+			existing := primitive.NewObjectID()
+			auths := &oauthAuthRepository{auths: map[primitive.ObjectID]*models.UserAuth{
+				existing: {UserID: existing, Email: "jane@example.com", RoleID: defaultRole.ID, IsActive: !tt.pending},
+			}}
+			users := &oauthUserRepository{users: map[primitive.ObjectID]*models.User{}}
+			identityRepo := &oauthIdentityRepository{}
+			if tt.linked {
+				identityRepo.identities = append(identityRepo.identities, &models.Identity{
+					ID: primitive.NewObjectID(), UserID: existing, Provider: "mock", Subject: "linked",
+				})
+			}
+			identities := len(identityRepo.identities)
+			service := NewAuthService(Repositories{
+				Auth:       auths,
+				Users:      users,
+				Roles:      &oauthRoleRepository{role: defaultRole},
+				Identities: identityRepo,
+			}, nil, AuthConfig{JWTSecret: "test-secret"})
+
+			auth, err := service.resolveOAuthAccount(&tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveOAuthAccount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if len(identityRepo.identities) != identities {
+					t.Errorf("identity was linked after an error")
+				}
+				return
+			}
+
+			if got := auth.UserID == existing; got != tt.wantExisting {
+				t.Errorf("resolved existing account = %v, want %v", got, tt.wantExisting)
+			}
+			if !auths.auths[auth.UserID].IsActive {
+				t.Errorf("resolved account is not active")
+			}
+			if tt.wantCreated && (auth.RoleID != defaultRole.ID || users.users[auth.UserID] == nil) {
+				t.Errorf("created account = %+v, want a user with the default role", auth)
+			}
+
+			identity, err := identityRepo.GetByProviderSubject("mock", tt.profile.Subject)
+			if err != nil || identity.UserID != auth.UserID {
+				t.Errorf("identity %s is not linked to the resolved account", tt.profile.Subject)
+			}
+		})
+	}
+}
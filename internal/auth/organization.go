@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateOrganization creates an organization without members
+func (s *AuthService) CreateOrganization(creatorID primitive.ObjectID, request *models.CreateOrganizationRequest) (*models.Organization, error) {
+	organization := &models.Organization{
+		Name:      request.Name,
+		CreatedBy: creatorID,
+	}
+
+	if err := s.orgRepo.Create(organization); err != nil {
+		return nil, err
+	}
+
+	return organization, nil
+}
+
+// ListOrganizations returns every organization
+func (s *AuthService) ListOrganizations() ([]*models.Organization, error) {
+	return s.orgRepo.List()
+}
+
+// AddMember adds a user to an organization with one of the organization's
+// roles or a shared role. Adding an existing member changes their role.
+func (s *AuthService) AddMember(organizationID, userID, roleID primitive.ObjectID) (*models.Membership, error) {
+	if _, err := s.orgRepo.GetByID(organizationID); err != nil {
+		return nil, fmt.Errorf("organization not found")
+	}
+
+	if _, err := s.authRepo.GetByUserID(userID); err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	role, err := s.roleRepo.ForTenant(organizationID).GetByID(roleID)
+	if err != nil {
+		return nil, fmt.Errorf("role not found")
+	}
+	if !role.IsActive {
+		return nil, fmt.Errorf("role is inactive")
+	}
+
+	membership := &models.Membership{
+		OrganizationID: organizationID,
+		UserID:         userID,
+		RoleID:         roleID,
+	}
+	if err := s.memberRepo.Upsert(membership); err != nil {
+		return nil, err
+	}
+
+	if err := s.userRepo.AddOrganization(userID, organizationID); err != nil {
+		return nil, err
+	}
+
+	// Tokens for the organization carrying a previous role must be refreshed
+	if err := s.markRoleChanged(userID, organizationID, roleID.Hex()); err != nil {
+		return nil, err
+	}
+
+	return membership, nil
+}
+
+// RemoveMember removes a user from an organization and rejects their tokens for it
+func (s *AuthService) RemoveMember(organizationID, userID primitive.ObjectID) error {
+	if err := s.memberRepo.Delete(organizationID, userID); err != nil {
+		return fmt.Errorf("membership not found")
+	}
+
+	if err := s.userRepo.RemoveOrganization(userID, organizationID); err != nil {
+		return err
+	}
+
+	// No role matches an empty marker, so every token for the organization fails
+	return s.markRoleChanged(userID, organizationID, "")
+}
+
+// ListMembers returns an organization's memberships
+func (s *AuthService) ListMembers(organizationID primitive.ObjectID) ([]*models.Membership, error) {
+	if _, err := s.orgRepo.GetByID(organizationID); err != nil {
+		return nil, fmt.Errorf("organization not found")
+	}
+
+	return s.memberRepo.ListByOrganizationID(organizationID)
+}
+
+// ListUserOrganizations returns the organizations the user belongs to
+func (s *AuthService) ListUserOrganizations(userID primitive.ObjectID) ([]*models.UserOrganization, error) {
+	memberships, err := s.memberRepo.ListByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	organizations := make([]*models.UserOrganization, 0, len(memberships))
+	for _, membership := range memberships {
+		organization, err := s.orgRepo.GetByID(membership.OrganizationID)
+		if err != nil {
+			continue
+		}
+		organizations = append(organizations, &models.UserOrganization{
+			Organization: organization,
+			RoleID:       membership.RoleID,
+		})
+	}
+
+	return organizations, nil
+}
+
+// SwitchOrganization issues tokens for the same session acting in another
+// organization, or in the default scope for a zero organizationID. Later
+// refreshes of the session stay in that organization.
+func (s *AuthService) SwitchOrganization(claims *models.Claims, organizationID primitive.ObjectID) (*models.AuthResponse, error) {
+	sessionID, err := primitive.ObjectIDFromHex(claims.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("token is not bound to a session")
+	}
+
+	auth, err := s.authRepo.GetByUserID(claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	role, err := s.roleForTenant(auth, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(auth.UserID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sessionRepo.SetTenant(sessionID, organizationID); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user, role, sessionID, organizationID, claims.MFA)
+}
+
+// roleForTenant returns the user's role in the organization, or their
+// account role in the default scope
+func (s *AuthService) roleForTenant(auth *models.UserAuth, tenantID primitive.ObjectID) (*models.Role, error) {
+	roleID := auth.RoleID
+	if !tenantID.IsZero() {
+		membership, err := s.memberRepo.Get(tenantID, auth.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("not a member of the organization")
+		}
+		roleID = membership.RoleID
+	}
+
+	return s.roleRepo.GetByID(roleID)
+}
+
+// markRoleChanged makes tokens for the user in the tenant that don't carry
+// roleID fail until they expire. The marker outlives both access and
+// impersonation tokens.
+func (s *AuthService) markRoleChanged(userID, tenantID primitive.ObjectID, roleID string) error {
+	return s.cache.Set(roleChangedKey(userID, tenantID), roleID, max(s.config.AccessTokenTTL, impersonationTTL))
+}
+
+func roleChangedKey(userID, tenantID primitive.ObjectID) string {
+	key := cache.UserRoleChangedPrefix + userID.Hex()
+	if !tenantID.IsZero() {
+		key += ":" + tenantID.Hex()
+	}
+	return key
+}
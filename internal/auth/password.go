@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported password hashing algorithms
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+
+	// Bounds for argon2id parameters, both configured and read from stored
+	// hashes, so a corrupted hash can't make verification panic or exhaust
+	// memory
+	argon2MaxMemory     = 1024 * 1024 // KiB
+	argon2MaxIterations = 64
+	argon2MinSaltLength = 8
+	argon2MaxKeyLength  = 128
+)
+
+// passwordHasher hashes passwords in a self-describing format: argon2id hashes
+// use the PHC string format ($argon2id$v=19$m=...,t=...,p=...$salt$hash) and
+// bcrypt hashes carry their own cost. Stored hashes can therefore always be
+// verified, even after the configured algorithm or parameters change.
+type passwordHasher struct {
+	config PasswordHashingConfig
+}
+
+func (h *passwordHasher) hash(password string) (string, error) {
+	if h.config.Algorithm == HashBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.config.BcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.config.Argon2Iterations, h.config.Argon2Memory, h.config.Argon2Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.config.Argon2Memory,
+		h.config.Argon2Iterations,
+		h.config.Argon2Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *passwordHasher) verify(password, encoded string) bool {
+	if strings.HasPrefix(encoded, "$argon2id$") {
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false
+		}
+
+		candidate := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(candidate, key) == 1
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+}
+
+// needsRehash reports whether a stored hash uses another algorithm or
+// outdated parameters
+func (h *passwordHasher) needsRehash(encoded string) bool {
+	if strings.HasPrefix(encoded, "$argon2id$") {
+		if h.config.Algorithm != HashArgon2id {
+			return true
+		}
+
+		params, _, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return true
+		}
+
+		return params.memory != h.config.Argon2Memory ||
+			params.iterations != h.config.Argon2Iterations ||
+			params.parallelism != h.config.Argon2Parallelism ||
+			len(key) != argon2KeyLength
+	}
+
+	if h.config.Algorithm != HashBcrypt {
+		return true
+	}
+
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.config.BcryptCost
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func decodeArgon2id(encoded string) (*argon2Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return nil, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, nil, nil, err
+	}
+	if version != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	params := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := validateArgon2Params(params.memory, params.iterations, params.parallelism); err != nil {
+		return nil, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(salt) < argon2MinSaltLength {
+		return nil, nil, nil, fmt.Errorf("invalid argon2id salt")
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(key) == 0 || len(key) > argon2MaxKeyLength {
+		return nil, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	return params, salt, key, nil
+}
+
+// validateArgon2Params rejects parameters argon2 can't use, which make it
+// panic, or that are too expensive to compute on a request
+func validateArgon2Params(memory, iterations uint32, parallelism uint8) error {
+	if iterations == 0 || iterations > argon2MaxIterations {
+		return fmt.Errorf("argon2id iterations must be between 1 and %d", argon2MaxIterations)
+	}
+	if parallelism == 0 {
+		return fmt.Errorf("argon2id parallelism must be at least 1")
+	}
+	if memory < 8*uint32(parallelism) || memory > argon2MaxMemory {
+		return fmt.Errorf("argon2id memory must be between %d and %d KiB", 8*uint32(parallelism), argon2MaxMemory)
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// PasswordPolicyConfig describes the rules new passwords must satisfy
+type PasswordPolicyConfig struct {
+	MinLength        int
+	MaxLength        int
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	// AllowPersonalInfo permits passwords containing the user's name or email
+	AllowPersonalInfo bool
+	// BreachedPasswordsFile lists SHA-1 hashes of breached or common passwords,
+	// one uppercase or lowercase hex hash per line. An optional ":count" suffix
+	// (the Have I Been Pwned format) is ignored.
+	BreachedPasswordsFile string
+}
+
+const (
+	DefaultPasswordMinLength = 8
+	DefaultPasswordMaxLength = 128
+)
+
+// Password policy violation codes
+const (
+	PasswordTooShort         = "too_short"
+	PasswordTooLong          = "too_long"
+	PasswordMissingUppercase = "missing_uppercase"
+	PasswordMissingLowercase = "missing_lowercase"
+	PasswordMissingDigit     = "missing_digit"
+	PasswordMissingSymbol    = "missing_symbol"
+	PasswordContainsName     = "contains_name"
+	PasswordContainsEmail    = "contains_email"
+	PasswordBreached         = "breached"
+)
+
+// PasswordViolation is one reason a password was rejected
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a password failed
+type PasswordPolicyError struct {
+	Violations []PasswordViolation `json:"violations"`
+}
+
+func (e *PasswordPolicyError) Error() string {
+	codes := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		codes[i] = violation.Code
+	}
+	return "password does not meet the policy: " + strings.Join(codes, ", ")
+}
+
+// PasswordPolicy checks passwords against the configured rules and the
+// breached password list
+type PasswordPolicy struct {
+	config   PasswordPolicyConfig
+	breached [][sha1.Size]byte // sorted
+}
+
+// NewPasswordPolicy builds a policy and loads the breached password list, if any
+func NewPasswordPolicy(config PasswordPolicyConfig) (*PasswordPolicy, error) {
+	if config.MinLength <= 0 {
+		config.MinLength = DefaultPasswordMinLength
+	}
+	if config.MaxLength <= 0 {
+		config.MaxLength = DefaultPasswordMaxLength
+	}
+
+	policy := &PasswordPolicy{config: config}
+
+	if config.BreachedPasswordsFile != "" {
+		breached, err := loadBreachedPasswords(config.BreachedPasswordsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load breached passwords: %w", err)
+		}
+		policy.breached = breached
+	}
+
+	return policy, nil
+}
+
+func loadBreachedPasswords(filename string) ([][sha1.Size]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var hashes [][sha1.Size]byte
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if i := strings.IndexByte(text, ':'); i >= 0 {
+			text = text[:i]
+		}
+
+		var hash [sha1.Size]byte
+		if n, err := hex.Decode(hash[:], []byte(text)); err != nil || n != sha1.Size {
+			return nil, fmt.Errorf("line %d: invalid sha-1 hash", line)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// The file should already be sorted, but don't rely on it
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i][:], hashes[j][:]) < 0 })
+
+	return hashes, nil
+}
+
+// Check returns every rule the password breaks. name and email are the
+// account's, used to reject passwords built from personal information.
+func (p *PasswordPolicy) Check(password, name, email string) []PasswordViolation {
+	var violations []PasswordViolation
+	add := func(code, message string) {
+		violations = append(violations, PasswordViolation{Code: code, Message: message})
+	}
+
+	length := len([]rune(password))
+	if length < p.config.MinLength {
+		add(PasswordTooShort, fmt.Sprintf("Password must be at least %d characters long", p.config.MinLength))
+	}
+	if length > p.config.MaxLength {
+		add(PasswordTooLong, fmt.Sprintf("Password must be at most %d characters long", p.config.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.config.RequireUppercase && !hasUpper {
+		add(PasswordMissingUppercase, "Password must contain an uppercase letter")
+	}
+	if p.config.RequireLowercase && !hasLower {
+		add(PasswordMissingLowercase, "Password must contain a lowercase letter")
+	}
+	if p.config.RequireDigit && !hasDigit {
+		add(PasswordMissingDigit, "Password must contain a digit")
+	}
+	if p.config.RequireSymbol && !hasSymbol {
+		add(PasswordMissingSymbol, "Password must contain a symbol")
+	}
+
+	if !p.config.AllowPersonalInfo {
+		lower := strings.ToLower(password)
+		if containsNamePart(lower, name) {
+			add(PasswordContainsName, "Password must not contain your name")
+		}
+		if containsEmailPart(lower, email) {
+			add(PasswordContainsEmail, "Password must not contain your email address")
+		}
+	}
+
+	if p.isBreached(password) {
+		add(PasswordBreached, "Password appears in a list of breached or common passwords")
+	}
+
+	return violations
+}
+
+// Validate returns a *PasswordPolicyError when the password breaks any rule
+func (p *PasswordPolicy) Validate(password, name, email string) error {
+	if violations := p.Check(password, name, email); len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func (p *PasswordPolicy) isBreached(password string) bool {
+	if len(p.breached) == 0 {
+		return false
+	}
+
+	hash := sha1.Sum([]byte(password))
+	i := sort.Search(len(p.breached), func(i int) bool {
+		return bytes.Compare(p.breached[i][:], hash[:]) >= 0
+	})
+	return i < len(p.breached) && p.breached[i] == hash
+}
+
+// minPersonalInfoLength ignores short fragments like initials that would
+// reject too many unrelated passwords
+const minPersonalInfoLength = 3
+
+func containsNamePart(password, name string) bool {
+	for _, part := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(part)) >= minPersonalInfoLength && strings.Contains(password, part) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsEmailPart(password, email string) bool {
+	email = strings.ToLower(email)
+	if email == "" {
+		return false
+	}
+	if strings.Contains(password, email) {
+		return true
+	}
+
+	local := email
+	if i := strings.IndexByte(email, '@'); i >= 0 {
+		local = email[:i]
+	}
+	return containsNamePart(password, local)
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	strict := PasswordPolicyConfig{
+		MinLength:        10,
+		MaxLength:        20,
+		RequireUppercase: true,
+		RequireLowercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+	}
+
+	tests := []struct {
+		name     string
+		config   PasswordPolicyConfig
+		password string
+		userName string
+		email    string
+		want     []string
+	}{
+		{"defaults accept a long password", PasswordPolicyConfig{}, "correct horse", "", "", nil},
+		{"default minimum", PasswordPolicyConfig{}, "short", "", "", []string{PasswordTooShort}},
+		{"default maximum", PasswordPolicyConfig{}, strings.Repeat("a", DefaultPasswordMaxLength+1), "", "", []string{PasswordTooLong}},
+		{"length counts characters not bytes", PasswordPolicyConfig{}, "ääääääää", "", "", nil},
+		{"meets every rule", strict, "Correct-h0rse", "", "", nil},
+		{"missing uppercase", strict, "correct-h0rse", "", "", []string{PasswordMissingUppercase}},
+		{"missing lowercase", strict, "CORRECT-H0RSE", "", "", []string{PasswordMissingLowercase}},
+		{"missing digit", strict, "Correct-horse", "", "", []string{PasswordMissingDigit}},
+		{"missing symbol", strict, "CorrectH0rse", "", "", []string{PasswordMissingSymbol}},
+		{"space counts as a symbol", strict, "Correct h0rse", "", "", nil},
+		{
+			"every violation is reported", strict, "abc", "", "",
+			[]string{PasswordTooShort, PasswordMissingUppercase, PasswordMissingDigit, PasswordMissingSymbol},
+		},
+		{"contains name", PasswordPolicyConfig{}, "iloveJaneDoe", "Jane Doe", "", []string{PasswordContainsName}},
+		{"short name parts are ignored", PasswordPolicyConfig{}, "jo-the-password", "Jo Li", "", nil},
+		{"contains email", PasswordPolicyConfig{}, "x-jane@example.com", "", "Jane@Example.com", []string{PasswordContainsEmail}},
+		{"contains email local part", PasswordPolicyConfig{}, "password-jsmith", "", "jsmith@example.com", []string{PasswordContainsEmail}},
+		{"personal info allowed", PasswordPolicyConfig{AllowPersonalInfo: true}, "iloveJaneDoe", "Jane Doe", "jane@example.com", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewPasswordPolicy(tt.config)
+			if err != nil {
+				t.Fatalf("NewPasswordPolicy() error = %v", err)
+			}
+
+			var got []string
+			for _, violation := range policy.Check(tt.password, tt.userName, tt.email) {
+				got = append(got, violation.Code)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyBreached(t *testing.T) {
+	sha1Hex := func(password string) string {
+		sum := sha1.Sum([]byte(password))
+		return hex.EncodeToString(sum[:])
+	}
+
+	// Unsorted, mixed case, with comments and Have I Been Pwned counts
+	file := filepath.Join(t.TempDir(), "breached.txt")
+	lines := []string{
+		"# breached passwords",
+		strings.ToUpper(sha1Hex("password123")) + ":2254650",
+		"",
+		sha1Hex("letmein-please"),
+	}
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := NewPasswordPolicy(PasswordPolicyConfig{BreachedPasswordsFile: file})
+	if err != nil {
+		t.Fatalf("NewPasswordPolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"listed with a count", "password123", true},
+		{"listed without a count", "letmein-please", true},
+		{"not listed", "correct horse battery", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.password, "", "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var policyErr *PasswordPolicyError
+			if tt.wantErr && (!errors.As(err, &policyErr) || policyErr.Violations[0].Code != PasswordBreached) {
+				t.Errorf("Validate() error = %v, want a %s violation", err, PasswordBreached)
+			}
+		})
+	}
+}
+
+func TestNewPasswordPolicyInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.txt")
+	if err := os.WriteFile(invalid, []byte("not-a-hash\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"missing file", filepath.Join(dir, "missing.txt")},
+		{"invalid hash", invalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewPasswordPolicy(PasswordPolicyConfig{BreachedPasswordsFile: tt.file}); err == nil {
+				t.Errorf("NewPasswordPolicy() succeeded, want error")
+			}
+		})
+	}
+}
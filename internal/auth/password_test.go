@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters keep the tests fast
+var (
+	testArgon2 = PasswordHashingConfig{Algorithm: HashArgon2id, BcryptCost: bcrypt.MinCost, Argon2Memory: 64, Argon2Iterations: 1, Argon2Parallelism: 1}
+	testBcrypt = PasswordHashingConfig{Algorithm: HashBcrypt, BcryptCost: bcrypt.MinCost, Argon2Memory: 64, Argon2Iterations: 1, Argon2Parallelism: 1}
+)
+
+func TestPasswordHasherVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   PasswordHashingConfig
+		password string
+		attempt  string
+		want     bool
+	}{
+		{"argon2id correct", testArgon2, "correct horse", "correct horse", true},
+		{"argon2id wrong", testArgon2, "correct horse", "wrong horse", false},
+		{"argon2id empty attempt", testArgon2, "correct horse", "", false},
+		{"bcrypt correct", testBcrypt, "correct horse", "correct horse", true},
+		{"bcrypt wrong", testBcrypt, "correct horse", "wrong horse", false},
+		{"unicode", testArgon2, "pässwörd ✓", "pässwörd ✓", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hasher := &passwordHasher{config: tt.config}
+			encoded, err := hasher.hash(tt.password)
+			if err != nil {
+				t.Fatalf("hash() error = %v", err)
+			}
+			if got := hasher.verify(tt.attempt, encoded); got != tt.want {
+				t.Errorf("verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordHasherSaltsHashes(t *testing.T) {
+	hasher := &passwordHasher{config: testArgon2}
+	first, _ := hasher.hash("password")
+	second, _ := hasher.hash("password")
+	if first == second {
+		t.Errorf("hash() returned the same hash twice")
+	}
+}
+
+func TestPasswordHasherVerifiesOtherAlgorithms(t *testing.T) {
+	tests := []struct {
+		name     string
+		hashWith PasswordHashingConfig
+		config   PasswordHashingConfig
+	}{
+		{"bcrypt hash with argon2id configured", testBcrypt, testArgon2},
+		{"argon2id hash with bcrypt configured", testArgon2, testBcrypt},
+		{"argon2id hash with other parameters", testArgon2, PasswordHashingConfig{Algorithm: HashArgon2id, Argon2Memory: 128, Argon2Iterations: 2, Argon2Parallelism: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := (&passwordHasher{config: tt.hashWith}).hash("password")
+			if err != nil {
+				t.Fatalf("hash() error = %v", err)
+			}
+			if !(&passwordHasher{config: tt.config}).verify("password", encoded) {
+				t.Errorf("verify() = false, want true")
+			}
+		})
+	}
+}
+
+func TestPasswordHasherNeedsRehash(t *testing.T) {
+	higherCost := testBcrypt
+	higherCost.BcryptCost = bcrypt.MinCost + 1
+	moreMemory := testArgon2
+	moreMemory.Argon2Memory = 128
+	moreIterations := testArgon2
+	moreIterations.Argon2Iterations = 2
+	moreThreads := testArgon2
+	moreThreads.Argon2Parallelism = 2
+
+	tests := []struct {
+		name     string
+		hashWith PasswordHashingConfig
+		config   PasswordHashingConfig
+		want     bool
+	}{
+		{"argon2id current", testArgon2, testArgon2, false},
+		{"bcrypt current", testBcrypt, testBcrypt, false},
+		{"bcrypt to argon2id", testBcrypt, testArgon2, true},
+		{"argon2id to bcrypt", testArgon2, testBcrypt, true},
+		{"bcrypt cost raised", testBcrypt, higherCost, true},
+		{"argon2id memory raised", testArgon2, moreMemory, true},
+		{"argon2id iterations raised", testArgon2, moreIterations, true},
+		{"argon2id parallelism raised", testArgon2, moreThreads, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := (&passwordHasher{config: tt.hashWith}).hash("password")
+			if err != nil {
+				t.Fatalf("hash() error = %v", err)
+			}
+			if got := (&passwordHasher{config: tt.config}).needsRehash(encoded); got != tt.want {
+				t.Errorf("needsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeArgon2id(t *testing.T) {
+	const salt = "c29tZXNhbHRzb21lc2FsdA"
+	const key = "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{"valid", "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$" + key, false},
+		{"missing part", "$argon2id$v=19$m=64,t=1,p=1$" + salt, true},
+		{"other version", "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key, true},
+		{"zero memory", "$argon2id$v=19$m=0,t=1,p=1$" + salt + "$" + key, true},
+		{"zero iterations", "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key, true},
+		{"zero parallelism", "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key, true},
+		{"memory below 8 per thread", "$argon2id$v=19$m=8,t=1,p=4$" + salt + "$" + key, true},
+		{"huge memory", "$argon2id$v=19$m=4294967295,t=1,p=1$" + salt + "$" + key, true},
+		{"huge iterations", "$argon2id$v=19$m=64,t=100000,p=1$" + salt + "$" + key, true},
+		{"short salt", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$" + key, true},
+		{"empty key", "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$", true},
+		{"long key", "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$" + strings.Repeat("a2V5", 60), true},
+		{"bad base64", "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$!!!", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := decodeArgon2id(tt.encoded)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decodeArgon2id() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// A hash that can't be decoded never verifies and is replaced
+			hasher := &passwordHasher{config: testArgon2}
+			if tt.wantErr && hasher.verify("password", tt.encoded) {
+				t.Errorf("verify() accepted an invalid hash")
+			}
+		})
+	}
+}
+
+func TestPasswordHashingConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  PasswordHashingConfig
+		wantErr bool
+	}{
+		{"defaults", PasswordHashingConfig{}, false},
+		{"recommended", DefaultPasswordHashing, false},
+		{"bcrypt", PasswordHashingConfig{Algorithm: HashBcrypt}, false},
+		{"unknown algorithm", PasswordHashingConfig{Algorithm: "scrypt"}, true},
+		{"misspelled algorithm", PasswordHashingConfig{Algorithm: "argon2"}, true},
+		{"bcrypt cost too low", PasswordHashingConfig{Algorithm: HashBcrypt, BcryptCost: bcrypt.MinCost - 1}, true},
+		{"bcrypt cost too high", PasswordHashingConfig{Algorithm: HashBcrypt, BcryptCost: bcrypt.MaxCost + 1}, true},
+		{"argon2id memory too high", PasswordHashingConfig{Argon2Memory: argon2MaxMemory + 1}, true},
+		{"argon2id memory below 8 per thread", PasswordHashingConfig{Argon2Memory: 8, Argon2Parallelism: 2}, true},
+		{"argon2id iterations too high", PasswordHashingConfig{Argon2Iterations: argon2MaxIterations + 1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
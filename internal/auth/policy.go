@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/pkg/response"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OwnerResolver returns the ID of the user who owns the resource a request targets
+type OwnerResolver func(c echo.Context) (primitive.ObjectID, error)
+
+// ScopeResolver returns the ID of the resource a request targets, which
+// role grants scoped to one resource are matched against
+type ScopeResolver func(c echo.Context) string
+
+// Policy allows an action on a resource to callers whose role or active role
+// grants give the permission and, when Owner is set, to the owner of the
+// targeted resource unless their permissions deny the action
+type Policy struct {
+	Resource string
+	Action   string
+	Owner    OwnerResolver
+	Scope    ScopeResolver
+}
+
+// Allow builds a policy that requires the permission and adds the
+// permission to the catalog roles are validated against
+func Allow(resource, action string) Policy {
+	RegisterPermission(resource, action)
+	return Policy{Resource: resource, Action: action}
+}
+
+// OrOwner also lets the resource owner through
+func (p Policy) OrOwner(owner OwnerResolver) Policy {
+	p.Owner = owner
+	return p
+}
+
+// WithScope lets role grants scoped to the targeted resource apply
+func (p Policy) WithScope(scope ScopeResolver) Policy {
+	p.Scope = scope
+	return p
+}
+
+// ParamScope resolves the targeted resource from a path parameter
+func ParamScope(name string) ScopeResolver {
+	return func(c echo.Context) string {
+		return c.Param(name)
+	}
+}
+
+// ParamOwner resolves resources owned by the user whose ID is the path
+// parameter, such as /users/:id
+func ParamOwner(name string) OwnerResolver {
+	return func(c echo.Context) (primitive.ObjectID, error) {
+		return primitive.ObjectIDFromHex(c.Param(name))
+	}
+}
+
+// Authorize middleware enforces a policy. Requests with an API key must also
+// be allowed by the key's permissions, and roles that require MFA still do.
+func (m *Middleware) Authorize(policy Policy) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			roleID, ok := c.Get("role_id").(primitive.ObjectID)
+			if !ok {
+				return response.Error(c, http.StatusForbidden, "Invalid Role", nil)
+			}
+
+			allowed, err := m.policyAllows(c, policy, roleID)
+			if err != nil {
+				return response.InternalServerError(c, "Failed to Check Permissions", err)
+			}
+
+			if !allowed || !apiKeyAllows(c, policy.Resource, policy.Action) {
+				return response.Error(c, http.StatusForbidden, "Insufficient Permissions", nil)
+			}
+
+			if ok, err := m.mfaSatisfied(c, roleID); err != nil {
+				return response.InternalServerError(c, "Failed to Check Permissions", err)
+			} else if !ok {
+				return response.Error(c, http.StatusForbidden, "Multi-Factor Authentication Required", nil)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// policyAllows evaluates the permissions and falls back to ownership. The
+// owner only stands in for a missing allow entry, a deny entry still wins.
+func (m *Middleware) policyAllows(c echo.Context, policy Policy, roleID primitive.ObjectID) (bool, error) {
+	var resourceID string
+	if policy.Scope != nil {
+		resourceID = policy.Scope(c)
+	}
+
+	permissions, err := m.authService.principalPermissions(principal(c, roleID), resourceID)
+	if err != nil {
+		return false, err
+	}
+
+	if models.Denies(permissions, policy.Resource, policy.Action) {
+		return false, nil
+	}
+	if models.Evaluate(permissions, policy.Resource, policy.Action) {
+		return true, nil
+	}
+
+	if policy.Owner == nil {
+		return false, nil
+	}
+
+	userID, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return false, nil
+	}
+
+	// A resource whose owner can't be resolved isn't the caller's
+	ownerID, err := policy.Owner(c)
+	if err != nil {
+		return false, nil
+	}
+
+	return ownerID == userID, nil
+}
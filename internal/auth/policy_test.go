@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// policyCache never holds anything, so every check reads the repositories
+type policyCache struct {
+	cache.Cache
+}
+
+func (policyCache) Get(key string, dest any) error { return redis.Nil }
+
+func (policyCache) Set(key string, value any, expiration time.Duration) error { return nil }
+
+func (policyCache) SetWithTags(key string, value any, tags []string, expiration time.Duration) error {
+	return nil
+}
+
+type policyRoleRepository struct {
+	repository.RoleRepository
+	role *models.Role
+}
+
+func (r *policyRoleRepository) GetByID(id primitive.ObjectID) (*models.Role, error) {
+	return r.role, nil
+}
+
+type policyGrantRepository struct {
+	repository.RoleGrantRepository
+}
+
+func (policyGrantRepository) ListUnexpiredByUserID(userID primitive.ObjectID, now time.Time) ([]*models.RoleGrant, error) {
+	return nil, nil
+}
+
+func TestAuthorizeOrOwner(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions []models.Permission
+		owner       bool
+		want        int
+	}{
+		{"permission without ownership", []models.Permission{models.NewPermission("users", "update")}, false, http.StatusOK},
+		{"ownership without permission", nil, true, http.StatusOK},
+		{"neither", []models.Permission{models.NewPermission("users", "read")}, false, http.StatusForbidden},
+		{"owner denied the action", []models.Permission{models.NewDenyPermission("users", "update")}, true, http.StatusForbidden},
+		{"owner denied every action", []models.Permission{models.NewDenyPermission("users", "*")}, true, http.StatusForbidden},
+		{"owner denied despite an allow", []models.Permission{models.NewPermission("users", "*"), models.NewDenyPermission("users", "update")}, true, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role := &models.Role{ID: primitive.NewObjectID(), IsActive: true, Permissions: tt.permissions}
+			service := NewAuthService(Repositories{
+				Roles:      &policyRoleRepository{role: role},
+				RoleGrants: policyGrantRepository{},
+			}, policyCache{}, AuthConfig{JWTSecret: "test-secret"})
+
+			userID := primitive.NewObjectID()
+			target := primitive.NewObjectID()
+			if tt.owner {
+				target = userID
+			}
+
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodPut, "/users/"+target.Hex(), nil), rec)
+			c.SetParamNames("id")
+			c.SetParamValues(target.Hex())
+			c.Set("user_id", userID)
+			c.Set("role_id", role.ID)
+
+			policy := Policy{Resource: "users", Action: "update"}.OrOwner(ParamOwner("id"))
+			handler := NewMiddleware(service).Authorize(policy)(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+			if err := handler(c); err != nil {
+				t.Fatalf("handler error = %v", err)
+			}
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GenerateRefreshToken creates a new opaque refresh token in the given family
+// and stores its hash. The plain token is only ever returned to the client.
+func (s *AuthService) GenerateRefreshToken(userID, familyID primitive.ObjectID, mfa bool) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	refreshToken := &models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(token),
+		MFA:       mfa,
+		ExpiresAt: time.Now().Add(s.config.RefreshTokenTTL),
+	}
+
+	if err := s.refreshRepo.Create(refreshToken); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and rotates the
+// refresh token. Presenting a token that was already rotated revokes its family.
+func (s *AuthService) Refresh(refreshToken string) (*models.AuthResponse, error) {
+	stored, err := s.refreshRepo.GetByHash(hashToken(refreshToken))
+	if err != nil {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+
+	if stored.RevokedAt != nil {
+		return nil, fmt.Errorf("refresh token has been revoked")
+	}
+
+	if stored.RotatedAt != nil {
+		if err := s.endSession(stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("refresh token reuse detected")
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, fmt.Errorf("refresh token has expired")
+	}
+
+	// Lost a race with another refresh using the same token, treat it as reuse
+	rotated, err := s.refreshRepo.MarkRotated(stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		if err := s.endSession(stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("refresh token reuse detected")
+	}
+
+	// Reload the account so deactivation and role changes take effect
+	auth, err := s.authRepo.GetByUserID(stored.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !auth.IsActive {
+		return nil, fmt.Errorf("account is deactivated")
+	}
+
+	user, err := s.userRepo.GetByID(auth.UserID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	// The session remembers the organization it switched to. Refresh tokens
+	// issued before sessions existed stay in the default scope.
+	var tenantID primitive.ObjectID
+	if session, err := s.sessionRepo.GetByID(stored.FamilyID); err == nil {
+		tenantID = session.TenantID
+	}
+
+	role, err := s.roleForTenant(auth, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the session alive as long as its refresh tokens
+	if err := s.sessionRepo.Extend(stored.FamilyID, time.Now().Add(s.config.RefreshTokenTTL)); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user, role, stored.FamilyID, tenantID, stored.MFA)
+}
+
+// issueTokens builds an auth response with a fresh access token and a refresh
+// token for the given session, whose ID is also the refresh token family.
+// tenantID is the organization the tokens act in and mfa records whether the
+// session passed a second factor.
+func (s *AuthService) issueTokens(user *models.User, role *models.Role, sessionID, tenantID primitive.ObjectID, mfa bool) (*models.AuthResponse, error) {
+	token, err := s.generateAccessToken(user, role.ID, tenantID, sessionID.Hex(), mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := s.GenerateRefreshToken(user.ID, sessionID, mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresAt:    time.Now().Add(s.config.AccessTokenTTL),
+		User:         user,
+		Role:         role,
+	}, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
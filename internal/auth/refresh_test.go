@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// refreshTokenStore keeps refresh tokens in memory
+type refreshTokenStore struct {
+	repository.RefreshTokenRepository
+	tokens []*models.RefreshToken
+}
+
+func (r *refreshTokenStore) Create(token *models.RefreshToken) error {
+	token.ID = primitive.NewObjectID()
+	copied := *token
+	r.tokens = append(r.tokens, &copied)
+	return nil
+}
+
+func (r *refreshTokenStore) GetByHash(tokenHash string) (*models.RefreshToken, error) {
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *refreshTokenStore) MarkRotated(id primitive.ObjectID) (bool, error) {
+	for _, token := range r.tokens {
+		if token.ID == id && token.RotatedAt == nil && token.RevokedAt == nil {
+			now := time.Now()
+			token.RotatedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *refreshTokenStore) RevokeFamily(familyID primitive.ObjectID) error {
+	now := time.Now()
+	for _, token := range r.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+// racingRefreshRepository rotates a token right after it is read, as a
+// concurrent refresh with the same token would
+type racingRefreshRepository struct {
+	*refreshTokenStore
+}
+
+func (r racingRefreshRepository) GetByHash(tokenHash string) (*models.RefreshToken, error) {
+	token, err := r.refreshTokenStore.GetByHash(tokenHash)
+	if err == nil {
+		r.MarkRotated(token.ID)
+	}
+	return token, err
+}
+
+// refreshSessionRepository holds the one session the tokens belong to
+type refreshSessionRepository struct {
+	repository.SessionRepository
+	session *models.Session
+}
+
+func (r *refreshSessionRepository) GetByID(id primitive.ObjectID) (*models.Session, error) {
+	copied := *r.session
+	return &copied, nil
+}
+
+func (r *refreshSessionRepository) Extend(id primitive.ObjectID, expiresAt time.Time) error {
+	r.session.ExpiresAt = expiresAt
+	return nil
+}
+
+func (r *refreshSessionRepository) Revoke(id primitive.ObjectID) error {
+	now := time.Now()
+	r.session.RevokedAt = &now
+	return nil
+}
+
+type refreshAuthRepository struct {
+	repository.AuthRepository
+	auth *models.UserAuth
+}
+
+func (r *refreshAuthRepository) GetByUserID(userID primitive.ObjectID) (*models.UserAuth, error) {
+	copied := *r.auth
+	return &copied, nil
+}
+
+type refreshUserRepository struct {
+	repository.UserRepository
+	user *models.User
+}
+
+func (r *refreshUserRepository) GetByID(id string) (*models.User, error) {
+	return r.user, nil
+}
+
+type refreshRoleRepository struct {
+	repository.RoleRepository
+	role *models.Role
+}
+
+func (r *refreshRoleRepository) GetByID(id primitive.ObjectID) (*models.Role, error) {
+	return r.role, nil
+}
+
+// refreshCache accepts the revoked session marker and nothing else
+type refreshCache struct {
+	cache.Cache
+}
+
+func (refreshCache) Set(key string, value any, expiration time.Duration) error { return nil }
+
+// refreshFixture is the state a test case can change before refreshing
+type refreshFixture struct {
+	service *AuthService
+	tokens  *refreshTokenStore
+	auth    *models.UserAuth
+}
+
+func TestRefresh(t *testing.T) {
+	tests := []struct {
+		name string
+		// prepare runs after the first token is issued and returns the token
+		// presented to Refresh
+		prepare func(t *testing.T, f *refreshFixture, token string) string
+		wantErr bool
+		// wantRevoked means the session's tokens were all revoked
+		wantRevoked bool
+	}{
+		{
+			name: "rotates",
+			prepare: func(_ *testing.T, _ *refreshFixture, token string) string {
+				return token
+			},
+		},
+		{
+			name: "rotated token reused",
+			prepare: func(t *testing.T, f *refreshFixture, token string) string {
+				if _, err := f.service.Refresh(token); err != nil {
+					t.Fatalf("first Refresh() error = %v", err)
+				}
+				return token
+			},
+			wantErr:     true,
+			wantRevoked: true,
+		},
+		{
+			name: "lost a concurrent rotation",
+			prepare: func(_ *testing.T, f *refreshFixture, token string) string {
+				f.service.refreshRepo = racingRefreshRepository{f.tokens}
+				return token
+			},
+			wantErr:     true,
+			wantRevoked: true,
+		},
+		{
+			name: "expired",
+			prepare: func(_ *testing.T, f *refreshFixture, token string) string {
+				f.tokens.tokens[0].ExpiresAt = time.Now().Add(-time.Minute)
+				return token
+			},
+			wantErr: true,
+		},
+		{
+			name: "revoked",
+			prepare: func(_ *testing.T, f *refreshFixture, token string) string {
+				now := time.Now()
+				f.tokens.tokens[0].RevokedAt = &now
+				return token
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown token",
+			prepare: func(_ *testing.T, _ *refreshFixture, _ string) string {
+				return "unknown"
+			},
+			wantErr: true,
+		},
+		{
+			name: "deactivated account",
+			prepare: func(_ *testing.T, f *refreshFixture, token string) string {
+				f.auth.IsActive = false
+				return token
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role := &models.Role{ID: primitive.NewObjectID(), Name: "member", IsActive: true}
+			user := &models.User{ID: primitive.NewObjectID(), Email: "jane@example.com"}
+			session := &models.Session{ID: primitive.NewObjectID(), UserID: user.ID}
+			f := &refreshFixture{
+				tokens: &refreshTokenStore{},
+				auth:   &models.UserAuth{UserID: user.ID, Email: user.Email, RoleID: role.ID, IsActive: true},
+			}
+			f.service = NewAuthService(Repositories{
+				Auth:          &refreshAuthRepository{auth: f.auth},
+				Users:         &refreshUserRepository{user: user},
+				Roles:         &refreshRoleRepository{role: role},
+				RefreshTokens: f.tokens,
+				Sessions:      &refreshSessionRepository{session: session},
+			}, refreshCache{}, AuthConfig{JWTSecret: "test-secret"})
+
+			token, err := f.service.GenerateRefreshToken(user.ID, session.ID, true)
+			if err != nil {
+				t.Fatalf("GenerateRefreshToken() error = %v", err)
+			}
+			presented := tt.prepare(t, f, token)
+
+			result, err := f.service.Refresh(presented)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Refresh() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantRevoked {
+				for _, stored := range f.tokens.tokens {
+					if stored.RevokedAt == nil {
+						t.Errorf("refresh token %s survived reuse of its family", stored.ID.Hex())
+					}
+				}
+				if session.RevokedAt == nil {
+					t.Errorf("session survived refresh token reuse")
+				}
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if result.RefreshToken == token {
+				t.Errorf("Refresh() returned the presented refresh token")
+			}
+			if f.tokens.tokens[0].RotatedAt == nil {
+				t.Errorf("presented refresh token was not marked rotated")
+			}
+
+			claims, err := f.service.ValidateToken(result.Token)
+			if err != nil {
+				t.Fatalf("ValidateToken() error = %v", err)
+			}
+			if claims.UserID != user.ID || claims.RoleID != role.ID || claims.SessionID != session.ID.Hex() || !claims.MFA {
+				t.Errorf("access token claims = %+v, want the session's user, role and MFA", claims)
+			}
+
+			// The new refresh token belongs to the same session and works once
+			if _, err := f.service.Refresh(result.RefreshToken); err != nil {
+				t.Errorf("Refresh() with the rotated token error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/madhiyono/base-api-nosql/internal/models"
+)
+
+// permissionRegistry is the catalog of permissions routes check. Role
+// permissions are validated against it, so a typo such as "users:reed"
+// is rejected instead of silently granting nothing.
+type permissionRegistry struct {
+	mu          sync.RWMutex
+	permissions map[models.Permission]bool
+}
+
+var registry = newPermissionRegistry()
+
+func newPermissionRegistry() *permissionRegistry {
+	r := &permissionRegistry{permissions: make(map[models.Permission]bool)}
+	for _, resource := range []string{models.ResourceUsers, models.ResourceRoles} {
+		for _, action := range []string{models.ActionCreate, models.ActionRead, models.ActionUpdate, models.ActionDelete} {
+			r.permissions[models.NewPermission(resource, action)] = true
+		}
+	}
+	return r
+}
+
+// RegisterPermission adds a permission to the catalog. Allow registers the
+// permissions routes declare, so handlers rarely need to call it directly.
+func RegisterPermission(resource, action string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	registry.permissions[models.NewPermission(resource, action)] = true
+}
+
+// IsRegisteredPermission reports whether the permission is in the catalog
+func IsRegisteredPermission(resource, action string) bool {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	return registry.permissions[models.NewPermission(resource, action)]
+}
+
+// RegisteredPermissions returns the catalog sorted by resource and action
+func RegisteredPermissions() []models.Permission {
+	registry.mu.RLock()
+	permissions := make([]models.Permission, 0, len(registry.permissions))
+	for permission := range registry.permissions {
+		permissions = append(permissions, permission)
+	}
+	registry.mu.RUnlock()
+
+	sort.Slice(permissions, func(i, j int) bool {
+		if permissions[i].Resource != permissions[j].Resource {
+			return permissions[i].Resource < permissions[j].Resource
+		}
+		return permissions[i].Action < permissions[j].Action
+	})
+	return permissions
+}
+
+// ValidatePermissions rejects role permissions that don't cover any
+// permission in the catalog. Wildcards and parent resources are valid as
+// long as they match at least one registered permission.
+func ValidatePermissions(permissions []models.Permission) error {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	for _, permission := range permissions {
+		if !registry.covers(permission) {
+			return fmt.Errorf("unknown permission %s:%s", permission.Resource, permission.Action)
+		}
+	}
+	return nil
+}
+
+func (r *permissionRegistry) covers(permission models.Permission) bool {
+	for registered := range r.permissions {
+		if permission.Matches(registered.Resource, registered.Action) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RevokeToken adds a single access token to the denylist until it expires
+func (s *AuthService) RevokeToken(claims *models.Claims) error {
+	if claims.ID == "" {
+		return fmt.Errorf("token has no id")
+	}
+
+	ttl := s.config.AccessTokenTTL
+	if claims.ExpiresAt != nil {
+		ttl = time.Until(claims.ExpiresAt.Time)
+	}
+	if ttl <= 0 {
+		return nil
+	}
+
+	return s.cache.Set(cache.RevokedTokenPrefix+claims.ID, true, ttl)
+}
+
+// RevokeAllSessions rejects every access token issued to the user so far and
+// revokes all of their refresh tokens
+func (s *AuthService) RevokeAllSessions(userID primitive.ObjectID) error {
+	// Access tokens never outlive AccessTokenTTL, so the cutoff can expire with them
+	cutoff := time.Now().UnixMilli()
+	if err := s.cache.Set(cache.RevokedUserPrefix+userID.Hex(), cutoff, s.config.AccessTokenTTL); err != nil {
+		return err
+	}
+
+	if err := s.refreshRepo.RevokeByUserID(userID); err != nil {
+		return err
+	}
+
+	return s.sessionRepo.RevokeByUserID(userID)
+}
+
+// Logout revokes the presented access token and ends its session. Tokens
+// issued before sessions existed fall back to revoking the given refresh
+// token's family.
+func (s *AuthService) Logout(claims *models.Claims, refreshToken string) error {
+	if err := s.RevokeToken(claims); err != nil {
+		return err
+	}
+
+	if sessionID, err := primitive.ObjectIDFromHex(claims.SessionID); err == nil {
+		return s.endSession(sessionID)
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	stored, err := s.refreshRepo.GetByHash(hashToken(refreshToken))
+	if err != nil || stored.UserID != claims.UserID {
+		// Unknown refresh tokens are ignored, the access token is already revoked
+		return nil
+	}
+
+	return s.refreshRepo.RevokeFamily(stored.FamilyID)
+}
+
+// IsTokenRevoked checks the denylist for the token itself, its session, a
+// user-wide revocation issued after the token and a later role change
+func (s *AuthService) IsTokenRevoked(claims *models.Claims) (bool, error) {
+	if claims.ID != "" {
+		revoked, err := s.cache.Exists(cache.RevokedTokenPrefix + claims.ID)
+		if err != nil {
+			return false, err
+		}
+		if revoked {
+			return true, nil
+		}
+	}
+
+	if claims.SessionID != "" {
+		revoked, err := s.cache.Exists(cache.RevokedSessionPrefix + claims.SessionID)
+		if err != nil {
+			return false, err
+		}
+		if revoked {
+			return true, nil
+		}
+	}
+
+	revoked, err := s.revokedForUser(claims.UserID, claims)
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	// Tokens carrying a role the user no longer has must be refreshed
+	revoked, err = s.roleChanged(claims)
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	// Revoking the admin's sessions also ends their impersonation tokens
+	if claims.Actor != nil {
+		return s.revokedForUser(claims.Actor.UserID, claims)
+	}
+
+	return false, nil
+}
+
+// revokedForUser reports whether the token was issued before the user's
+// last "revoke all sessions". The cutoff is stored in Unix milliseconds.
+func (s *AuthService) revokedForUser(userID primitive.ObjectID, claims *models.Claims) (bool, error) {
+	var cutoff int64
+	if err := s.cache.Get(cache.RevokedUserPrefix+userID.Hex(), &cutoff); err != nil {
+		if cache.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	// Tokens without an issue time predate revocation support
+	if claims.IssuedAt == nil {
+		return true, nil
+	}
+
+	return claims.IssuedAt.UnixMilli() < cutoff, nil
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// revocationCache keeps values in memory. Nothing here expires.
+type revocationCache struct {
+	cache.Cache
+	values map[string][]byte
+}
+
+func (c *revocationCache) Set(key string, value any, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	c.values[key] = data
+	return nil
+}
+
+func (c *revocationCache) Get(key string, dest any) error {
+	data, ok := c.values[key]
+	if !ok {
+		return redis.Nil
+	}
+	return json.Unmarshal(data, dest)
+}
+
+func (c *revocationCache) Exists(key string) (bool, error) {
+	_, ok := c.values[key]
+	return ok, nil
+}
+
+type revocationRefreshRepository struct {
+	repository.RefreshTokenRepository
+}
+
+func (revocationRefreshRepository) RevokeByUserID(userID primitive.ObjectID) error { return nil }
+
+type revocationSessionRepository struct {
+	repository.SessionRepository
+}
+
+func (revocationSessionRepository) RevokeByUserID(userID primitive.ObjectID) error { return nil }
+
+func TestRevokeAllSessionsCutoff(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset time.Duration // issue time relative to the revocation
+		want   bool
+	}{
+		{"issued well before", -time.Minute, true},
+		{"issued just before", -2 * time.Millisecond, true},
+		{"issued just after", 2 * time.Millisecond, false},
+		{"issued well after", time.Minute, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := &revocationCache{values: map[string][]byte{}}
+			service := NewAuthService(Repositories{
+				RefreshTokens: revocationRefreshRepository{},
+				Sessions:      revocationSessionRepository{},
+			}, memory, AuthConfig{JWTSecret: "test-secret"})
+			userID := primitive.NewObjectID()
+
+			if err := service.RevokeAllSessions(userID); err != nil {
+				t.Fatalf("RevokeAllSessions() error = %v", err)
+			}
+			var cutoff int64
+			if err := memory.Get(cache.RevokedUserPrefix+userID.Hex(), &cutoff); err != nil {
+				t.Fatalf("no revocation cutoff stored: %v", err)
+			}
+			revokedAt := time.UnixMilli(cutoff)
+
+			// Round trip through a signed token, which is where precision was lost
+			token, err := service.keys.sign(&models.Claims{
+				UserID: userID,
+				RegisteredClaims: jwt.RegisteredClaims{
+					IssuedAt:  jwt.NewNumericDate(revokedAt.Add(tt.offset)),
+					ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+				},
+			})
+			if err != nil {
+				t.Fatalf("sign() error = %v", err)
+			}
+			claims, err := service.parseToken(token)
+			if err != nil {
+				t.Fatalf("parseToken() error = %v", err)
+			}
+
+			revoked, err := service.IsTokenRevoked(claims)
+			if err != nil {
+				t.Fatalf("IsTokenRevoked() error = %v", err)
+			}
+			if revoked != tt.want {
+				t.Errorf("IsTokenRevoked() = %v, want %v", revoked, tt.want)
+			}
+		})
+	}
+}
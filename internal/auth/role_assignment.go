@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrLastAdmin is returned when a role change would leave no active administrator
+	ErrLastAdmin = repository.ErrLastAdmin
+	// ErrAssigneeNotFound is returned when the user to assign doesn't exist in the tenant
+	ErrAssigneeNotFound = errors.New("user not found")
+	// ErrRoleNotFound is returned when the role to assign doesn't exist in the tenant
+	ErrRoleNotFound = errors.New("role not found")
+	// ErrRoleInactive is returned when the role to assign is deactivated
+	ErrRoleInactive = errors.New("role is inactive")
+)
+
+// AssignRole moves a user to another role, within an organization for a
+// non-zero tenantID. Access tokens carrying the old role stop working, so
+// clients pick up the new role on their next refresh.
+func (s *AuthService) AssignRole(tenantID, actorID, userID, roleID primitive.ObjectID, ipAddress string) (*models.Role, error) {
+	auth, err := s.authRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, ErrAssigneeNotFound
+	}
+
+	current, err := s.roleForTenant(auth, tenantID)
+	if err != nil {
+		return nil, ErrAssigneeNotFound
+	}
+
+	role, err := s.roleRepo.ForTenant(tenantID).GetByID(roleID)
+	if err != nil {
+		return nil, ErrRoleNotFound
+	}
+	if !role.IsActive {
+		return nil, ErrRoleInactive
+	}
+
+	if current.ID == roleID {
+		return role, nil
+	}
+
+	var adminRoleIDs []primitive.ObjectID
+	if auth.IsActive {
+		adminRoleIDs, err = s.adminsToKeep(tenantID, current.ID, roleID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case adminRoleIDs != nil:
+		err = s.roleRepo.ForTenant(tenantID).AssignKeepingAdmins(userID, roleID, adminRoleIDs)
+	case tenantID.IsZero():
+		err = s.authRepo.UpdateRole(userID, roleID)
+	default:
+		err = s.memberRepo.Upsert(&models.Membership{OrganizationID: tenantID, UserID: userID, RoleID: roleID})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.markRoleChanged(userID, tenantID, roleID.Hex()); err != nil {
+		return nil, err
+	}
+
+	// Best effort: the role change itself already happened
+	_ = s.RecordAudit(&models.AuditLog{
+		ActorID:   actorID,
+		SubjectID: userID,
+		Action:    models.AuditActionRoleAssigned,
+		Reason:    fmt.Sprintf("role changed from %s to %s", current.Name, role.Name),
+		IPAddress: ipAddress,
+	})
+
+	return role, nil
+}
+
+// adminsToKeep returns the tenant's admin roles when moving an active user
+// from fromRoleID to toRoleID takes away an administrator, and nil
+// otherwise. The move must then be made with AssignKeepingAdmins, which
+// checks atomically that someone still holds one of them.
+func (s *AuthService) adminsToKeep(tenantID, fromRoleID, toRoleID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	wasAdmin, err := s.IsAdminRole(fromRoleID)
+	if err != nil || !wasAdmin {
+		return nil, err
+	}
+
+	staysAdmin, err := s.IsAdminRole(toRoleID)
+	if err != nil || staysAdmin {
+		return nil, err
+	}
+
+	return s.adminRoleIDs(tenantID)
+}
+
+// adminRoleIDs lists the roles of the tenant that pass RequireAdmin
+func (s *AuthService) adminRoleIDs(tenantID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	roles, err := s.roleRepo.ForTenant(tenantID).List()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []primitive.ObjectID
+	for _, role := range roles {
+		isAdmin, err := s.IsAdminRole(role.ID)
+		if err != nil {
+			return nil, err
+		}
+		if isAdmin {
+			ids = append(ids, role.ID)
+		}
+	}
+
+	return ids, nil
+}
+
+// countRoleHolders counts the active accounts holding any of the roles in the
+// default scope, or the organization's members holding them
+func (s *AuthService) countRoleHolders(tenantID primitive.ObjectID, roleIDs []primitive.ObjectID) (int64, error) {
+	if tenantID.IsZero() {
+		return s.authRepo.CountActiveByRoleIDs(roleIDs)
+	}
+	return s.memberRepo.CountByRoleIDs(tenantID, roleIDs)
+}
+
+// roleHolders returns the IDs of the users holding the role in the tenant
+func (s *AuthService) roleHolders(tenantID, roleID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	var userIDs []primitive.ObjectID
+
+	if tenantID.IsZero() {
+		auths, err := s.authRepo.ListByRoleID(roleID)
+		if err != nil {
+			return nil, err
+		}
+		for _, auth := range auths {
+			userIDs = append(userIDs, auth.UserID)
+		}
+		return userIDs, nil
+	}
+
+	memberships, err := s.memberRepo.ListByRoleID(tenantID, roleID)
+	if err != nil {
+		return nil, err
+	}
+	for _, membership := range memberships {
+		userIDs = append(userIDs, membership.UserID)
+	}
+	return userIDs, nil
+}
+
+// roleHolder is a user holding a role and the tenant they hold it in
+type roleHolder struct {
+	UserID   primitive.ObjectID
+	TenantID primitive.ObjectID
+}
+
+// deletionHolders returns everyone deleting the role would move. A shared
+// role can also be assigned within organizations, so its memberships in
+// every organization are included.
+func (s *AuthService) deletionHolders(tenantID, roleID primitive.ObjectID) ([]roleHolder, error) {
+	userIDs, err := s.roleHolders(tenantID, roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	holders := make([]roleHolder, 0, len(userIDs))
+	for _, userID := range userIDs {
+		holders = append(holders, roleHolder{UserID: userID, TenantID: tenantID})
+	}
+	if !tenantID.IsZero() {
+		return holders, nil
+	}
+
+	memberships, err := s.memberRepo.ListAllByRoleID(roleID)
+	if err != nil {
+		return nil, err
+	}
+	for _, membership := range memberships {
+		holders = append(holders, roleHolder{UserID: membership.UserID, TenantID: membership.OrganizationID})
+	}
+	return holders, nil
+}
+
+// ListUsersByRole returns the users holding a role in the tenant
+func (s *AuthService) ListUsersByRole(tenantID, roleID primitive.ObjectID) ([]*models.RoleMember, error) {
+	userIDs, err := s.roleHolders(tenantID, roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]*models.RoleMember, 0, len(userIDs))
+	for _, userID := range userIDs {
+		auth, err := s.authRepo.GetByUserID(userID)
+		if err != nil {
+			continue
+		}
+		member := &models.RoleMember{
+			UserID:   auth.UserID,
+			Email:    auth.Email,
+			IsActive: auth.IsActive,
+		}
+		if user, err := s.userRepo.GetByID(auth.UserID.Hex()); err == nil {
+			member.Name = user.Name
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// roleChanged reports whether the user's role was changed after the token
+// was issued, which makes the token's role_id stale. Restricted tokens such
+// as MFA challenges carry no role and are never stale.
+func (s *AuthService) roleChanged(claims *models.Claims) (bool, error) {
+	if claims.Purpose != "" {
+		return false, nil
+	}
+
+	var roleID string
+	if err := s.cache.Get(roleChangedKey(claims.UserID, claims.TenantID), &roleID); err != nil {
+		if cache.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return claims.RoleID.Hex() != roleID, nil
+}
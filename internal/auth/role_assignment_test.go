@@ -0,0 +1,406 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// assignmentCache keeps the role change markers and their TTLs. Role
+// permissions are never cached, so every check reads the roles.
+type assignmentCache struct {
+	cache.Cache
+	values map[string]string
+	ttls   map[string]time.Duration
+}
+
+func newAssignmentCache() *assignmentCache {
+	return &assignmentCache{values: map[string]string{}, ttls: map[string]time.Duration{}}
+}
+
+func (c *assignmentCache) Get(key string, dest any) error {
+	value, ok := c.values[key]
+	if !ok {
+		return redis.Nil
+	}
+	*dest.(*string) = value
+	return nil
+}
+
+func (c *assignmentCache) Set(key string, value any, expiration time.Duration) error {
+	c.values[key] = value.(string)
+	c.ttls[key] = expiration
+	return nil
+}
+
+func (c *assignmentCache) SetWithTags(key string, value any, tags []string, expiration time.Duration) error {
+	return nil
+}
+
+func (c *assignmentCache) TTL(key string) (time.Duration, error) {
+	return c.ttls[key], nil
+}
+
+// assignmentStore holds the roles and who holds them in each scope
+type assignmentStore struct {
+	roles       map[primitive.ObjectID]*models.Role
+	auths       map[primitive.ObjectID]*models.UserAuth
+	memberships []*models.Membership
+}
+
+func newAssignmentStore() *assignmentStore {
+	return &assignmentStore{
+		roles: map[primitive.ObjectID]*models.Role{},
+		auths: map[primitive.ObjectID]*models.UserAuth{},
+	}
+}
+
+func (s *assignmentStore) addRole(name string, permissions ...models.Permission) *models.Role {
+	role := &models.Role{ID: primitive.NewObjectID(), Name: name, Permissions: permissions, IsActive: true}
+	s.roles[role.ID] = role
+	return role
+}
+
+func (s *assignmentStore) addUser(roleID primitive.ObjectID) primitive.ObjectID {
+	userID := primitive.NewObjectID()
+	s.auths[userID] = &models.UserAuth{UserID: userID, RoleID: roleID, IsActive: true}
+	return userID
+}
+
+func (s *assignmentStore) membership(tenantID, userID primitive.ObjectID) *models.Membership {
+	for _, membership := range s.memberships {
+		if membership.OrganizationID == tenantID && membership.UserID == userID {
+			return membership
+		}
+	}
+	return nil
+}
+
+// roleOf points at where the user's role in the tenant is stored
+func (s *assignmentStore) roleOf(tenantID, userID primitive.ObjectID) *primitive.ObjectID {
+	if tenantID.IsZero() {
+		return &s.auths[userID].RoleID
+	}
+	return &s.membership(tenantID, userID).RoleID
+}
+
+// countAdmins counts the tenant's active holders of the roles
+func (s *assignmentStore) countAdmins(tenantID primitive.ObjectID, adminRoleIDs []primitive.ObjectID) int {
+	count := 0
+	if tenantID.IsZero() {
+		for _, auth := range s.auths {
+			if auth.IsActive && containsID(adminRoleIDs, auth.RoleID) {
+				count++
+			}
+		}
+		return count
+	}
+	for _, membership := range s.memberships {
+		if membership.OrganizationID == tenantID && containsID(adminRoleIDs, membership.RoleID) {
+			count++
+		}
+	}
+	return count
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// assignmentRoleRepository serves every role to every tenant, the tests only
+// use shared roles
+type assignmentRoleRepository struct {
+	repository.RoleRepository
+	store  *assignmentStore
+	tenant primitive.ObjectID
+}
+
+func (r *assignmentRoleRepository) ForTenant(tenantID primitive.ObjectID) repository.RoleRepository {
+	return &assignmentRoleRepository{store: r.store, tenant: tenantID}
+}
+
+func (r *assignmentRoleRepository) GetByID(id primitive.ObjectID) (*models.Role, error) {
+	role, ok := r.store.roles[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	copied := *role
+	return &copied, nil
+}
+
+func (r *assignmentRoleRepository) List() ([]*models.Role, error) {
+	var roles []*models.Role
+	for _, role := range r.store.roles {
+		copied := *role
+		roles = append(roles, &copied)
+	}
+	return roles, nil
+}
+
+func (r *assignmentRoleRepository) Update(id primitive.ObjectID, role *models.Role) error {
+	updated := *role
+	updated.ID = id
+	r.store.roles[id] = &updated
+	return nil
+}
+
+func (r *assignmentRoleRepository) UpdateKeepingAdmins(id primitive.ObjectID, role *models.Role, adminRoleIDs []primitive.ObjectID) error {
+	previous := r.store.roles[id]
+	r.Update(id, role)
+	if r.store.countAdmins(r.tenant, adminRoleIDs) == 0 {
+		r.store.roles[id] = previous
+		return repository.ErrLastAdmin
+	}
+	return nil
+}
+
+func (r *assignmentRoleRepository) AssignKeepingAdmins(userID, roleID primitive.ObjectID, adminRoleIDs []primitive.ObjectID) error {
+	held := r.store.roleOf(r.tenant, userID)
+	previous := *held
+	*held = roleID
+	if r.store.countAdmins(r.tenant, adminRoleIDs) == 0 {
+		*held = previous
+		return repository.ErrLastAdmin
+	}
+	return nil
+}
+
+type assignmentAuthRepository struct {
+	repository.AuthRepository
+	store *assignmentStore
+}
+
+func (r *assignmentAuthRepository) GetByUserID(userID primitive.ObjectID) (*models.UserAuth, error) {
+	auth, ok := r.store.auths[userID]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	copied := *auth
+	return &copied, nil
+}
+
+func (r *assignmentAuthRepository) UpdateRole(userID, roleID primitive.ObjectID) error {
+	r.store.auths[userID].RoleID = roleID
+	return nil
+}
+
+type assignmentMembershipRepository struct {
+	repository.MembershipRepository
+	store *assignmentStore
+}
+
+func (r *assignmentMembershipRepository) Get(organizationID, userID primitive.ObjectID) (*models.Membership, error) {
+	membership := r.store.membership(organizationID, userID)
+	if membership == nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	copied := *membership
+	return &copied, nil
+}
+
+type assignmentAuditRepository struct {
+	repository.AuditLogRepository
+}
+
+func (assignmentAuditRepository) Create(entry *models.AuditLog) error { return nil }
+
+func newAssignmentService(store *assignmentStore) *AuthService {
+	return NewAuthService(Repositories{
+		Auth:        &assignmentAuthRepository{store: store},
+		Roles:       &assignmentRoleRepository{store: store},
+		Memberships: &assignmentMembershipRepository{store: store},
+		AuditLogs:   assignmentAuditRepository{},
+	}, newAssignmentCache(), AuthConfig{JWTSecret: "test-secret"})
+}
+
+func TestAssignRoleKeepsAnAdmin(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenant  bool
+		admins  int
+		demote  bool // move the admin to a non-admin role
+		wantErr error
+	}{
+		{"demoting the only admin", false, 1, true, ErrLastAdmin},
+		{"demoting one of two admins", false, 2, true, nil},
+		{"moving the only admin to another admin role", false, 1, false, nil},
+		{"demoting the only organization admin", true, 1, true, ErrLastAdmin},
+		{"demoting one of two organization admins", true, 2, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newAssignmentStore()
+			service := newAssignmentService(store)
+
+			tenantID := primitive.NilObjectID
+			if tt.tenant {
+				tenantID = primitive.NewObjectID()
+			}
+			admin := store.addRole("admin", models.NewPermission(models.ResourceRoles, models.ActionCreate))
+			owner := store.addRole("owner", models.NewPermission("*", "*"))
+			member := store.addRole("member")
+
+			var adminIDs []primitive.ObjectID
+			for i := 0; i < tt.admins; i++ {
+				if tt.tenant {
+					userID := store.addUser(member.ID)
+					store.memberships = append(store.memberships, &models.Membership{
+						OrganizationID: tenantID, UserID: userID, RoleID: admin.ID,
+					})
+					adminIDs = append(adminIDs, userID)
+				} else {
+					adminIDs = append(adminIDs, store.addUser(admin.ID))
+				}
+			}
+
+			target := owner.ID
+			if tt.demote {
+				target = member.ID
+			}
+
+			_, err := service.AssignRole(tenantID, adminIDs[0], adminIDs[0], target, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AssignRole() error = %v, want %v", err, tt.wantErr)
+			}
+
+			want := target
+			if tt.wantErr != nil {
+				want = admin.ID
+			}
+			if got := *store.roleOf(tenantID, adminIDs[0]); got != want {
+				t.Errorf("role after AssignRole() = %s, want %s", got.Hex(), want.Hex())
+			}
+		})
+	}
+}
+
+func TestUpdateRoleKeepsAnAdmin(t *testing.T) {
+	adminPermission := models.NewPermission(models.ResourceRoles, models.ActionCreate)
+
+	tests := []struct {
+		name       string
+		otherAdmin bool // another active user holds a second admin role
+		update     func(role models.Role) models.Role
+		wantErr    error
+	}{
+		{
+			name: "dropping roles:create from the last admin role",
+			update: func(role models.Role) models.Role {
+				role.Permissions = []models.Permission{models.NewPermission("users", "read")}
+				return role
+			},
+			wantErr: ErrLastAdmin,
+		},
+		{
+			name: "deactivating the last admin role",
+			update: func(role models.Role) models.Role {
+				role.IsActive = false
+				return role
+			},
+			wantErr: ErrLastAdmin,
+		},
+		{
+			name: "denying roles:create on the last admin role",
+			update: func(role models.Role) models.Role {
+				role.Permissions = append(role.Permissions, models.NewDenyPermission(models.ResourceRoles, models.ActionCreate))
+				return role
+			},
+			wantErr: ErrLastAdmin,
+		},
+		{
+			name: "deactivating an admin role while another remains",
+			update: func(role models.Role) models.Role {
+				role.IsActive = false
+				return role
+			},
+			otherAdmin: true,
+		},
+		{
+			name: "describing the last admin role",
+			update: func(role models.Role) models.Role {
+				role.Description = "Administrators"
+				return role
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newAssignmentStore()
+			service := newAssignmentService(store)
+
+			admin := store.addRole("admin", adminPermission)
+			store.addUser(admin.ID)
+			if tt.otherAdmin {
+				store.addUser(store.addRole("owner", adminPermission).ID)
+			}
+
+			updated := tt.update(*admin)
+			err := service.UpdateRole(primitive.NilObjectID, admin.ID, &updated)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateRole() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if saved := reflect.DeepEqual(*store.roles[admin.ID], updated); saved != (tt.wantErr == nil) {
+				t.Errorf("role saved = %v, want %v", saved, tt.wantErr == nil)
+			}
+		})
+	}
+}
+
+func TestRoleChanged(t *testing.T) {
+	userID := primitive.NewObjectID()
+	tenantID := primitive.NewObjectID()
+	oldRole := primitive.NewObjectID()
+	newRole := primitive.NewObjectID()
+
+	tests := []struct {
+		name   string
+		claims models.Claims
+		want   bool
+	}{
+		{"token with the old role", models.Claims{UserID: userID, RoleID: oldRole}, true},
+		{"token with the new role", models.Claims{UserID: userID, RoleID: newRole}, false},
+		{"token for another tenant", models.Claims{UserID: userID, RoleID: oldRole, TenantID: tenantID}, false},
+		{"impersonation token with the old role", models.Claims{UserID: userID, RoleID: oldRole, Actor: &models.ActorClaim{UserID: primitive.NewObjectID()}}, true},
+		{"mfa challenge", models.Claims{UserID: userID, Purpose: models.TokenPurposeMFAPending}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := newAssignmentCache()
+			service := NewAuthService(Repositories{}, memory, AuthConfig{JWTSecret: "test-secret"})
+			service.config.AccessTokenTTL = 5 * time.Minute
+
+			if err := service.markRoleChanged(userID, primitive.NilObjectID, newRole.Hex()); err != nil {
+				t.Fatalf("markRoleChanged() error = %v", err)
+			}
+			// The marker must outlive impersonation tokens, not just access tokens
+			if ttl, _ := memory.TTL(roleChangedKey(userID, primitive.NilObjectID)); ttl < impersonationTTL-time.Second {
+				t.Errorf("marker TTL = %v, want at least %v", ttl, impersonationTTL)
+			}
+
+			got, err := service.roleChanged(&tt.claims)
+			if err != nil {
+				t.Fatalf("roleChanged() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("roleChanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// localRoleCacheTTL bounds how long an instance trusts its in-process copy,
+// in case an invalidation message is missed while Redis is unreachable
+const localRoleCacheTTL = 1 * time.Minute
+
+// cachedRole is what permission checks need to know about a role
+type cachedRole struct {
+	Permissions []models.Permission `json:"permissions"`
+	// RequireMFA is also set for roles allowed to change roles, since
+	// those can make anyone an administrator
+	RequireMFA bool `json:"require_mfa"`
+}
+
+// managesRoles reports whether the permissions allow changing roles, which
+// is what makes a role an admin role. RequireAdmin, the last admin checks,
+// impersonation and the MFA requirement all use it.
+func managesRoles(permissions []models.Permission) bool {
+	for _, action := range []string{models.ActionCreate, models.ActionUpdate, models.ActionDelete} {
+		if models.Evaluate(permissions, models.ResourceRoles, action) {
+			return true
+		}
+	}
+	return false
+}
+
+type localRoleEntry struct {
+	role      cachedRole
+	expiresAt time.Time
+}
+
+// roleCache is the in-process layer in front of Redis. The generation
+// counter keeps a lookup that raced with an invalidation from storing
+// the stale result.
+type roleCache struct {
+	mu         sync.RWMutex
+	entries    map[primitive.ObjectID]localRoleEntry
+	generation uint64
+}
+
+func newRoleCache() *roleCache {
+	return &roleCache{entries: make(map[primitive.ObjectID]localRoleEntry)}
+}
+
+func (c *roleCache) get(roleID primitive.ObjectID) (cachedRole, uint64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[roleID]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return cachedRole{}, c.generation, false
+	}
+	return entry.role, c.generation, true
+}
+
+func (c *roleCache) set(roleID primitive.ObjectID, role cachedRole, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	c.entries[roleID] = localRoleEntry{role: role, expiresAt: time.Now().Add(localRoleCacheTTL)}
+}
+
+func (c *roleCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[primitive.ObjectID]localRoleEntry)
+	c.generation++
+}
+
+// cachedRoleFor returns the role's resolved permissions from the local
+// cache, then Redis, then Mongo
+func (s *AuthService) cachedRoleFor(roleID primitive.ObjectID) (cachedRole, error) {
+	role, generation, ok := s.roleCache.get(roleID)
+	if ok {
+		return role, nil
+	}
+
+	// The version is read before Mongo, so a result that raced with an
+	// invalidation is stored under a version nobody reads any more
+	key := cache.RolePermissionsPrefix + s.rolePermissionsVersion() + ":" + roleID.Hex()
+	if err := s.cache.Get(key, &role); err == nil {
+		s.roleCache.set(roleID, role, generation)
+		return role, nil
+	}
+
+	stored, err := s.roleRepo.GetByID(roleID)
+	if err != nil {
+		return cachedRole{}, err
+	}
+	permissions, err := s.EffectivePermissions(roleID)
+	if err != nil {
+		return cachedRole{}, err
+	}
+
+	role = cachedRole{Permissions: permissions, RequireMFA: stored.RequireMFA || managesRoles(permissions)}
+	s.roleCache.set(roleID, role, generation)
+	// Best effort: a Redis failure only costs the next lookup a query
+	_ = s.cache.SetWithTags(key, role, []string{cache.RolePermissionsTag}, cache.ShortExpiration)
+
+	return role, nil
+}
+
+// rolePermissionsVersion returns the version cached permissions are stored
+// under, which every invalidation replaces
+func (s *AuthService) rolePermissionsVersion() string {
+	var version string
+	_ = s.cache.Get(cache.RolePermissionsVersion, &version)
+	return version
+}
+
+// InvalidateRolePermissions drops cached permissions after a role changes.
+// Every role is dropped, not just roleID, because roles inheriting from it
+// are affected too. Other instances are told through Redis pub/sub.
+func (s *AuthService) InvalidateRolePermissions(roleID primitive.ObjectID) error {
+	s.roleCache.clear()
+
+	version, err := randomURLString(12)
+	if err != nil {
+		return err
+	}
+	if err := s.cache.Set(cache.RolePermissionsVersion, version, 0); err != nil {
+		return err
+	}
+	// The old entries can no longer be read, this only frees them early
+	if err := s.cache.InvalidateTag(cache.RolePermissionsTag); err != nil {
+		return err
+	}
+
+	return s.cache.Publish(cache.RoleChangesChannel, roleID.Hex())
+}
+
+// ListenForRoleChanges clears the in-process role cache whenever any
+// instance changes a role. It reconnects until ctx is cancelled.
+func (s *AuthService) ListenForRoleChanges(ctx context.Context) {
+	for ctx.Err() == nil {
+		_ = s.cache.Subscribe(ctx, cache.RoleChangesChannel, func(string) {
+			s.roleCache.clear()
+		})
+
+		// Anything may have changed while we weren't listening
+		s.roleCache.clear()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
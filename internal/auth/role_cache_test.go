@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// roleCacheStore keeps values and their tags in memory, it stands in for
+// the Redis instance shared with other instances. Nothing here expires.
+type roleCacheStore struct {
+	cache.Cache
+	values map[string][]byte
+	tags   map[string][]string
+}
+
+func (c *roleCacheStore) Get(key string, dest any) error {
+	data, ok := c.values[key]
+	if !ok {
+		return redis.Nil
+	}
+	return json.Unmarshal(data, dest)
+}
+
+func (c *roleCacheStore) Set(key string, value any, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	c.values[key] = data
+	return nil
+}
+
+func (c *roleCacheStore) SetWithTags(key string, value any, tags []string, expiration time.Duration) error {
+	for _, tag := range tags {
+		c.tags[tag] = append(c.tags[tag], key)
+	}
+	return c.Set(key, value, expiration)
+}
+
+func (c *roleCacheStore) InvalidateTag(tag string) error {
+	for _, key := range c.tags[tag] {
+		delete(c.values, key)
+	}
+	delete(c.tags, tag)
+	return nil
+}
+
+func (c *roleCacheStore) Publish(channel, message string) error { return nil }
+
+// racingRoleRepository changes a role right after a lookup read it, like an
+// update landing between the lookup's query and its cache write
+type racingRoleRepository struct {
+	repository.RoleRepository
+	role    *models.Role
+	reads   int
+	raceOn  int
+	onRaced func()
+}
+
+func (r *racingRoleRepository) GetByID(id primitive.ObjectID) (*models.Role, error) {
+	role := *r.role
+	r.reads++
+	if r.reads == r.raceOn {
+		r.onRaced()
+	}
+	return &role, nil
+}
+
+func TestCachedRoleForInvalidationRace(t *testing.T) {
+	read := models.NewPermission("users", "read")
+	write := models.NewPermission("users", "update")
+
+	tests := []struct {
+		name string
+		race bool
+		want bool // whether users:update is allowed afterwards
+	}{
+		{"no concurrent change", false, false},
+		{"role changed during lookup", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role := &models.Role{ID: primitive.NewObjectID(), Name: "editor", IsActive: true,
+				Permissions: []models.Permission{read}}
+			repo := &racingRoleRepository{role: role}
+			service := NewAuthService(Repositories{Roles: repo}, &roleCacheStore{
+				values: map[string][]byte{},
+				tags:   map[string][]string{},
+			}, AuthConfig{JWTSecret: "test-secret"})
+			if tt.race {
+				// The second read is the one permissions are resolved from
+				repo.raceOn = 2
+				repo.onRaced = func() {
+					role.Permissions = []models.Permission{read, write}
+					if err := service.InvalidateRolePermissions(role.ID); err != nil {
+						t.Fatalf("InvalidateRolePermissions() error = %v", err)
+					}
+				}
+			}
+
+			if _, err := service.cachedRoleFor(role.ID); err != nil {
+				t.Fatalf("cachedRoleFor() error = %v", err)
+			}
+
+			// Another instance, or this one once its local copy expires
+			service.roleCache.clear()
+			got, err := service.HasPermission(role.ID, "users", "update")
+			if err != nil {
+				t.Fatalf("HasPermission() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("HasPermission(users, update) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
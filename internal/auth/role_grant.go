@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrInvalidGrantRole is returned when the granted role ID is malformed
+	ErrInvalidGrantRole = errors.New("invalid role ID")
+	// ErrGrantEndsBeforeStart is returned when expires_at isn't after starts_at
+	ErrGrantEndsBeforeStart = errors.New("expires_at must be after starts_at")
+	// ErrGrantExpired is returned when expires_at is already in the past
+	ErrGrantExpired = errors.New("expires_at must be in the future")
+	// ErrRoleGrantNotFound is returned when the grant doesn't exist for the user in the tenant
+	ErrRoleGrantNotFound = errors.New("role grant not found")
+)
+
+// Principal is who a permission check is made for
+type Principal struct {
+	UserID   primitive.ObjectID
+	RoleID   primitive.ObjectID
+	TenantID primitive.ObjectID
+	// MFA tells whether the caller completed multi-factor authentication,
+	// which grants of roles requiring MFA need
+	MFA bool
+}
+
+// PrincipalHasPermission evaluates the principal's role together with their
+// active role grants. resourceID is the resource the request targets, if
+// any, for grants scoped to one resource. Permissions are evaluated as one
+// set, so a deny from the role still wins over an allow from a grant.
+func (s *AuthService) PrincipalHasPermission(principal Principal, resource, action, resourceID string) (bool, error) {
+	permissions, err := s.principalPermissions(principal, resourceID)
+	if err != nil {
+		return false, err
+	}
+
+	return models.Evaluate(permissions, resource, action), nil
+}
+
+// principalPermissions returns the permissions of the principal's role and
+// of their active grants that cover resourceID
+func (s *AuthService) principalPermissions(principal Principal, resourceID string) ([]models.Permission, error) {
+	role, err := s.cachedRoleFor(principal.RoleID)
+	if err != nil {
+		return nil, err
+	}
+
+	grants, err := s.activeGrants(principal.UserID, principal.TenantID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := role.Permissions
+	if len(grants) > 0 {
+		// Never append to the cached role's slice
+		permissions = append([]models.Permission(nil), role.Permissions...)
+	}
+	for _, grant := range grants {
+		if !grant.Covers(resourceID) {
+			continue
+		}
+
+		granted, err := s.cachedRoleFor(grant.RoleID)
+		if err != nil {
+			// The granted role was deleted
+			continue
+		}
+		if granted.RequireMFA && !principal.MFA {
+			continue
+		}
+		permissions = append(permissions, granted.Permissions...)
+	}
+
+	return permissions, nil
+}
+
+// CreateRoleGrant gives a user a role's permissions for a limited time, in
+// the organization for a non-zero tenantID
+func (s *AuthService) CreateRoleGrant(tenantID, actorID, userID primitive.ObjectID, request *models.CreateRoleGrantRequest, ipAddress string) (*models.RoleGrant, error) {
+	auth, err := s.authRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, ErrAssigneeNotFound
+	}
+	if _, err := s.roleForTenant(auth, tenantID); err != nil {
+		return nil, ErrAssigneeNotFound
+	}
+
+	roleID, err := primitive.ObjectIDFromHex(request.RoleID)
+	if err != nil {
+		return nil, ErrInvalidGrantRole
+	}
+	role, err := s.roleRepo.ForTenant(tenantID).GetByID(roleID)
+	if err != nil {
+		return nil, ErrRoleNotFound
+	}
+	if !role.IsActive {
+		return nil, ErrRoleInactive
+	}
+
+	now := time.Now()
+	startsAt := now
+	if request.StartsAt != nil {
+		startsAt = *request.StartsAt
+	}
+	if !request.ExpiresAt.After(startsAt) {
+		return nil, ErrGrantEndsBeforeStart
+	}
+	if !request.ExpiresAt.After(now) {
+		return nil, ErrGrantExpired
+	}
+
+	grant := &models.RoleGrant{
+		UserID:     userID,
+		RoleID:     roleID,
+		TenantID:   tenantID,
+		ResourceID: request.ResourceID,
+		Reason:     request.Reason,
+		GrantedBy:  actorID,
+		StartsAt:   startsAt,
+		ExpiresAt:  request.ExpiresAt,
+	}
+	if err := s.grantRepo.Create(grant); err != nil {
+		return nil, err
+	}
+
+	if err := s.cache.Delete(cache.RoleGrantsPrefix + userID.Hex()); err != nil {
+		return nil, err
+	}
+
+	// Best effort: the grant itself already exists
+	_ = s.RecordAudit(&models.AuditLog{
+		ActorID:   actorID,
+		SubjectID: userID,
+		Action:    models.AuditActionRoleGranted,
+		Reason:    fmt.Sprintf("role %s granted until %s", role.Name, grant.ExpiresAt.Format(time.RFC3339)),
+		IPAddress: ipAddress,
+	})
+
+	return grant, nil
+}
+
+// ListRoleGrants returns the user's grants in the organization, including
+// expired ones
+func (s *AuthService) ListRoleGrants(tenantID, userID primitive.ObjectID) ([]*models.RoleGrant, error) {
+	grants, err := s.grantRepo.ListByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	scoped := make([]*models.RoleGrant, 0, len(grants))
+	for _, grant := range grants {
+		if grant.TenantID == tenantID {
+			scoped = append(scoped, grant)
+		}
+	}
+
+	return scoped, nil
+}
+
+// RevokeRoleGrant ends a grant before it expires
+func (s *AuthService) RevokeRoleGrant(tenantID, actorID, userID, grantID primitive.ObjectID, ipAddress string) error {
+	grant, err := s.grantRepo.GetByID(grantID)
+	if err != nil || grant.UserID != userID || grant.TenantID != tenantID {
+		return ErrRoleGrantNotFound
+	}
+
+	if err := s.grantRepo.Delete(grantID); err != nil {
+		return ErrRoleGrantNotFound
+	}
+
+	if err := s.cache.Delete(cache.RoleGrantsPrefix + userID.Hex()); err != nil {
+		return err
+	}
+
+	_ = s.RecordAudit(&models.AuditLog{
+		ActorID:   actorID,
+		SubjectID: userID,
+		Action:    models.AuditActionRoleGrantRevoked,
+		Reason:    fmt.Sprintf("role grant %s revoked", grantID.Hex()),
+		IPAddress: ipAddress,
+	})
+
+	return nil
+}
+
+// activeGrants returns the user's grants in effect in the tenant. The
+// user's unexpired grants are cached in Redis, since every permission check
+// needs them, until the first of them expires. Creating, revoking and
+// sweeping grants drops the entry.
+func (s *AuthService) activeGrants(userID, tenantID primitive.ObjectID, now time.Time) ([]*models.RoleGrant, error) {
+	key := cache.RoleGrantsPrefix + userID.Hex()
+
+	var grants []*models.RoleGrant
+	if err := s.cache.Get(key, &grants); err != nil {
+		grants, err = s.grantRepo.ListUnexpiredByUserID(userID, now)
+		if err != nil {
+			return nil, err
+		}
+		// Best effort: a Redis failure only costs the next check a query
+		if ttl := grantsCacheTTL(grants, now); ttl > 0 {
+			_ = s.cache.Set(key, grants, ttl)
+		}
+	}
+
+	var active []*models.RoleGrant
+	for _, grant := range grants {
+		if grant.TenantID == tenantID && grant.IsActive(now) {
+			active = append(active, grant)
+		}
+	}
+
+	return active, nil
+}
+
+// grantsCacheTTL keeps cached grants until the earliest one expires, so the
+// entry never outlives what it lists
+func grantsCacheTTL(grants []*models.RoleGrant, now time.Time) time.Duration {
+	ttl := cache.ShortExpiration
+	for _, grant := range grants {
+		if remaining := grant.ExpiresAt.Sub(now); remaining < ttl {
+			ttl = remaining
+		}
+	}
+	return ttl
+}
+
+// ExpireRoleGrants marks ended grants as expired and returns those this
+// call claimed, so each one is reported once across instances
+func (s *AuthService) ExpireRoleGrants(now time.Time) ([]*models.RoleGrant, error) {
+	due, err := s.grantRepo.ListDue(now)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []*models.RoleGrant
+	for _, grant := range due {
+		claimed, err := s.grantRepo.MarkExpired(grant.ID)
+		if err != nil {
+			return expired, err
+		}
+		if !claimed {
+			continue
+		}
+
+		// Best effort: cached grants are filtered by time anyway
+		_ = s.cache.Delete(cache.RoleGrantsPrefix + grant.UserID.Hex())
+		expired = append(expired, grant)
+	}
+
+	return expired, nil
+}
+
+// SweepRoleGrants expires grants every interval until ctx is cancelled,
+// calling notify for each expired grant
+func (s *AuthService) SweepRoleGrants(ctx context.Context, interval time.Duration, notify func(*models.RoleGrant)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expired, _ := s.ExpireRoleGrants(now)
+			for _, grant := range expired {
+				notify(grant)
+			}
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// grantCache keeps values in memory. Nothing here expires.
+type grantCache struct {
+	cache.Cache
+	values map[string][]byte
+}
+
+func (c *grantCache) Get(key string, dest any) error {
+	data, ok := c.values[key]
+	if !ok {
+		return redis.Nil
+	}
+	return json.Unmarshal(data, dest)
+}
+
+func (c *grantCache) Set(key string, value any, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	c.values[key] = data
+	return nil
+}
+
+func (c *grantCache) SetWithTags(key string, value any, tags []string, expiration time.Duration) error {
+	return c.Set(key, value, expiration)
+}
+
+func (c *grantCache) Delete(key string) error {
+	delete(c.values, key)
+	return nil
+}
+
+// countingGrantRepository keeps grants in memory and counts how often a
+// user's grants are queried
+type countingGrantRepository struct {
+	repository.RoleGrantRepository
+	grants map[primitive.ObjectID]*models.RoleGrant
+	reads  int
+}
+
+func (r *countingGrantRepository) Create(grant *models.RoleGrant) error {
+	grant.ID = primitive.NewObjectID()
+	copied := *grant
+	r.grants[grant.ID] = &copied
+	return nil
+}
+
+func (r *countingGrantRepository) GetByID(id primitive.ObjectID) (*models.RoleGrant, error) {
+	grant, ok := r.grants[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	copied := *grant
+	return &copied, nil
+}
+
+func (r *countingGrantRepository) ListUnexpiredByUserID(userID primitive.ObjectID, now time.Time) ([]*models.RoleGrant, error) {
+	r.reads++
+
+	var grants []*models.RoleGrant
+	for _, grant := range r.grants {
+		if grant.UserID == userID && grant.ExpiresAt.After(now) {
+			copied := *grant
+			grants = append(grants, &copied)
+		}
+	}
+	return grants, nil
+}
+
+func (r *countingGrantRepository) ListDue(now time.Time) ([]*models.RoleGrant, error) {
+	var grants []*models.RoleGrant
+	for _, grant := range r.grants {
+		if !grant.Expired && !grant.ExpiresAt.After(now) {
+			copied := *grant
+			grants = append(grants, &copied)
+		}
+	}
+	return grants, nil
+}
+
+func (r *countingGrantRepository) MarkExpired(id primitive.ObjectID) (bool, error) {
+	grant, ok := r.grants[id]
+	if !ok || grant.Expired {
+		return false, nil
+	}
+	grant.Expired = true
+	return true, nil
+}
+
+func (r *countingGrantRepository) Delete(id primitive.ObjectID) error {
+	delete(r.grants, id)
+	return nil
+}
+
+type grantAuthRepository struct {
+	repository.AuthRepository
+	auth *models.UserAuth
+}
+
+func (r *grantAuthRepository) GetByUserID(userID primitive.ObjectID) (*models.UserAuth, error) {
+	return r.auth, nil
+}
+
+type grantRoleRepository struct {
+	repository.RoleRepository
+	roles map[primitive.ObjectID]*models.Role
+}
+
+func (r *grantRoleRepository) ForTenant(tenantID primitive.ObjectID) repository.RoleRepository {
+	return r
+}
+
+func (r *grantRoleRepository) GetByID(id primitive.ObjectID) (*models.Role, error) {
+	role, ok := r.roles[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return role, nil
+}
+
+type grantAuditRepository struct {
+	repository.AuditLogRepository
+}
+
+func (grantAuditRepository) Create(entry *models.AuditLog) error { return nil }
+
+func TestGrantsCacheTTL(t *testing.T) {
+	now := time.Now()
+	expiring := func(in time.Duration) *models.RoleGrant {
+		return &models.RoleGrant{StartsAt: now.Add(-time.Hour), ExpiresAt: now.Add(in)}
+	}
+
+	tests := []struct {
+		name   string
+		grants []*models.RoleGrant
+		want   time.Duration
+	}{
+		{"no grants", nil, cache.ShortExpiration},
+		{"expires after the cache", []*models.RoleGrant{expiring(time.Hour)}, cache.ShortExpiration},
+		{"expires before the cache", []*models.RoleGrant{expiring(time.Minute)}, time.Minute},
+		{"earliest of several", []*models.RoleGrant{expiring(time.Hour), expiring(2 * time.Minute), expiring(5 * time.Minute)}, 2 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := grantsCacheTTL(tt.grants, now); got != tt.want {
+				t.Errorf("grantsCacheTTL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActiveGrantsCache(t *testing.T) {
+	tests := []struct {
+		name string
+		// change runs between two permission checks
+		change    func(t *testing.T, service *AuthService, userID, roleID primitive.ObjectID)
+		wantReads int
+		wantAllow bool
+	}{
+		{
+			name:      "repeated checks are cached",
+			change:    func(*testing.T, *AuthService, primitive.ObjectID, primitive.ObjectID) {},
+			wantReads: 1,
+		},
+		{
+			name: "creating a grant invalidates",
+			change: func(t *testing.T, service *AuthService, userID, roleID primitive.ObjectID) {
+				request := &models.CreateRoleGrantRequest{RoleID: roleID.Hex(), ExpiresAt: time.Now().Add(time.Hour)}
+				if _, err := service.CreateRoleGrant(primitive.NilObjectID, primitive.NewObjectID(), userID, request, ""); err != nil {
+					t.Fatalf("CreateRoleGrant() error = %v", err)
+				}
+			},
+			wantReads: 2,
+			wantAllow: true,
+		},
+		{
+			name: "revoking a grant invalidates",
+			change: func(t *testing.T, service *AuthService, userID, roleID primitive.ObjectID) {
+				request := &models.CreateRoleGrantRequest{RoleID: roleID.Hex(), ExpiresAt: time.Now().Add(time.Hour)}
+				grant, err := service.CreateRoleGrant(primitive.NilObjectID, primitive.NewObjectID(), userID, request, "")
+				if err != nil {
+					t.Fatalf("CreateRoleGrant() error = %v", err)
+				}
+				if _, err := service.PrincipalHasPermission(Principal{UserID: userID, RoleID: roleID}, "reports", "read", ""); err != nil {
+					t.Fatalf("PrincipalHasPermission() error = %v", err)
+				}
+				if err := service.RevokeRoleGrant(primitive.NilObjectID, primitive.NewObjectID(), userID, grant.ID, ""); err != nil {
+					t.Fatalf("RevokeRoleGrant() error = %v", err)
+				}
+			},
+			wantReads: 3,
+		},
+		{
+			name: "sweeping a grant invalidates",
+			change: func(t *testing.T, service *AuthService, userID, roleID primitive.ObjectID) {
+				request := &models.CreateRoleGrantRequest{RoleID: roleID.Hex(), ExpiresAt: time.Now().Add(time.Hour)}
+				if _, err := service.CreateRoleGrant(primitive.NilObjectID, primitive.NewObjectID(), userID, request, ""); err != nil {
+					t.Fatalf("CreateRoleGrant() error = %v", err)
+				}
+				if _, err := service.PrincipalHasPermission(Principal{UserID: userID, RoleID: roleID}, "reports", "read", ""); err != nil {
+					t.Fatalf("PrincipalHasPermission() error = %v", err)
+				}
+				// The grant ends before the sweeper runs
+				for _, grant := range service.grantRepo.(*countingGrantRepository).grants {
+					grant.ExpiresAt = time.Now().Add(-time.Second)
+				}
+				expired, err := service.ExpireRoleGrants(time.Now())
+				if err != nil || len(expired) != 1 {
+					t.Fatalf("ExpireRoleGrants() = %d grants, %v", len(expired), err)
+				}
+			},
+			wantReads: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := &models.Role{ID: primitive.NewObjectID(), Name: "user", IsActive: true}
+			reporter := &models.Role{ID: primitive.NewObjectID(), Name: "reporter", IsActive: true,
+				Permissions: []models.Permission{models.NewPermission("reports", "read")}}
+			userID := primitive.NewObjectID()
+			grants := &countingGrantRepository{grants: map[primitive.ObjectID]*models.RoleGrant{}}
+			service := NewAuthService(Repositories{
+				Auth:       &grantAuthRepository{auth: &models.UserAuth{UserID: userID, RoleID: base.ID, IsActive: true}},
+				Roles:      &grantRoleRepository{roles: map[primitive.ObjectID]*models.Role{base.ID: base, reporter.ID: reporter}},
+				RoleGrants: grants,
+				AuditLogs:  grantAuditRepository{},
+			}, &grantCache{values: map[string][]byte{}}, AuthConfig{JWTSecret: "test-secret"})
+			principal := Principal{UserID: userID, RoleID: base.ID}
+
+			if _, err := service.PrincipalHasPermission(principal, "reports", "read", ""); err != nil {
+				t.Fatalf("PrincipalHasPermission() error = %v", err)
+			}
+			tt.change(t, service, userID, reporter.ID)
+
+			allowed, err := service.PrincipalHasPermission(principal, "reports", "read", "")
+			if err != nil {
+				t.Fatalf("PrincipalHasPermission() error = %v", err)
+			}
+			if allowed != tt.wantAllow {
+				t.Errorf("PrincipalHasPermission() = %v, want %v", allowed, tt.wantAllow)
+			}
+			if grants.reads != tt.wantReads {
+				t.Errorf("grant queries = %d, want %d", grants.reads, tt.wantReads)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrSystemRole is returned when deleting or renaming a system role
+	ErrSystemRole = errors.New("system roles cannot be deleted or renamed")
+	// ErrRoleInUse is returned when deleting a role that users still hold
+	ErrRoleInUse = repository.ErrRoleInUse
+	// ErrSharedRole is returned when an organization changes a role shared by every organization
+	ErrSharedRole = errors.New("shared roles can only be changed outside an organization")
+)
+
+// ResolveRole collects the permissions of a role and all of its ancestors.
+// Inactive or missing ancestors contribute nothing, and every role is visited
+// once, so a cycle introduced outside the API can't loop forever.
+func (s *AuthService) ResolveRole(roleID primitive.ObjectID) (*models.EffectivePermissions, error) {
+	return resolveRole(roleID, s.roleRepo.GetByID)
+}
+
+// resolveRole is ResolveRole reading roles through lookup, which lets a
+// pending change be resolved before it is saved
+func resolveRole(roleID primitive.ObjectID, lookup func(primitive.ObjectID) (*models.Role, error)) (*models.EffectivePermissions, error) {
+	role, err := lookup(roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	effective := &models.EffectivePermissions{
+		RoleID:      roleID,
+		Roles:       []primitive.ObjectID{},
+		Permissions: []models.ResolvedPermission{},
+	}
+
+	visited := map[primitive.ObjectID]bool{roleID: true}
+	queue := []*models.Role{role}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if !current.IsActive {
+			continue
+		}
+
+		effective.Roles = append(effective.Roles, current.ID)
+		for _, permission := range current.Permissions {
+			effective.Permissions = append(effective.Permissions, models.ResolvedPermission{
+				Permission: permission,
+				RoleID:     current.ID,
+				RoleName:   current.Name,
+			})
+		}
+
+		for _, parentID := range current.ParentIDs {
+			if visited[parentID] {
+				continue
+			}
+			visited[parentID] = true
+
+			parent, err := lookup(parentID)
+			if err != nil {
+				continue
+			}
+			queue = append(queue, parent)
+		}
+	}
+
+	return effective, nil
+}
+
+// EffectivePermissions returns the role's own and inherited permissions
+func (s *AuthService) EffectivePermissions(roleID primitive.ObjectID) ([]models.Permission, error) {
+	effective, err := s.ResolveRole(roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	return permissionsOf(effective), nil
+}
+
+func permissionsOf(effective *models.EffectivePermissions) []models.Permission {
+	permissions := make([]models.Permission, len(effective.Permissions))
+	for i, resolved := range effective.Permissions {
+		permissions[i] = resolved.Permission
+	}
+	return permissions
+}
+
+// ValidateRoleParents checks that the parents exist in the tenant and that
+// making them parents of roleID would not create an inheritance cycle. Use a
+// zero roleID for a role that doesn't exist yet.
+func (s *AuthService) ValidateRoleParents(tenantID, roleID primitive.ObjectID, parentIDs []primitive.ObjectID) error {
+	visited := make(map[primitive.ObjectID]bool)
+	stack := make([]primitive.ObjectID, 0, len(parentIDs))
+
+	roles := s.roleRepo.ForTenant(tenantID)
+	for _, parentID := range parentIDs {
+		if _, err := roles.GetByID(parentID); err != nil {
+			return fmt.Errorf("parent role %s not found", parentID.Hex())
+		}
+		stack = append(stack, parentID)
+	}
+
+	// Walk up from the new parents; reaching roleID means roleID would be its own ancestor
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if !roleID.IsZero() && id == roleID {
+			return fmt.Errorf("role inheritance cycle detected")
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+
+		role, err := s.roleRepo.GetByID(id)
+		if err != nil {
+			continue
+		}
+		stack = append(stack, role.ParentIDs...)
+	}
+
+	return nil
+}
+
+// UpdateRole saves changes to a role of the tenant. Taking away its admin
+// permissions, directly or through its parents, or deactivating it is
+// refused with ErrLastAdmin when no active administrator of the tenant
+// would be left.
+func (s *AuthService) UpdateRole(tenantID, roleID primitive.ObjectID, role *models.Role) error {
+	roles := s.roleRepo.ForTenant(tenantID)
+
+	adminRoleIDs, err := s.adminRoleIDs(tenantID)
+	if err != nil {
+		return err
+	}
+
+	// Resolve the tenant's admin roles as they will be after the update
+	lookup := func(id primitive.ObjectID) (*models.Role, error) {
+		if id == roleID {
+			updated := *role
+			updated.ID = roleID
+			return &updated, nil
+		}
+		return s.roleRepo.GetByID(id)
+	}
+
+	remaining := make([]primitive.ObjectID, 0, len(adminRoleIDs))
+	for _, id := range adminRoleIDs {
+		effective, err := resolveRole(id, lookup)
+		if err != nil {
+			return err
+		}
+		if isAdminRole(effective) {
+			remaining = append(remaining, id)
+		}
+	}
+
+	if len(remaining) == len(adminRoleIDs) {
+		return roles.Update(roleID, role)
+	}
+	return roles.UpdateKeepingAdmins(roleID, role, remaining)
+}
+
+// isAdminRole reports whether the resolved role passes RequireAdmin
+func isAdminRole(effective *models.EffectivePermissions) bool {
+	return managesRoles(permissionsOf(effective))
+}
+
+// DeleteRole deletes a role of the tenant that no user holds there. Users of
+// a role in use are moved to replacementID in the same transaction; pass a
+// zero replacementID to refuse deleting a role in use instead.
+func (s *AuthService) DeleteRole(tenantID, roleID, replacementID primitive.ObjectID) (int64, error) {
+	roles := s.roleRepo.ForTenant(tenantID)
+
+	role, err := roles.GetByID(roleID)
+	if err != nil {
+		return 0, fmt.Errorf("role not found")
+	}
+	if role.IsSystem {
+		return 0, ErrSystemRole
+	}
+	if role.TenantID != tenantID {
+		return 0, ErrSharedRole
+	}
+
+	holders, err := s.deletionHolders(tenantID, roleID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Holders are checked again in the same transaction as the deletion,
+	// someone may be assigned the role in the meantime
+	if len(holders) == 0 {
+		return roles.DeleteAndReassign(roleID, primitive.NilObjectID)
+	}
+
+	if replacementID.IsZero() {
+		return 0, ErrRoleInUse
+	}
+	if replacementID == roleID {
+		return 0, fmt.Errorf("replacement role must be a different role")
+	}
+
+	replacement, err := roles.GetByID(replacementID)
+	if err != nil {
+		return 0, fmt.Errorf("replacement role not found")
+	}
+	if !replacement.IsActive {
+		return 0, fmt.Errorf("replacement role is inactive")
+	}
+
+	// Every tenant that holds the role must keep an admin
+	checked := map[primitive.ObjectID]bool{}
+	for _, holder := range holders {
+		if checked[holder.TenantID] {
+			continue
+		}
+		checked[holder.TenantID] = true
+		if err := s.ensureAdminSurvivesDeletion(holder.TenantID, roleID, replacementID); err != nil {
+			return 0, err
+		}
+	}
+
+	reassigned, err := roles.DeleteAndReassign(roleID, replacementID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Tokens of the moved users name the deleted role, make them refresh
+	for _, holder := range holders {
+		if err := s.markRoleChanged(holder.UserID, holder.TenantID, replacementID.Hex()); err != nil {
+			return reassigned, err
+		}
+	}
+
+	return reassigned, nil
+}
+
+// ensureAdminSurvivesDeletion refuses to move the users of an admin role to
+// a non-admin role when no other admin role has an active user
+func (s *AuthService) ensureAdminSurvivesDeletion(tenantID, roleID, replacementID primitive.ObjectID) error {
+	isAdmin, err := s.IsAdminRole(roleID)
+	if err != nil || !isAdmin {
+		return err
+	}
+
+	staysAdmin, err := s.IsAdminRole(replacementID)
+	if err != nil || staysAdmin {
+		return err
+	}
+
+	adminRoleIDs, err := s.adminRoleIDs(tenantID)
+	if err != nil {
+		return err
+	}
+
+	others := make([]primitive.ObjectID, 0, len(adminRoleIDs))
+	for _, id := range adminRoleIDs {
+		if id != roleID {
+			others = append(others, id)
+		}
+	}
+
+	admins, err := s.countRoleHolders(tenantID, others)
+	if err != nil {
+		return err
+	}
+	if admins == 0 {
+		return ErrLastAdmin
+	}
+
+	return nil
+}
+
+// ExplainPermission reports whether the user's role and active role grants
+// allow the action on the resource, and which effective permissions decided
+// it. Ownership rules and grants scoped to one resource are not taken into
+// account.
+func (s *AuthService) ExplainPermission(userID primitive.ObjectID, resource, action string) (*models.PermissionExplanation, error) {
+	auth, err := s.authRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	role, err := s.roleRepo.GetByID(auth.RoleID)
+	if err != nil {
+		return nil, fmt.Errorf("role not found")
+	}
+
+	effective, err := s.ResolveRole(role.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Grants in the default scope add their role's permissions
+	candidates := effective.Permissions
+	grants, err := s.activeGrants(userID, primitive.NilObjectID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for _, grant := range grants {
+		if grant.ResourceID != "" {
+			continue
+		}
+		granted, err := s.ResolveRole(grant.RoleID)
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, granted.Permissions...)
+	}
+
+	requireMFA, err := s.RoleRequiresMFA(role.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	explanation := &models.PermissionExplanation{
+		UserID:     userID,
+		RoleID:     role.ID,
+		RoleName:   role.Name,
+		Resource:   resource,
+		Action:     action,
+		Registered: IsRegisteredPermission(resource, action),
+		RequireMFA: requireMFA,
+		Matched:    []models.ResolvedPermission{},
+	}
+
+	var allow, deny *models.ResolvedPermission
+	for i, resolved := range candidates {
+		if !resolved.Matches(resource, action) {
+			continue
+		}
+		explanation.Matched = append(explanation.Matched, resolved)
+		if resolved.IsDeny() && deny == nil {
+			deny = &candidates[i]
+		} else if !resolved.IsDeny() && allow == nil {
+			allow = &candidates[i]
+		}
+	}
+
+	switch {
+	case !auth.IsActive:
+		explanation.Reason = "the account is inactive"
+	case !role.IsActive:
+		explanation.Reason = fmt.Sprintf("role %s is inactive", role.Name)
+	case deny != nil:
+		explanation.Reason = fmt.Sprintf("denied by %s:%s on role %s", deny.Resource, deny.Action, deny.RoleName)
+	case allow != nil:
+		explanation.Allowed = true
+		explanation.Reason = fmt.Sprintf("allowed by %s:%s on role %s", allow.Resource, allow.Action, allow.RoleName)
+		if requireMFA {
+			explanation.Reason += ", once the user completes multi-factor authentication"
+		}
+	default:
+		explanation.Reason = fmt.Sprintf("no permission of role %s or its parents covers %s:%s", role.Name, resource, action)
+	}
+
+	return explanation, nil
+}
@@ -0,0 +1,322 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// unheldRoleRepository holds one role that nobody is assigned. Deleting it
+// fails with lateErr, as if someone was assigned it after the holder check.
+type unheldRoleRepository struct {
+	repository.RoleRepository
+	role        *models.Role
+	lateErr     error
+	replacement *primitive.ObjectID
+}
+
+func (r *unheldRoleRepository) ForTenant(tenantID primitive.ObjectID) repository.RoleRepository {
+	return r
+}
+
+func (r *unheldRoleRepository) GetByID(id primitive.ObjectID) (*models.Role, error) {
+	return r.role, nil
+}
+
+func (r *unheldRoleRepository) DeleteAndReassign(id, replacementID primitive.ObjectID) (int64, error) {
+	r.replacement = &replacementID
+	return 0, r.lateErr
+}
+
+type unheldAuthRepository struct {
+	repository.AuthRepository
+}
+
+func (unheldAuthRepository) ListByRoleID(roleID primitive.ObjectID) ([]*models.UserAuth, error) {
+	return nil, nil
+}
+
+type unheldMembershipRepository struct {
+	repository.MembershipRepository
+}
+
+func (unheldMembershipRepository) ListAllByRoleID(roleID primitive.ObjectID) ([]*models.Membership, error) {
+	return nil, nil
+}
+
+func TestDeleteUnheldRoleRechecksHolders(t *testing.T) {
+	tests := []struct {
+		name    string
+		lateErr error
+	}{
+		{"still unheld", nil},
+		{"assigned since the check", ErrRoleInUse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles := &unheldRoleRepository{
+				role:    &models.Role{ID: primitive.NewObjectID(), Name: "support", IsActive: true},
+				lateErr: tt.lateErr,
+			}
+			service := NewAuthService(Repositories{
+				Auth:        unheldAuthRepository{},
+				Roles:       roles,
+				Memberships: unheldMembershipRepository{},
+			}, nil, AuthConfig{JWTSecret: "test-secret"})
+
+			if _, err := service.DeleteRole(primitive.NilObjectID, roles.role.ID, primitive.NilObjectID); !errors.Is(err, tt.lateErr) {
+				t.Fatalf("DeleteRole() error = %v, want %v", err, tt.lateErr)
+			}
+			// The deletion itself must re-check, so it goes through DeleteAndReassign
+			if roles.replacement == nil || !roles.replacement.IsZero() {
+				t.Errorf("DeleteAndReassign() replacement = %v, want a zero ID", roles.replacement)
+			}
+		})
+	}
+}
+
+// sharedRoleCache records the role change markers. Role permissions are
+// never cached, so every check reads the roles.
+type sharedRoleCache struct {
+	cache.Cache
+	keys map[string]bool
+}
+
+func (c *sharedRoleCache) Get(key string, dest any) error { return redis.Nil }
+
+func (c *sharedRoleCache) Set(key string, value any, expiration time.Duration) error {
+	c.keys[key] = true
+	return nil
+}
+
+func (c *sharedRoleCache) SetWithTags(key string, value any, tags []string, expiration time.Duration) error {
+	return nil
+}
+
+func (c *sharedRoleCache) Exists(key string) (bool, error) {
+	return c.keys[key], nil
+}
+
+// sharedRoleStore holds shared roles, the accounts holding them and the
+// memberships holding them in organizations
+type sharedRoleStore struct {
+	roles       map[primitive.ObjectID]*models.Role
+	auths       map[primitive.ObjectID]*models.UserAuth
+	memberships []*models.Membership
+}
+
+func (s *sharedRoleStore) addRole(name string, permissions ...models.Permission) *models.Role {
+	role := &models.Role{ID: primitive.NewObjectID(), Name: name, Permissions: permissions, IsActive: true}
+	s.roles[role.ID] = role
+	return role
+}
+
+func (s *sharedRoleStore) addUser(roleID primitive.ObjectID) primitive.ObjectID {
+	userID := primitive.NewObjectID()
+	s.auths[userID] = &models.UserAuth{UserID: userID, RoleID: roleID, IsActive: true}
+	return userID
+}
+
+func (s *sharedRoleStore) addMembership(organizationID, userID, roleID primitive.ObjectID) *models.Membership {
+	membership := &models.Membership{OrganizationID: organizationID, UserID: userID, RoleID: roleID}
+	s.memberships = append(s.memberships, membership)
+	return membership
+}
+
+// sharedRoleRepository serves the shared roles to every tenant. Deleting a
+// role moves its accounts and its memberships in every organization.
+type sharedRoleRepository struct {
+	repository.RoleRepository
+	store *sharedRoleStore
+}
+
+func (r *sharedRoleRepository) ForTenant(tenantID primitive.ObjectID) repository.RoleRepository {
+	return r
+}
+
+func (r *sharedRoleRepository) GetByID(id primitive.ObjectID) (*models.Role, error) {
+	role, ok := r.store.roles[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return role, nil
+}
+
+func (r *sharedRoleRepository) List() ([]*models.Role, error) {
+	var roles []*models.Role
+	for _, role := range r.store.roles {
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+func (r *sharedRoleRepository) DeleteAndReassign(id, replacementID primitive.ObjectID) (int64, error) {
+	var reassigned int64
+	for _, auth := range r.store.auths {
+		if auth.RoleID == id {
+			auth.RoleID = replacementID
+			reassigned++
+		}
+	}
+	for _, membership := range r.store.memberships {
+		if membership.RoleID == id {
+			membership.RoleID = replacementID
+			reassigned++
+		}
+	}
+	delete(r.store.roles, id)
+	return reassigned, nil
+}
+
+type sharedRoleAuthRepository struct {
+	repository.AuthRepository
+	store *sharedRoleStore
+}
+
+func (r *sharedRoleAuthRepository) ListByRoleID(roleID primitive.ObjectID) ([]*models.UserAuth, error) {
+	var auths []*models.UserAuth
+	for _, auth := range r.store.auths {
+		if auth.RoleID == roleID {
+			auths = append(auths, auth)
+		}
+	}
+	return auths, nil
+}
+
+func (r *sharedRoleAuthRepository) CountActiveByRoleIDs(roleIDs []primitive.ObjectID) (int64, error) {
+	var count int64
+	for _, auth := range r.store.auths {
+		if auth.IsActive && containsID(roleIDs, auth.RoleID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type sharedRoleMembershipRepository struct {
+	repository.MembershipRepository
+	store *sharedRoleStore
+}
+
+func (r *sharedRoleMembershipRepository) ListAllByRoleID(roleID primitive.ObjectID) ([]*models.Membership, error) {
+	var memberships []*models.Membership
+	for _, membership := range r.store.memberships {
+		if membership.RoleID == roleID {
+			memberships = append(memberships, membership)
+		}
+	}
+	return memberships, nil
+}
+
+func (r *sharedRoleMembershipRepository) CountByRoleIDs(organizationID primitive.ObjectID, roleIDs []primitive.ObjectID) (int64, error) {
+	var count int64
+	for _, membership := range r.store.memberships {
+		if membership.OrganizationID == organizationID && containsID(roleIDs, membership.RoleID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func TestDeleteSharedRoleMovesMemberships(t *testing.T) {
+	orgA := primitive.NewObjectID()
+	orgB := primitive.NewObjectID()
+	adminPermission := models.NewPermission(models.ResourceRoles, models.ActionCreate)
+
+	tests := []struct {
+		name           string
+		deletedIsAdmin bool
+		replacement    bool
+		otherOrgAdmin  bool // each organization has another admin member
+		wantErr        error
+		wantReassigned int64
+		wantMoved      bool
+	}{
+		{"without replacement", false, false, false, ErrRoleInUse, 0, false},
+		{"with replacement", false, true, false, nil, 3, true},
+		{"last admin of an organization", true, true, false, ErrLastAdmin, 0, false},
+		{"organization keeps another admin", true, true, true, nil, 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &sharedRoleStore{
+				roles: map[primitive.ObjectID]*models.Role{},
+				auths: map[primitive.ObjectID]*models.UserAuth{},
+			}
+			memory := &sharedRoleCache{keys: map[string]bool{}}
+			service := NewAuthService(Repositories{
+				Auth:        &sharedRoleAuthRepository{store: store},
+				Roles:       &sharedRoleRepository{store: store},
+				Memberships: &sharedRoleMembershipRepository{store: store},
+			}, memory, AuthConfig{JWTSecret: "test-secret"})
+
+			var permissions []models.Permission
+			if tt.deletedIsAdmin {
+				permissions = append(permissions, adminPermission)
+			}
+			deleted := store.addRole("support", permissions...)
+			replacement := store.addRole("viewer")
+			admin := store.addRole("admin", adminPermission)
+
+			// A platform admin keeps the default scope administered
+			store.addUser(admin.ID)
+			accountHolder := store.addUser(deleted.ID)
+			memberA := store.addUser(replacement.ID)
+			memberB := store.addUser(replacement.ID)
+			moved := []*models.Membership{
+				store.addMembership(orgA, memberA, deleted.ID),
+				store.addMembership(orgB, memberB, deleted.ID),
+			}
+			if tt.otherOrgAdmin {
+				store.addMembership(orgA, store.addUser(replacement.ID), admin.ID)
+				store.addMembership(orgB, store.addUser(replacement.ID), admin.ID)
+			}
+
+			replacementID := primitive.NilObjectID
+			if tt.replacement {
+				replacementID = replacement.ID
+			}
+
+			reassigned, err := service.DeleteRole(primitive.NilObjectID, deleted.ID, replacementID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DeleteRole() error = %v, want %v", err, tt.wantErr)
+			}
+			if reassigned != tt.wantReassigned {
+				t.Errorf("DeleteRole() reassigned = %d, want %d", reassigned, tt.wantReassigned)
+			}
+
+			_, stillExists := store.roles[deleted.ID]
+			if stillExists == tt.wantMoved {
+				t.Errorf("role still exists = %v, want %v", stillExists, !tt.wantMoved)
+			}
+
+			wantRole := deleted.ID
+			if tt.wantMoved {
+				wantRole = replacement.ID
+			}
+			if got := store.auths[accountHolder].RoleID; got != wantRole {
+				t.Errorf("account role = %s, want %s", got.Hex(), wantRole.Hex())
+			}
+			for _, membership := range moved {
+				if membership.RoleID != wantRole {
+					t.Errorf("membership in %s role = %s, want %s",
+						membership.OrganizationID.Hex(), membership.RoleID.Hex(), wantRole.Hex())
+				}
+				changed, _ := memory.Exists(roleChangedKey(membership.UserID, membership.OrganizationID))
+				if changed != tt.wantMoved {
+					t.Errorf("membership in %s marked changed = %v, want %v",
+						membership.OrganizationID.Hex(), changed, tt.wantMoved)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sessionTouchInterval limits how often last_seen_at is written per session
+const sessionTouchInterval = time.Minute
+
+// startSession records a new signed-in device. Its ID starts the refresh token family.
+func (s *AuthService) startSession(userID primitive.ObjectID, mfa bool, ipAddress, userAgent string) (*models.Session, error) {
+	session := &models.Session{
+		UserID:    userID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		MFA:       mfa,
+		ExpiresAt: time.Now().Add(s.config.RefreshTokenTTL),
+	}
+
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// ListSessions returns the user's active sessions
+func (s *AuthService) ListSessions(userID primitive.ObjectID) ([]*models.Session, error) {
+	return s.sessionRepo.ListActiveByUserID(userID)
+}
+
+// RevokeSession signs one of the user's devices out
+func (s *AuthService) RevokeSession(userID, sessionID primitive.ObjectID) error {
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil || session.UserID != userID {
+		return fmt.Errorf("session not found")
+	}
+
+	return s.endSession(sessionID)
+}
+
+// endSession revokes the session, its refresh tokens and its access tokens
+func (s *AuthService) endSession(sessionID primitive.ObjectID) error {
+	if err := s.cache.Set(cache.RevokedSessionPrefix+sessionID.Hex(), true, s.config.AccessTokenTTL); err != nil {
+		return err
+	}
+
+	if err := s.refreshRepo.RevokeFamily(sessionID); err != nil {
+		return err
+	}
+
+	return s.sessionRepo.Revoke(sessionID)
+}
+
+// TouchSession records activity on a session, at most once per interval
+func (s *AuthService) TouchSession(sessionID string) {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return
+	}
+
+	key := cache.SessionSeenPrefix + sessionID
+	if seen, err := s.cache.Exists(key); err != nil || seen {
+		return
+	}
+
+	// Best effort; activity tracking must not fail the request
+	_ = s.cache.Set(key, true, sessionTouchInterval)
+	_ = s.sessionRepo.UpdateLastSeen(id)
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// rfc6238Secret is the SHA-1 key from the RFC 6238 test vectors, base32 encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits
+	tests := []struct {
+		name string
+		unix int64
+		want string
+	}{
+		{"59", 59, "287082"},
+		{"1111111109", 1111111109, "081804"},
+		{"1111111111", 1111111111, "050471"},
+		{"1234567890", 1234567890, "005924"},
+		{"2000000000", 2000000000, "279037"},
+		{"20000000000", 20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := totpCode(rfc6238Secret, uint64(tt.unix/totpPeriod))
+			if err != nil {
+				t.Fatalf("totpCode() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("totpCode() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := uint64(now.Unix() / totpPeriod)
+	codeAt := func(offset int) string {
+		code, _ := totpCode(rfc6238Secret, step+uint64(offset))
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep uint64
+		wantOK   bool
+	}{
+		{"current step", rfc6238Secret, codeAt(0), step, true},
+		{"previous step", rfc6238Secret, codeAt(-1), step - 1, true},
+		{"next step", rfc6238Secret, codeAt(1), step + 1, true},
+		{"two steps old", rfc6238Secret, codeAt(-2), 0, false},
+		{"two steps ahead", rfc6238Secret, codeAt(2), 0, false},
+		{"spaces are ignored", rfc6238Secret, codeAt(0)[:3] + " " + codeAt(0)[3:], step, true},
+		{"lowercase secret", strings.ToLower(rfc6238Secret), codeAt(0), step, true},
+		{"too short", rfc6238Secret, codeAt(0)[:5], 0, false},
+		{"too long", rfc6238Secret, codeAt(0) + "0", 0, false},
+		{"wrong code", rfc6238Secret, "000000", 0, false},
+		{"invalid secret", "not base32!", codeAt(0), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := validateTOTP(tt.secret, tt.code, now)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("validateTOTP() = (%d, %v), want (%d, %v)", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+// usedCodeCache remembers claimed TOTP steps. Nothing here expires.
+type usedCodeCache struct {
+	cache.Cache
+	claimed map[string]bool
+}
+
+func (c *usedCodeCache) SetNX(key string, value any, expiration time.Duration) (bool, error) {
+	if c.claimed[key] {
+		return false, nil
+	}
+	c.claimed[key] = true
+	return true, nil
+}
+
+func TestCheckTOTP(t *testing.T) {
+	service := NewAuthService(Repositories{}, &usedCodeCache{claimed: map[string]bool{}},
+		AuthConfig{JWTSecret: "test-secret", MFAEncryptionKey: "test-mfa-key"})
+	encrypted, err := encryptSecret(service.mfaKey, rfc6238Secret)
+	if err != nil {
+		t.Fatalf("encryptSecret() error = %v", err)
+	}
+	auth := &models.UserAuth{UserID: primitive.NewObjectID(), MFASecret: encrypted}
+	step := uint64(time.Now().Unix() / totpPeriod)
+	code, _ := totpCode(rfc6238Secret, step)
+	expired, _ := totpCode(rfc6238Secret, step-2)
+
+	// Each step is accepted once, then rejected as a replay
+	tests := []struct {
+		name string
+		auth *models.UserAuth
+		code string
+		want bool
+	}{
+		{"no secret", &models.UserAuth{UserID: auth.UserID}, code, false},
+		{"expired code", auth, expired, false},
+		{"first use", auth, code, true},
+		{"replayed", auth, code, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.checkTOTP(tt.auth, tt.code)
+			if err != nil {
+				t.Fatalf("checkTOTP() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("checkTOTP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		t.Fatalf("generateTOTPSecret() error = %v", err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("generateTOTPSecret() = %q, want 20 base32 encoded bytes", secret)
+	}
+
+	code, _ := totpCode(secret, uint64(time.Now().Unix()/totpPeriod))
+	if _, ok := validateTOTP(secret, code, time.Now()); !ok {
+		t.Errorf("validateTOTP() rejected the current code for a new secret")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := totpURI("Base API", "jane@example.com", rfc6238Secret)
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("totpURI() = %q, not a URL: %v", uri, err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" || parsed.Path != "/Base API:jane@example.com" {
+		t.Errorf("totpURI() = %q, want otpauth://totp/<issuer>:<account>", uri)
+	}
+
+	query := parsed.Query()
+	want := map[string]string{"secret": rfc6238Secret, "issuer": "Base API", "algorithm": "SHA1", "digits": "6", "period": "30"}
+	for key, value := range want {
+		if got := query.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
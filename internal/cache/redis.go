@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -11,14 +12,24 @@ import (
 
 type Cache interface {
 	Set(key string, value any, expiration time.Duration) error
+	// SetNX sets the key only if it doesn't exist yet and reports whether it did
+	SetNX(key string, value any, expiration time.Duration) (bool, error)
 	Get(key string, dest any) error
+	// GetDel reads the key and deletes it in one step
+	GetDel(key string, dest any) error
 	Delete(key string) error
 	Exists(key string) (bool, error)
 	Flush() error
+	// Counters for rate limiting. The expiration is set when the key is created.
+	Increment(key string, expiration time.Duration) (int64, error)
+	TTL(key string) (time.Duration, error)
 	// Additional methods for advanced caching
 	SetWithTags(key string, value any, tags []string, expiration time.Duration) error
 	InvalidateTag(tag string) error
 	InvalidateTags(tags []string) error
+	// Pub/sub for notifying other instances. Subscribe blocks until ctx is done.
+	Publish(channel, message string) error
+	Subscribe(ctx context.Context, channel string, handler func(message string)) error
 }
 
 type RedisCache struct {
@@ -53,6 +64,17 @@ func (r *RedisCache) Set(key string, value any, expiration time.Duration) error
 	return r.client.Set(ctx, key, data, expiration).Err()
 }
 
+func (r *RedisCache) SetNX(key string, value any, expiration time.Duration) (bool, error) {
+	ctx := context.Background()
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+
+	return r.client.SetNX(ctx, key, data, expiration).Result()
+}
+
 func (r *RedisCache) Get(key string, dest any) error {
 	ctx := context.Background()
 
@@ -64,6 +86,17 @@ func (r *RedisCache) Get(key string, dest any) error {
 	return json.Unmarshal([]byte(data), dest)
 }
 
+func (r *RedisCache) GetDel(key string, dest any) error {
+	ctx := context.Background()
+
+	data, err := r.client.GetDel(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(data), dest)
+}
+
 func (r *RedisCache) Delete(key string) error {
 	ctx := context.Background()
 	return r.client.Del(ctx, key).Err()
@@ -83,6 +116,32 @@ func (r *RedisCache) Flush() error {
 	return r.client.FlushDB(ctx).Err()
 }
 
+// incrementScript increments the counter and starts its window on the first
+// increment, in one step so a counter can never be left without an expiry.
+// Counters left without one by an earlier failure get a new window.
+var incrementScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 or redis.call("PTTL", KEYS[1]) == -1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+func (r *RedisCache) Increment(key string, expiration time.Duration) (int64, error) {
+	ctx := context.Background()
+	return incrementScript.Run(ctx, r.client, []string{key}, expiration.Milliseconds()).Int64()
+}
+
+func (r *RedisCache) TTL(key string) (time.Duration, error) {
+	ctx := context.Background()
+	return r.client.TTL(ctx, key).Result()
+}
+
+// IsNotFound reports whether err means the key does not exist
+func IsNotFound(err error) bool {
+	return errors.Is(err, redis.Nil)
+}
+
 // Advanced caching with tags
 func (r *RedisCache) SetWithTags(key string, value any, tags []string, expiration time.Duration) error {
 	ctx := context.Background()
@@ -147,13 +206,59 @@ func (r *RedisCache) InvalidateTags(tags []string) error {
 	return nil
 }
 
+func (r *RedisCache) Publish(channel, message string) error {
+	ctx := context.Background()
+	return r.client.Publish(ctx, channel, message).Err()
+}
+
+func (r *RedisCache) Subscribe(ctx context.Context, channel string, handler func(message string)) error {
+	pubsub := r.client.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	// Wait for the subscription to be confirmed before handling messages
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			handler(msg.Payload)
+		}
+	}
+}
+
 // Cache keys helpers
 const (
-	UserCachePrefix   = "user:"
-	RoleCachePrefix   = "role:"
-	UsersListTag      = "users:list"
-	UsersTag          = "users"
-	DefaultExpiration = 1 * time.Hour
-	LongExpiration    = 24 * time.Hour
-	ShortExpiration   = 10 * time.Minute
+	UserCachePrefix        = "user:"
+	RoleCachePrefix        = "role:"
+	RevokedTokenPrefix     = "revoked_token:"
+	RevokedUserPrefix      = "revoked_user:"
+	MFAUsedCodePrefix      = "mfa_used:"
+	LoginFailurePrefix     = "login_failures:"
+	LoginLockPrefix        = "login_lock:"
+	LoginDelayPrefix       = "login_delay:"
+	OAuthStatePrefix       = "oauth_state:"
+	RevokedSessionPrefix   = "revoked_session:"
+	SessionSeenPrefix      = "session_seen:"
+	MagicLinkRequestPrefix = "magic_link_requests:"
+	ResetRequestPrefix     = "password_reset_requests:"
+	ResetRequestIPPrefix   = "password_reset_ip:"
+	RolePermissionsPrefix  = "role_permissions:"
+	RolePermissionsTag     = "role_permissions"
+	RolePermissionsVersion = "role_permissions_version"
+	RoleChangesChannel     = "role_changes"
+	UserRoleChangedPrefix  = "user_role_changed:"
+	RoleGrantsPrefix       = "role_grants:"
+	UsersListTag           = "users:list"
+	UsersTag               = "users"
+	DefaultExpiration      = 1 * time.Hour
+	LongExpiration         = 24 * time.Hour
+	ShortExpiration        = 10 * time.Minute
 )
@@ -20,11 +20,13 @@ import (
 )
 
 type EmailService struct {
-	cache      cache.Cache
-	verifyRepo repository.VerificationRepository
-	logger     *logger.Logger
-	config     EmailConfig
-	ctx        context.Context
+	cache         cache.Cache
+	verifyRepo    repository.VerificationRepository
+	resetRepo     repository.PasswordResetRepository
+	magicLinkRepo repository.MagicLinkRepository
+	logger        *logger.Logger
+	config        EmailConfig
+	ctx           context.Context
 }
 
 type EmailConfig struct {
@@ -36,20 +38,29 @@ type EmailConfig struct {
 	FromName     string
 	TemplatesDir string
 	WorkerCount  int
+
+	// ResetPasswordURL is the page that receives the reset token as a query parameter
+	ResetPasswordURL string
+	// MagicLinkURL is the page that receives sign-in tokens as a query parameter
+	MagicLinkURL string
 }
 
 func NewEmailService(
 	verifyRepo repository.VerificationRepository,
+	resetRepo repository.PasswordResetRepository,
+	magicLinkRepo repository.MagicLinkRepository,
 	cache cache.Cache,
 	logger *logger.Logger,
 	config EmailConfig,
 ) *EmailService {
 	service := &EmailService{
-		cache:      cache,
-		verifyRepo: verifyRepo,
-		logger:     logger,
-		config:     config,
-		ctx:        context.Background(),
+		cache:         cache,
+		verifyRepo:    verifyRepo,
+		resetRepo:     resetRepo,
+		magicLinkRepo: magicLinkRepo,
+		logger:        logger,
+		config:        config,
+		ctx:           context.Background(),
 	}
 
 	// Start email processing workers
@@ -216,18 +227,19 @@ func (s *EmailService) updateEmailStatus(email *models.EmailMessage) error {
 	return nil
 }
 
-func (s *EmailService) VerifyEmail(token string) error {
+// VerifyEmail redeems a verification token and returns its record
+func (s *EmailService) VerifyEmail(token string) (*models.EmailVerification, error) {
 	verification, err := s.verifyRepo.GetByToken(token)
 	if err != nil {
-		return fmt.Errorf("invalid or expired verification token")
+		return nil, fmt.Errorf("invalid or expired verification token")
 	}
 
 	// Mark as used
 	if err := s.verifyRepo.MarkAsUsed(verification.ID); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return verification, nil
 }
 
 func (s *EmailService) generateToken(length int) (string, error) {
@@ -0,0 +1,106 @@
+package email
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const magicLinkTTL = 15 * time.Minute
+
+// SendMagicLinkEmail emails a single-use sign-in link. Requests over the
+// per-email rate limit are dropped.
+func (s *EmailService) SendMagicLinkEmail(userID primitive.ObjectID, email, name string) error {
+	if err := s.limitRequests(cache.MagicLinkRequestPrefix+strings.ToLower(email), maxEmailRequests); err != nil {
+		return fmt.Errorf("magic link %w for %s", err, email)
+	}
+
+	// Generate sign-in token
+	token, err := s.generateToken(48)
+	if err != nil {
+		return err
+	}
+
+	// Only the newest link should work
+	if err := s.magicLinkRepo.InvalidateByUserID(userID); err != nil {
+		return err
+	}
+
+	// Create magic link record, storing only the token hash
+	link := &models.MagicLink{
+		UserID:    userID,
+		Email:     email,
+		TokenHash: hashResetToken(token),
+		ExpiresAt: time.Now().Add(magicLinkTTL),
+		IsUsed:    false,
+	}
+
+	if err := s.magicLinkRepo.Create(link); err != nil {
+		return err
+	}
+
+	// Load email templates
+	htmlTemplate, err := s.loadTemplate("magic_link.html")
+	if err != nil {
+		return err
+	}
+
+	textTemplate, err := s.loadTemplate("magic_link.txt")
+	if err != nil {
+		return err
+	}
+
+	// Prepare template data
+	loginURL := fmt.Sprintf("%s?token=%s", s.config.MagicLinkURL, url.QueryEscape(token))
+	templateData := map[string]string{
+		"Name":     name,
+		"Email":    email,
+		"LoginURL": loginURL,
+	}
+
+	// Render templates
+	htmlBody, err := s.renderTemplate(htmlTemplate, templateData)
+	if err != nil {
+		return err
+	}
+
+	textBody, err := s.renderTemplate(textTemplate, templateData)
+	if err != nil {
+		return err
+	}
+
+	// Create email message
+	emailMsg := &models.EmailMessage{
+		ID:         s.generateMessageID(),
+		To:         email,
+		Subject:    "Your Sign-In Link",
+		BodyHTML:   htmlBody,
+		BodyText:   textBody,
+		Template:   models.TemplateMagicLink,
+		Variables:  templateData,
+		Status:     models.EmailStatusPending,
+		RetryCount: 0,
+		MaxRetries: 3,
+		Priority:   0, // High priority, the link is short-lived
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+
+	// Add to queue
+	return s.enqueueEmail(emailMsg)
+}
+
+// ConsumeMagicLinkToken redeems a sign-in token and returns its record
+func (s *EmailService) ConsumeMagicLinkToken(token string) (*models.MagicLink, error) {
+	link, err := s.magicLinkRepo.Consume(hashResetToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("invalid or expired sign-in link")
+	}
+
+	return link, nil
+}
@@ -0,0 +1,126 @@
+package email
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const passwordResetTTL = 1 * time.Hour
+
+// SendPasswordResetEmail emails a single-use reset link. Requests over the
+// per-email or per-IP rate limit are dropped.
+func (s *EmailService) SendPasswordResetEmail(userID primitive.ObjectID, email, name, ipAddress string) error {
+	if err := s.limitRequests(cache.ResetRequestPrefix+strings.ToLower(email), maxEmailRequests); err != nil {
+		return fmt.Errorf("password reset %w for %s", err, email)
+	}
+	if err := s.limitRequests(cache.ResetRequestIPPrefix+ipAddress, maxIPEmailRequests); err != nil {
+		return fmt.Errorf("password reset %w for %s", err, ipAddress)
+	}
+
+	// Generate reset token
+	token, err := s.generateToken(48)
+	if err != nil {
+		return err
+	}
+
+	// Only the newest reset link should work
+	if err := s.resetRepo.InvalidateByUserID(userID); err != nil {
+		return err
+	}
+
+	// Create reset record, storing only the token hash
+	reset := &models.PasswordReset{
+		UserID:    userID,
+		Email:     email,
+		TokenHash: hashResetToken(token),
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+		IsUsed:    false,
+	}
+
+	if err := s.resetRepo.Create(reset); err != nil {
+		return err
+	}
+
+	// Load email templates
+	htmlTemplate, err := s.loadTemplate("reset_password.html")
+	if err != nil {
+		return err
+	}
+
+	textTemplate, err := s.loadTemplate("reset_password.txt")
+	if err != nil {
+		return err
+	}
+
+	// Prepare template data
+	resetURL := fmt.Sprintf("%s?token=%s", s.config.ResetPasswordURL, url.QueryEscape(token))
+	templateData := map[string]string{
+		"Name":     name,
+		"Email":    email,
+		"ResetURL": resetURL,
+	}
+
+	// Render templates
+	htmlBody, err := s.renderTemplate(htmlTemplate, templateData)
+	if err != nil {
+		return err
+	}
+
+	textBody, err := s.renderTemplate(textTemplate, templateData)
+	if err != nil {
+		return err
+	}
+
+	// Create email message
+	emailMsg := &models.EmailMessage{
+		ID:         s.generateMessageID(),
+		To:         email,
+		Subject:    "Reset Your Password",
+		BodyHTML:   htmlBody,
+		BodyText:   textBody,
+		Template:   models.TemplateResetPassword,
+		Variables:  templateData,
+		Status:     models.EmailStatusPending,
+		RetryCount: 0,
+		MaxRetries: 3,
+		Priority:   0, // High priority, the link is short-lived
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+
+	// Add to queue
+	return s.enqueueEmail(emailMsg)
+}
+
+// LookupPasswordResetToken returns the record of a valid reset token without redeeming it
+func (s *EmailService) LookupPasswordResetToken(token string) (*models.PasswordReset, error) {
+	reset, err := s.resetRepo.GetValidByHash(hashResetToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("invalid or expired reset token")
+	}
+
+	return reset, nil
+}
+
+// ConsumePasswordResetToken redeems a reset token and returns its record
+func (s *EmailService) ConsumePasswordResetToken(token string) (*models.PasswordReset, error) {
+	reset, err := s.resetRepo.Consume(hashResetToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("invalid or expired reset token")
+	}
+
+	return reset, nil
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
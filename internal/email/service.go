@@ -1,6 +1,7 @@
 package email
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -8,7 +9,42 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	// At most maxEmailRequests emails of a kind are sent per address within
+	// emailRequestWindow, and at most maxIPEmailRequests per client IP
+	maxEmailRequests   = 5
+	maxIPEmailRequests = 20
+	emailRequestWindow = 1 * time.Hour
+)
+
+// ErrRateLimited is returned when an email is dropped because too many were
+// requested
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// limitRequests counts a request against key and fails with ErrRateLimited
+// once more than limit were made within emailRequestWindow
+func (s *EmailService) limitRequests(key string, limit int64) error {
+	count, err := s.cache.Increment(key, emailRequestWindow)
+	if err != nil {
+		return err
+	}
+	if count > limit {
+		return ErrRateLimited
+	}
+	return nil
+}
+
 func (s *EmailService) SendVerificationEmail(userID primitive.ObjectID, email, name string) error {
+	return s.sendVerification(userID, email, name, models.VerificationPurposeRegistration)
+}
+
+// SendEmailChangeVerification asks the user to confirm a new email address.
+// The change is applied only once the link is opened.
+func (s *EmailService) SendEmailChangeVerification(userID primitive.ObjectID, newEmail, name string) error {
+	return s.sendVerification(userID, newEmail, name, models.VerificationPurposeEmailChange)
+}
+
+func (s *EmailService) sendVerification(userID primitive.ObjectID, email, name, purpose string) error {
 	// Generate verification token
 	token, err := s.generateToken(32)
 	if err != nil {
@@ -20,6 +56,7 @@ func (s *EmailService) SendVerificationEmail(userID primitive.ObjectID, email, n
 		UserID:    userID,
 		Email:     email,
 		Token:     token,
+		Purpose:   purpose,
 		ExpiresAt: time.Now().Add(24 * time.Hour), // 24 hours
 		IsUsed:    false,
 	}
@@ -28,13 +65,18 @@ func (s *EmailService) SendVerificationEmail(userID primitive.ObjectID, email, n
 		return err
 	}
 
+	templateName, subject, emailTemplate := "verification", "Verify Your Email Address", models.TemplateVerification
+	if purpose == models.VerificationPurposeEmailChange {
+		templateName, subject, emailTemplate = "email_change", "Confirm Your New Email Address", models.TemplateEmailChange
+	}
+
 	// Load email templates
-	htmlTemplate, err := s.loadTemplate("verification.html")
+	htmlTemplate, err := s.loadTemplate(templateName + ".html")
 	if err != nil {
 		return err
 	}
 
-	textTemplate, err := s.loadTemplate("verification.txt")
+	textTemplate, err := s.loadTemplate(templateName + ".txt")
 	if err != nil {
 		return err
 	}
@@ -62,10 +104,10 @@ func (s *EmailService) SendVerificationEmail(userID primitive.ObjectID, email, n
 	emailMsg := &models.EmailMessage{
 		ID:         s.generateMessageID(),
 		To:         email,
-		Subject:    "Verify Your Email Address",
+		Subject:    subject,
 		BodyHTML:   htmlBody,
 		BodyText:   textBody,
-		Template:   models.TemplateVerification,
+		Template:   emailTemplate,
 		Variables:  templateData,
 		Status:     models.EmailStatusPending,
 		RetryCount: 0,
@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/madhiyono/base-api-nosql/internal/auth"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/pkg/response"
+	"github.com/madhiyono/base-api-nosql/pkg/validation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ChangePassword changes the authenticated user's password
+func (h *AccountHandler) ChangePassword(c echo.Context) error {
+	userID, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User Not Authenticated", nil)
+	}
+
+	request := new(models.ChangePasswordRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind Change Password Request: %v", err)
+		return response.BadRequest(c, "Failed to Change Password: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		validationErrors := validation.ValidateStructDetailed(request)
+		for _, vErr := range validationErrors {
+			h.logger.Error("Validation Error for Change Password: %s", vErr)
+		}
+		return response.BadRequest(c, "Failed to Change Password: Validation Error", nil)
+	}
+
+	if err := h.authService.ChangePassword(userID, request.CurrentPassword, request.NewPassword); err != nil {
+		h.logger.Error("Failed to Change Password: %v", err)
+		if _, ok := err.(*auth.PasswordPolicyError); ok {
+			return passwordRejected(c, "Failed to Change Password", err)
+		}
+		return response.Error(c, http.StatusUnauthorized, "Failed to Change Password: Invalid Current Password", nil)
+	}
+
+	// Existing sessions were opened with the old password
+	if err := h.authService.RevokeAllSessions(userID); err != nil {
+		h.logger.Error("Failed to revoke sessions after password change: %v", err)
+		return response.InternalServerError(c, "Failed to Change Password: Could Not Sign Out Existing Sessions", nil)
+	}
+	h.wsService.DisconnectUser(userID)
+
+	return response.Success(c, "Password Changed Successfully. Please log in again.", nil)
+}
+
+// ChangeEmail starts an email change, applied once the new address is verified
+func (h *AccountHandler) ChangeEmail(c echo.Context) error {
+	userID, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User Not Authenticated", nil)
+	}
+
+	request := new(models.ChangeEmailRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind Change Email Request: %v", err)
+		return response.BadRequest(c, "Failed to Change Email: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		validationErrors := validation.ValidateStructDetailed(request)
+		for _, vErr := range validationErrors {
+			h.logger.Error("Validation Error for Change Email: %s", vErr)
+		}
+		return response.BadRequest(c, "Failed to Change Email: Validation Error", nil)
+	}
+
+	if err := h.authService.VerifyPassword(userID, request.Password); err != nil {
+		return response.Error(c, http.StatusUnauthorized, "Failed to Change Email: Invalid Password", nil)
+	}
+
+	if _, err := h.authRepo.GetByEmail(request.NewEmail); err == nil {
+		return response.Error(c, http.StatusConflict, "Email is already in use", nil)
+	}
+
+	user, err := h.userRepo.GetByID(userID.Hex())
+	if err != nil {
+		return response.NotFound(c, "User Not Found")
+	}
+
+	if err := h.emailService.SendEmailChangeVerification(userID, request.NewEmail, user.Name); err != nil {
+		h.logger.Error("Failed to send email change verification: %v", err)
+		return response.InternalServerError(c, "Failed to send verification email", nil)
+	}
+
+	return response.Success(c, "Please check your new email address to confirm the change.", nil)
+}
+
+// EnrollMFA starts TOTP enrollment and returns the secret and otpauth URI
+func (h *AccountHandler) EnrollMFA(c echo.Context) error {
+	userID, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User Not Authenticated", nil)
+	}
+
+	request := new(models.MFAEnrollRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind MFA Enroll Request: %v", err)
+		return response.BadRequest(c, "Failed to Enroll MFA: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		return response.BadRequest(c, "Failed to Enroll MFA: Validation Error", nil)
+	}
+
+	enrollment, err := h.authService.EnrollMFA(userID, request.Password)
+	if err != nil {
+		h.logger.Error("Failed to Enroll MFA: %v", err)
+		return response.BadRequest(c, "Failed to Enroll MFA", nil)
+	}
+
+	return response.Success(c, "Scan the QR code with your authenticator app and confirm with a code", enrollment)
+}
+
+// ConfirmMFA enables MFA and returns the recovery codes
+func (h *AccountHandler) ConfirmMFA(c echo.Context) error {
+	userID, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User Not Authenticated", nil)
+	}
+
+	request := new(models.MFACodeRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind MFA Confirm Request: %v", err)
+		return response.BadRequest(c, "Failed to Confirm MFA: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		return response.BadRequest(c, "Failed to Confirm MFA: Validation Error", nil)
+	}
+
+	codes, err := h.authService.ConfirmMFA(userID, request.Code)
+	if err != nil {
+		h.logger.Error("Failed to Confirm MFA: %v", err)
+		return response.BadRequest(c, "Failed to Confirm MFA: Invalid Code", nil)
+	}
+
+	return response.Success(c, "MFA Enabled Successfully. Store these recovery codes somewhere safe.", models.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
+}
+
+// DisableMFA turns MFA off for the authenticated user
+func (h *AccountHandler) DisableMFA(c echo.Context) error {
+	userID, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User Not Authenticated", nil)
+	}
+
+	request := new(models.MFADisableRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind MFA Disable Request: %v", err)
+		return response.BadRequest(c, "Failed to Disable MFA: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		return response.BadRequest(c, "Failed to Disable MFA: Validation Error", nil)
+	}
+
+	if err := h.authService.DisableMFA(userID, request.Password, request.Code); err != nil {
+		h.logger.Error("Failed to Disable MFA: %v", err)
+		return response.Error(c, http.StatusUnauthorized, "Failed to Disable MFA: Invalid Credentials", nil)
+	}
+
+	// Sessions that passed MFA should not outlive it
+	if err := h.authService.RevokeAllSessions(userID); err != nil {
+		h.logger.Error("Failed to revoke sessions after disabling MFA: %v", err)
+		return response.InternalServerError(c, "Failed to Disable MFA: Could Not Sign Out Existing Sessions", nil)
+	}
+	h.wsService.DisconnectUser(userID)
+
+	return response.Success(c, "MFA Disabled Successfully. Please log in again.", nil)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes
+func (h *AccountHandler) RegenerateRecoveryCodes(c echo.Context) error {
+	userID, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User Not Authenticated", nil)
+	}
+
+	request := new(models.MFACodeRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind Recovery Codes Request: %v", err)
+		return response.BadRequest(c, "Failed to Regenerate Recovery Codes: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		return response.BadRequest(c, "Failed to Regenerate Recovery Codes: Validation Error", nil)
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(userID, request.Code)
+	if err != nil {
+		h.logger.Error("Failed to Regenerate Recovery Codes: %v", err)
+		return response.BadRequest(c, "Failed to Regenerate Recovery Codes: Invalid Code", nil)
+	}
+
+	return response.Success(c, "Recovery Codes Regenerated Successfully", models.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
+}
+
+// CreateAPIKey issues a new API key for the authenticated user
+func (h *AccountHandler) CreateAPIKey(c echo.Context) error {
+	userID, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User Not Authenticated", nil)
+	}
+
+	request := new(models.CreateAPIKeyRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind Create API Key Request: %v", err)
+		return response.BadRequest(c, "Failed to Create API Key: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		validationErrors := validation.ValidateStructDetailed(request)
+		for _, vErr := range validationErrors {
+			h.logger.Error("Validation Error for Create API Key: %s", vErr)
+		}
+		return response.BadRequest(c, "Failed to Create API Key: Validation Error", nil)
+	}
+
+	mfa := false
+	if claims, ok := c.Get("claims").(*models.Claims); ok {
+		mfa = claims.MFA
+	}
+
+	apiKey, key, err := h.authService.CreateAPIKey(userID, mfa, request)
+	if err != nil {
+		h.logger.Error("Failed to Create API Key: %v", err)
+		return response.BadRequest(c, "Failed to Create API Key: "+err.Error(), nil)
+	}
+
+	return response.Created(c, "API Key Created Successfully. Store the key somewhere safe, it will not be shown again.", models.CreateAPIKeyResponse{
+		Key:    key,
+		APIKey: apiKey,
+	})
+}
+
+// ListAPIKeys lists the authenticated user's API keys
+func (h *AccountHandler) ListAPIKeys(c echo.Context) error {
+	userID, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User Not Authenticated", nil)
+	}
+
+	apiKeys, err := h.authService.ListAPIKeys(userID)
+	if err != nil {
+		h.logger.Error("Failed to List API Keys: %v", err)
+		return response.InternalServerError(c, "Failed to Retrieve API Keys", nil)
+	}
+
+	return response.Success(c, "API Keys Retrieved Successfully", apiKeys)
+}
+
+// RevokeAPIKey revokes one of the authenticated user's API keys
+func (h *AccountHandler) RevokeAPIKey(c echo.Context) error {
+	userID, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User Not Authenticated", nil)
+	}
+
+	keyID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid API Key ID", nil)
+	}
+
+	if err := h.authService.RevokeAPIKey(userID, keyID); err != nil {
+		h.logger.Error("Failed to Revoke API Key: %v", err)
+		return response.NotFound(c, "API Key Not Found")
+	}
+
+	return response.Success(c, "API Key Revoked Successfully", nil)
+}
+
+// ListSessions lists the authenticated user's active sessions
+func (h *AccountHandler) ListSessions(c echo.Context) error {
+	userID, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User Not Authenticated", nil)
+	}
+
+	sessions, err := h.authService.ListSessions(userID)
+	if err != nil {
+		h.logger.Error("Failed to List Sessions: %v", err)
+		return response.InternalServerError(c, "Failed to Retrieve Sessions", nil)
+	}
+
+	currentSessionID, _ := c.Get("session_id").(string)
+	for _, session := range sessions {
+		session.Current = session.ID.Hex() == currentSessionID
+	}
+
+	return response.Success(c, "Sessions Retrieved Successfully", sessions)
+}
+
+// RevokeSession signs one of the authenticated user's sessions out
+func (h *AccountHandler) RevokeSession(c echo.Context) error {
+	userID, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User Not Authenticated", nil)
+	}
+
+	sessionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid Session ID", nil)
+	}
+
+	if err := h.authService.RevokeSession(userID, sessionID); err != nil {
+		h.logger.Error("Failed to Revoke Session: %v", err)
+		return response.NotFound(c, "Session Not Found")
+	}
+
+	h.wsService.DisconnectSession(userID, sessionID.Hex())
+
+	return response.Success(c, "Session Revoked Successfully", nil)
+}
+
+// Register account routes
+func (h *AccountHandler) RegisterRoutes(e *echo.Echo, authMiddleware *auth.Middleware) {
+	meGroup := e.Group("/me")
+	meGroup.Use(authMiddleware.JWTAuth)
+	// Account settings need an interactive session, not an API key
+	meGroup.Use(authMiddleware.DenyAPIKey)
+	// Nor may an impersonating admin change the user's credentials
+	meGroup.Use(authMiddleware.DenyImpersonation)
+	{
+		meGroup.PUT("/password", h.ChangePassword)
+		meGroup.PUT("/email", h.ChangeEmail)
+
+		meGroup.POST("/mfa/enroll", h.EnrollMFA)
+		meGroup.POST("/mfa/confirm", h.ConfirmMFA)
+		meGroup.POST("/mfa/disable", h.DisableMFA)
+		meGroup.POST("/mfa/recovery-codes", h.RegenerateRecoveryCodes)
+
+		meGroup.POST("/api-keys", h.CreateAPIKey)
+		meGroup.GET("/api-keys", h.ListAPIKeys)
+		meGroup.DELETE("/api-keys/:id", h.RevokeAPIKey)
+
+		meGroup.GET("/sessions", h.ListSessions)
+		meGroup.DELETE("/sessions/:id", h.RevokeSession)
+	}
+}
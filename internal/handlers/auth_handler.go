@@ -1,12 +1,19 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/madhiyono/base-api-nosql/internal/auth"
+	"github.com/madhiyono/base-api-nosql/internal/cache"
 	"github.com/madhiyono/base-api-nosql/internal/models"
 	"github.com/madhiyono/base-api-nosql/pkg/response"
 	"github.com/madhiyono/base-api-nosql/pkg/validation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // Register creates a new user account with email verification
@@ -31,6 +38,10 @@ func (h *AuthHandler) Register(c echo.Context) error {
 		return response.BadRequest(c, "User already exists", nil)
 	}
 
+	if err := h.authService.ValidatePassword(request.Password, request.Name, request.Email); err != nil {
+		return passwordRejected(c, "Failed to register", err)
+	}
+
 	// Create user
 	user := &models.User{
 		Name:  request.Name,
@@ -50,7 +61,7 @@ func (h *AuthHandler) Register(c echo.Context) error {
 	}
 
 	// Get default role (user role)
-	defaultRole, err := h.roleRepo.GetByName("user")
+	defaultRole, err := h.roleRepo.GetByName(models.DefaultRoleName)
 	if err != nil {
 		h.logger.Error("Default role not found: %v", err)
 		return response.InternalServerError(c, "Failed to process registration", nil)
@@ -87,14 +98,13 @@ func (h *AuthHandler) VerifyEmail(c echo.Context) error {
 	}
 
 	// Verify email token
-	if err := h.emailService.VerifyEmail(token); err != nil {
+	verification, err := h.emailService.VerifyEmail(token)
+	if err != nil {
 		return response.Error(c, http.StatusBadRequest, "Invalid or expired verification token", nil)
 	}
 
-	// Get verification record to get user ID
-	verification, err := h.verifyRepo.GetByToken(token)
-	if err != nil {
-		return response.Error(c, http.StatusBadRequest, "Invalid verification token", nil)
+	if verification.Purpose == models.VerificationPurposeEmailChange {
+		return h.confirmEmailChange(c, verification)
 	}
 
 	// Activate user account
@@ -106,6 +116,34 @@ func (h *AuthHandler) VerifyEmail(c echo.Context) error {
 	return response.Success(c, "Email verified successfully. Your account is now active.", nil)
 }
 
+// confirmEmailChange applies a verified email change to both the user and auth records
+func (h *AuthHandler) confirmEmailChange(c echo.Context, verification *models.EmailVerification) error {
+	// The address may have been taken while the link was pending
+	if existing, err := h.authRepo.GetByEmail(verification.Email); err == nil && existing.UserID != verification.UserID {
+		return response.Error(c, http.StatusConflict, "Email is already in use", nil)
+	}
+
+	if err := h.authRepo.UpdateEmail(verification.UserID, verification.Email); err != nil {
+		h.logger.Error("Failed to update auth email: %v", err)
+		return response.InternalServerError(c, "Failed to change email", nil)
+	}
+
+	if err := h.userRepo.UpdateEmail(verification.UserID.Hex(), verification.Email); err != nil {
+		h.logger.Error("Failed to update user email: %v", err)
+		return response.InternalServerError(c, "Failed to change email", nil)
+	}
+
+	// Invalidate cached user data in every organization
+	if err := h.cache.InvalidateTag(cache.UserCachePrefix + verification.UserID.Hex()); err != nil {
+		h.logger.Error("Failed to Delete Specific User Cache: %v", err)
+	}
+	if err := h.cache.InvalidateTag(cache.UsersListTag); err != nil {
+		h.logger.Error("Failed to Invalidate Users List Cache: %v", err)
+	}
+
+	return response.Success(c, "Email changed successfully.", nil)
+}
+
 // ResendVerification sends verification email again
 func (h *AuthHandler) ResendVerification(c echo.Context) error {
 	email := c.QueryParam("email")
@@ -158,22 +196,725 @@ func (h *AuthHandler) Login(c echo.Context) error {
 		return response.BadRequest(c, "Failed to Login: Validation Error", nil)
 	}
 
+	request.IPAddress = c.RealIP()
+	request.UserAgent = c.Request().UserAgent()
+
 	authResponse, err := h.authService.Login(request)
 	if err != nil {
 		h.logger.Error("Failed to Login User: %v", err)
+		if blocked, ok := err.(*auth.LoginBlockedError); ok {
+			return h.loginBlocked(c, blocked)
+		}
 		return response.Error(c, http.StatusUnauthorized, "Failed to Login: Invalid Credentials", nil)
 	}
 
+	if authResponse.MFARequired {
+		return response.Success(c, "Multi-Factor Authentication Required", authResponse)
+	}
+
+	return response.Success(c, "Login Successful", authResponse)
+}
+
+// VerifyMFA completes a login with a TOTP or recovery code
+func (h *AuthHandler) VerifyMFA(c echo.Context) error {
+	request := new(models.MFAVerifyRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind MFA Verify Request: %v", err)
+		return response.BadRequest(c, "Failed to Verify MFA: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		return response.BadRequest(c, "Failed to Verify MFA: Validation Error", nil)
+	}
+
+	request.IPAddress = c.RealIP()
+	request.UserAgent = c.Request().UserAgent()
+
+	authResponse, err := h.authService.VerifyMFA(request)
+	if err != nil {
+		h.logger.Error("Failed to Verify MFA: %v", err)
+		if blocked, ok := err.(*auth.LoginBlockedError); ok {
+			return h.loginBlocked(c, blocked)
+		}
+		return response.Error(c, http.StatusUnauthorized, "Failed to Verify MFA: Invalid Code", nil)
+	}
+
+	return response.Success(c, "Login Successful", authResponse)
+}
+
+// ListOAuthProviders returns the configured social login providers
+func (h *AuthHandler) ListOAuthProviders(c echo.Context) error {
+	return response.Success(c, "OAuth Providers Retrieved Successfully", h.oauthService.Providers())
+}
+
+// JWKS publishes the public token verification keys. The key set is served
+// as plain JSON (RFC 7517) rather than the response envelope so standard JWT
+// libraries can consume it.
+func (h *AuthHandler) JWKS(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, h.authService.JWKS())
+}
+
+// OAuthLogin redirects the user to the identity provider
+func (h *AuthHandler) OAuthLogin(c echo.Context) error {
+	authURL, signedState, err := h.oauthService.AuthCodeURL(c.Param("provider"))
+	if err != nil {
+		h.logger.Error("Failed to Start OAuth Login: %v", err)
+		return response.BadRequest(c, "Failed to Start OAuth Login", nil)
+	}
+
+	c.SetCookie(oauthStateCookie(c, signedState, int(auth.OAuthStateTTL.Seconds())))
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// oauthStateCookie ties a login to the browser that started it. Lax still
+// sends the cookie on the provider's top-level redirect back to the callback.
+func oauthStateCookie(c echo.Context, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     auth.OAuthStateCookie,
+		Value:    value,
+		Path:     "/auth/oauth",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// OAuthCallback completes a social login and returns the same response as Login
+func (h *AuthHandler) OAuthCallback(c echo.Context) error {
+	if providerError := c.QueryParam("error"); providerError != "" {
+		h.logger.Error("OAuth Provider Returned Error: %s", providerError)
+		return response.Error(c, http.StatusUnauthorized, "Failed to Login: Authorization Denied", nil)
+	}
+
+	var signedState string
+	if cookie, err := c.Cookie(auth.OAuthStateCookie); err == nil {
+		signedState = cookie.Value
+	}
+	// The state is single-use, so the cookie is no longer needed
+	c.SetCookie(oauthStateCookie(c, "", -1))
+
+	profile, err := h.oauthService.Exchange(c.Param("provider"), c.QueryParam("state"), signedState, c.QueryParam("code"))
+	if err != nil {
+		h.logger.Error("Failed to Complete OAuth Login: %v", err)
+		return response.Error(c, http.StatusUnauthorized, "Failed to Login: Invalid OAuth Response", nil)
+	}
+
+	authResponse, err := h.authService.LoginWithOAuth(profile, c.RealIP(), c.Request().UserAgent())
+	if err != nil {
+		h.logger.Error("Failed to Login With OAuth: %v", err)
+		return response.Error(c, http.StatusUnauthorized, "Failed to Login: Account Could Not Be Linked", nil)
+	}
+
+	if authResponse.MFARequired {
+		return response.Success(c, "Multi-Factor Authentication Required", authResponse)
+	}
+
 	return response.Success(c, "Login Successful", authResponse)
 }
 
+// loginBlocked answers a locked out or throttled login attempt
+func (h *AuthHandler) loginBlocked(c echo.Context, blocked *auth.LoginBlockedError) error {
+	retryAfter := int(math.Ceil(blocked.RetryAfter.Seconds()))
+	c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	if blocked.Locked {
+		return response.Error(c, http.StatusTooManyRequests, "Too Many Failed Login Attempts: Account Temporarily Locked", nil)
+	}
+	return response.Error(c, http.StatusTooManyRequests, "Too Many Failed Login Attempts: Please Wait Before Retrying", nil)
+}
+
+// Refresh exchanges a refresh token for a new token pair
+func (h *AuthHandler) Refresh(c echo.Context) error {
+	request := new(models.RefreshRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind Refresh Request: %v", err)
+		return response.BadRequest(c, "Failed to Refresh Token: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		return response.BadRequest(c, "Failed to Refresh Token: Validation Error", nil)
+	}
+
+	authResponse, err := h.authService.Refresh(request.RefreshToken)
+	if err != nil {
+		h.logger.Error("Failed to Refresh Token: %v", err)
+		return response.Error(c, http.StatusUnauthorized, "Failed to Refresh Token: Invalid or Expired Refresh Token", nil)
+	}
+
+	return response.Success(c, "Token Refreshed Successfully", authResponse)
+}
+
+// ForgotPassword sends a password reset link to the given email
+func (h *AuthHandler) ForgotPassword(c echo.Context) error {
+	request := new(models.ForgotPasswordRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind Forgot Password Request: %v", err)
+		return response.BadRequest(c, "Failed to Process Request: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		return response.BadRequest(c, "Failed to Process Request: Validation Error", nil)
+	}
+
+	// Always answer the same way so the endpoint can't be used to probe accounts
+	const message = "If the email exists, a password reset link has been sent."
+
+	auth, err := h.authRepo.GetByEmail(request.Email)
+	if err != nil {
+		return response.Success(c, message, nil)
+	}
+
+	user, err := h.userRepo.GetByID(auth.UserID.Hex())
+	if err != nil {
+		h.logger.Error("Failed to get user: %v", err)
+		return response.Success(c, message, nil)
+	}
+
+	if err := h.emailService.SendPasswordResetEmail(auth.UserID, auth.Email, user.Name, c.RealIP()); err != nil {
+		h.logger.Error("Failed to send password reset email: %v", err)
+	}
+
+	return response.Success(c, message, nil)
+}
+
+// RequestMagicLink emails a one-time sign-in link
+func (h *AuthHandler) RequestMagicLink(c echo.Context) error {
+	request := new(models.MagicLinkRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind Magic Link Request: %v", err)
+		return response.BadRequest(c, "Failed to Process Request: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		return response.BadRequest(c, "Failed to Process Request: Validation Error", nil)
+	}
+
+	// Always answer the same way so the endpoint can't be used to probe accounts
+	const message = "If the email exists, a sign-in link has been sent."
+
+	auth, err := h.authRepo.GetByEmail(request.Email)
+	if err != nil {
+		return response.Success(c, message, nil)
+	}
+
+	user, err := h.userRepo.GetByID(auth.UserID.Hex())
+	if err != nil {
+		h.logger.Error("Failed to get user: %v", err)
+		return response.Success(c, message, nil)
+	}
+
+	if err := h.emailService.SendMagicLinkEmail(auth.UserID, auth.Email, user.Name); err != nil {
+		h.logger.Error("Failed to send magic link email: %v", err)
+	}
+
+	return response.Success(c, message, nil)
+}
+
+// ConsumeMagicLink exchanges a sign-in link for tokens
+func (h *AuthHandler) ConsumeMagicLink(c echo.Context) error {
+	request := new(models.MagicLinkConsumeRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind Magic Link Consume Request: %v", err)
+		return response.BadRequest(c, "Failed to Login: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		return response.BadRequest(c, "Failed to Login: Validation Error", nil)
+	}
+
+	link, err := h.emailService.ConsumeMagicLinkToken(request.Token)
+	if err != nil {
+		return response.Error(c, http.StatusUnauthorized, "Failed to Login: Invalid or Expired Link", nil)
+	}
+
+	authResponse, err := h.authService.LoginWithMagicLink(link.UserID, c.RealIP(), c.Request().UserAgent())
+	if err != nil {
+		h.logger.Error("Failed to Login With Magic Link: %v", err)
+		return response.Error(c, http.StatusUnauthorized, "Failed to Login: Invalid or Expired Link", nil)
+	}
+
+	if authResponse.MFARequired {
+		return response.Success(c, "Multi-Factor Authentication Required", authResponse)
+	}
+
+	return response.Success(c, "Login Successful", authResponse)
+}
+
+// ResetPassword sets a new password using a reset token
+func (h *AuthHandler) ResetPassword(c echo.Context) error {
+	request := new(models.ResetPasswordRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind Reset Password Request: %v", err)
+		return response.BadRequest(c, "Failed to Reset Password: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		validationErrors := validation.ValidateStructDetailed(request)
+		for _, vErr := range validationErrors {
+			h.logger.Error("Validation Error for Reset Password: %s", vErr)
+		}
+		return response.BadRequest(c, "Failed to Reset Password: Validation Error", nil)
+	}
+
+	// Check the new password before the single-use token is spent
+	reset, err := h.emailService.LookupPasswordResetToken(request.Token)
+	if err != nil {
+		return response.BadRequest(c, "Invalid or expired reset token", nil)
+	}
+
+	name := ""
+	if user, err := h.userRepo.GetByID(reset.UserID.Hex()); err == nil {
+		name = user.Name
+	}
+
+	if err := h.authService.ValidatePassword(request.Password, name, reset.Email); err != nil {
+		return passwordRejected(c, "Failed to Reset Password", err)
+	}
+
+	reset, err = h.emailService.ConsumePasswordResetToken(request.Token)
+	if err != nil {
+		return response.BadRequest(c, "Invalid or expired reset token", nil)
+	}
+
+	hashedPassword, err := h.authService.HashPassword(request.Password)
+	if err != nil {
+		h.logger.Error("Failed to hash password: %v", err)
+		return response.InternalServerError(c, "Failed to Reset Password", nil)
+	}
+
+	if err := h.authRepo.UpdatePassword(reset.UserID, hashedPassword); err != nil {
+		h.logger.Error("Failed to update password: %v", err)
+		return response.InternalServerError(c, "Failed to Reset Password", nil)
+	}
+
+	// Sign the user out everywhere, whoever asked for the reset may hold a stolen session
+	if err := h.authService.RevokeAllSessions(reset.UserID); err != nil {
+		h.logger.Error("Failed to revoke sessions after password reset: %v", err)
+		return response.InternalServerError(c, "Failed to Reset Password: Could Not Sign Out Existing Sessions", nil)
+	}
+	h.wsService.DisconnectUser(reset.UserID)
+
+	return response.Success(c, "Password reset successfully. Please log in with your new password.", nil)
+}
+
+// passwordRejected reports the password policy violations, or a generic
+// error for anything else
+func passwordRejected(c echo.Context, action string, err error) error {
+	if policyErr, ok := err.(*auth.PasswordPolicyError); ok {
+		return response.BadRequestWithData(c, action+": Password Does Not Meet the Password Policy", policyErr)
+	}
+	return response.InternalServerError(c, action, nil)
+}
+
+// Logout revokes the current access token and optionally its refresh token
+func (h *AuthHandler) Logout(c echo.Context) error {
+	claims, ok := c.Get("claims").(*models.Claims)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User Not Authenticated", nil)
+	}
+
+	request := new(models.LogoutRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind Logout Request: %v", err)
+		return response.BadRequest(c, "Failed to Logout: Invalid Request Format", nil)
+	}
+
+	if err := h.authService.Logout(claims, request.RefreshToken); err != nil {
+		h.logger.Error("Failed to Logout User: %v", err)
+		return response.InternalServerError(c, "Failed to Logout", nil)
+	}
+
+	// Close the socket opened with this token or session, if any
+	h.wsService.DisconnectToken(claims.UserID, claims.ID)
+	h.wsService.DisconnectSession(claims.UserID, claims.SessionID)
+
+	return response.Success(c, "Logout Successful", nil)
+}
+
+// RevokeUserSessions revokes every token of a user (admin only)
+func (h *AuthHandler) RevokeUserSessions(c echo.Context) error {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid User ID", nil)
+	}
+
+	if _, err := h.authRepo.GetByUserID(userID); err != nil {
+		return response.NotFound(c, "User Not Found")
+	}
+
+	if err := h.authService.RevokeAllSessions(userID); err != nil {
+		h.logger.Error("Failed to Revoke User Sessions: %v", err)
+		return response.InternalServerError(c, "Failed to Revoke User Sessions", nil)
+	}
+
+	h.wsService.DisconnectUser(userID)
+
+	return response.Success(c, "User Sessions Revoked Successfully", nil)
+}
+
+// ListUserSessions lists a user's active sessions (admin only)
+func (h *AuthHandler) ListUserSessions(c echo.Context) error {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid User ID", nil)
+	}
+
+	if _, err := h.authRepo.GetByUserID(userID); err != nil {
+		return response.NotFound(c, "User Not Found")
+	}
+
+	sessions, err := h.authService.ListSessions(userID)
+	if err != nil {
+		h.logger.Error("Failed to List User Sessions: %v", err)
+		return response.InternalServerError(c, "Failed to Retrieve Sessions", nil)
+	}
+
+	return response.Success(c, "Sessions Retrieved Successfully", sessions)
+}
+
+// RevokeUserSession signs one of a user's sessions out (admin only)
+func (h *AuthHandler) RevokeUserSession(c echo.Context) error {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid User ID", nil)
+	}
+
+	sessionID, err := primitive.ObjectIDFromHex(c.Param("sessionId"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid Session ID", nil)
+	}
+
+	if err := h.authService.RevokeSession(userID, sessionID); err != nil {
+		h.logger.Error("Failed to Revoke User Session: %v", err)
+		return response.NotFound(c, "Session Not Found")
+	}
+
+	h.wsService.DisconnectSession(userID, sessionID.Hex())
+
+	return response.Success(c, "Session Revoked Successfully", nil)
+}
+
+// UnlockUser lifts a login lockout on a user's account (admin only)
+func (h *AuthHandler) UnlockUser(c echo.Context) error {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid User ID", nil)
+	}
+
+	actorID, _ := c.Get("user_id").(primitive.ObjectID)
+	if err := h.authService.UnlockAccount(userID, actorID); err != nil {
+		h.logger.Error("Failed to Unlock User: %v", err)
+		return response.NotFound(c, "User Not Found")
+	}
+
+	return response.Success(c, "User Unlocked Successfully", nil)
+}
+
+// GetLoginHistory returns a user's recent login events (admin only)
+func (h *AuthHandler) GetLoginHistory(c echo.Context) error {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid User ID", nil)
+	}
+
+	limit := int64(50)
+	if value, err := strconv.ParseInt(c.QueryParam("limit"), 10, 64); err == nil && value > 0 && value <= 500 {
+		limit = value
+	}
+
+	events, err := h.authService.LoginHistory(userID, limit)
+	if err != nil {
+		h.logger.Error("Failed to Get Login History: %v", err)
+		return response.InternalServerError(c, "Failed to Retrieve Login History", nil)
+	}
+
+	return response.Success(c, "Login History Retrieved Successfully", events)
+}
+
+// ImpersonateUser issues a short-lived token to act as another user (admin only)
+func (h *AuthHandler) ImpersonateUser(c echo.Context) error {
+	claims, ok := c.Get("claims").(*models.Claims)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User Not Authenticated", nil)
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid User ID", nil)
+	}
+
+	request := new(models.ImpersonateRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind Impersonate Request: %v", err)
+		return response.BadRequest(c, "Failed to Impersonate User: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		return response.BadRequest(c, "Failed to Impersonate User: A Reason is Required", nil)
+	}
+
+	authResponse, err := h.authService.Impersonate(claims, userID, request.Reason, c.RealIP())
+	if err != nil {
+		h.logger.Error("Failed to Impersonate User: %v", err)
+		switch {
+		case errors.Is(err, auth.ErrAlreadyImpersonating):
+			return response.Error(c, http.StatusForbidden, "Failed to Impersonate User: Already Impersonating", nil)
+		case errors.Is(err, auth.ErrImpersonateSelf):
+			return response.BadRequest(c, "Failed to Impersonate User: Cannot Impersonate Yourself", nil)
+		case errors.Is(err, auth.ErrImpersonationTargetNotFound):
+			return response.NotFound(c, "User Not Found")
+		case errors.Is(err, auth.ErrImpersonationTargetInactive):
+			return response.Error(c, http.StatusForbidden, "Failed to Impersonate User: Account Is Deactivated", nil)
+		case errors.Is(err, auth.ErrImpersonateAdmin):
+			return response.Error(c, http.StatusForbidden, "Failed to Impersonate User: Administrators Cannot Be Impersonated", nil)
+		}
+		return response.InternalServerError(c, "Failed to Impersonate User", nil)
+	}
+
+	h.logger.Info("User %s started impersonating user %s: %s", claims.UserID.Hex(), userID.Hex(), request.Reason)
+
+	return response.Success(c, "Impersonation Token Issued Successfully", authResponse)
+}
+
+// GetAuditLog returns audit entries where the user acted or was acted upon (admin only)
+func (h *AuthHandler) GetAuditLog(c echo.Context) error {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid User ID", nil)
+	}
+
+	limit := int64(50)
+	if value, err := strconv.ParseInt(c.QueryParam("limit"), 10, 64); err == nil && value > 0 && value <= 500 {
+		limit = value
+	}
+
+	entries, err := h.authService.AuditLog(userID, limit)
+	if err != nil {
+		h.logger.Error("Failed to Get Audit Log: %v", err)
+		return response.InternalServerError(c, "Failed to Retrieve Audit Log", nil)
+	}
+
+	return response.Success(c, "Audit Log Retrieved Successfully", entries)
+}
+
+// AssignUserRole changes a user's role (admin only)
+func (h *AuthHandler) AssignUserRole(c echo.Context) error {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid User ID", nil)
+	}
+
+	request := new(models.AssignRoleRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind Assign Role Request: %v", err)
+		return response.BadRequest(c, "Failed to Assign Role: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		return response.BadRequest(c, "Failed to Assign Role: Validation Error", nil)
+	}
+
+	roleID, err := primitive.ObjectIDFromHex(request.RoleID)
+	if err != nil {
+		return response.BadRequest(c, "Invalid Role ID", nil)
+	}
+
+	actorID, _ := c.Get("user_id").(primitive.ObjectID)
+	role, err := h.authService.AssignRole(auth.TenantID(c), actorID, userID, roleID, c.RealIP())
+	if err != nil {
+		h.logger.Error("Failed to Assign Role: %v", err)
+		switch {
+		case errors.Is(err, auth.ErrLastAdmin):
+			return response.Error(c, http.StatusConflict, "Failed to Assign Role: Cannot Demote the Last Administrator", nil)
+		case errors.Is(err, auth.ErrAssigneeNotFound):
+			return response.NotFound(c, "User Not Found")
+		case errors.Is(err, auth.ErrRoleNotFound):
+			return response.BadRequest(c, "Failed to Assign Role: Role Not Found", nil)
+		case errors.Is(err, auth.ErrRoleInactive):
+			return response.BadRequest(c, "Failed to Assign Role: Role Is Inactive", nil)
+		}
+		return response.InternalServerError(c, "Failed to Assign Role", nil)
+	}
+
+	// Drop cached copies of the user
+	if err := h.cache.InvalidateTag(cache.UserCachePrefix + userID.Hex()); err != nil {
+		h.logger.Error("Failed to Delete User Cache: %v", err)
+	}
+	if err := h.cache.InvalidateTag(cache.UsersListTag); err != nil {
+		h.logger.Error("Failed to Invalidate Users List Cache: %v", err)
+	}
+
+	h.wsService.BroadcastToUser(userID, models.WebSocketMessage{
+		Type:  "notification",
+		Event: "role_changed",
+		Data: map[string]any{
+			"role_id":   role.ID.Hex(),
+			"role_name": role.Name,
+		},
+		Timestamp: time.Now(),
+	})
+
+	h.logger.Info("User %s assigned role %s to user %s", actorID.Hex(), role.Name, userID.Hex())
+
+	return response.Success(c, "Role Assigned Successfully", role)
+}
+
+// CreateRoleGrant gives a user a role's permissions for a limited time (admin only)
+func (h *AuthHandler) CreateRoleGrant(c echo.Context) error {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid User ID", nil)
+	}
+
+	request := new(models.CreateRoleGrantRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind Role Grant Request: %v", err)
+		return response.BadRequest(c, "Failed to Grant Role: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		return response.BadRequest(c, "Failed to Grant Role: Validation Error", nil)
+	}
+
+	actorID, _ := c.Get("user_id").(primitive.ObjectID)
+	grant, err := h.authService.CreateRoleGrant(auth.TenantID(c), actorID, userID, request, c.RealIP())
+	if err != nil {
+		h.logger.Error("Failed to Grant Role: %v", err)
+		switch {
+		case errors.Is(err, auth.ErrAssigneeNotFound):
+			return response.NotFound(c, "User Not Found")
+		case errors.Is(err, auth.ErrInvalidGrantRole):
+			return response.BadRequest(c, "Invalid Role ID", nil)
+		case errors.Is(err, auth.ErrRoleNotFound):
+			return response.BadRequest(c, "Failed to Grant Role: Role Not Found", nil)
+		case errors.Is(err, auth.ErrRoleInactive):
+			return response.BadRequest(c, "Failed to Grant Role: Role Is Inactive", nil)
+		case errors.Is(err, auth.ErrGrantEndsBeforeStart):
+			return response.BadRequest(c, "Failed to Grant Role: Expiry Must Be After the Start", nil)
+		case errors.Is(err, auth.ErrGrantExpired):
+			return response.BadRequest(c, "Failed to Grant Role: Expiry Must Be in the Future", nil)
+		}
+		return response.InternalServerError(c, "Failed to Grant Role", nil)
+	}
+
+	h.logger.Info("User %s granted role %s to user %s until %s", actorID.Hex(), grant.RoleID.Hex(), userID.Hex(), grant.ExpiresAt.Format(time.RFC3339))
+
+	return response.Created(c, "Role Granted Successfully", grant)
+}
+
+// ListRoleGrants returns a user's role grants (admin only)
+func (h *AuthHandler) ListRoleGrants(c echo.Context) error {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid User ID", nil)
+	}
+
+	grants, err := h.authService.ListRoleGrants(auth.TenantID(c), userID)
+	if err != nil {
+		h.logger.Error("Failed to List Role Grants: %v", err)
+		return response.InternalServerError(c, "Failed to Retrieve Role Grants", nil)
+	}
+
+	return response.Success(c, "Role Grants Retrieved Successfully", grants)
+}
+
+// RevokeRoleGrant ends a role grant early (admin only)
+func (h *AuthHandler) RevokeRoleGrant(c echo.Context) error {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid User ID", nil)
+	}
+
+	grantID, err := primitive.ObjectIDFromHex(c.Param("grantId"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid Role Grant ID", nil)
+	}
+
+	actorID, _ := c.Get("user_id").(primitive.ObjectID)
+	if err := h.authService.RevokeRoleGrant(auth.TenantID(c), actorID, userID, grantID, c.RealIP()); err != nil {
+		h.logger.Error("Failed to Revoke Role Grant: %v", err)
+		if errors.Is(err, auth.ErrRoleGrantNotFound) {
+			return response.NotFound(c, "Role Grant Not Found")
+		}
+		return response.InternalServerError(c, "Failed to Revoke Role Grant", nil)
+	}
+
+	return response.Success(c, "Role Grant Revoked Successfully", nil)
+}
+
+// ExplainPermission answers whether a user may perform an action on a resource and why (admin only)
+func (h *AuthHandler) ExplainPermission(c echo.Context) error {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid User ID", nil)
+	}
+
+	resource := c.QueryParam("resource")
+	action := c.QueryParam("action")
+	if resource == "" || action == "" {
+		return response.BadRequest(c, "Resource and Action Are Required", nil)
+	}
+
+	explanation, err := h.authService.ExplainPermission(userID, resource, action)
+	if err != nil {
+		h.logger.Error("Failed to Explain Permission: %v", err)
+		return response.NotFound(c, "User Not Found")
+	}
+
+	return response.Success(c, "Permission Explained Successfully", explanation)
+}
+
 // Register auth routes
-func (h *AuthHandler) RegisterRoutes(e *echo.Echo) {
+func (h *AuthHandler) RegisterRoutes(e *echo.Echo, authMiddleware *auth.Middleware) {
+	e.GET("/.well-known/jwks.json", h.JWKS)
+
 	authGroup := e.Group("/auth")
 	{
 		authGroup.POST("/register", h.Register)
 		authGroup.GET("/verify/:token", h.VerifyEmail)
 		authGroup.POST("/resend-verification", h.ResendVerification)
 		authGroup.POST("/login", h.Login)
+		authGroup.POST("/mfa/verify", h.VerifyMFA)
+		authGroup.POST("/refresh", h.Refresh)
+		authGroup.GET("/oauth/providers", h.ListOAuthProviders)
+		authGroup.GET("/oauth/:provider/login", h.OAuthLogin)
+		authGroup.GET("/oauth/:provider/callback", h.OAuthCallback)
+		authGroup.POST("/logout", h.Logout, authMiddleware.JWTAuth)
+		authGroup.POST("/forgot-password", h.ForgotPassword)
+		authGroup.POST("/reset-password", h.ResetPassword)
+		authGroup.POST("/magic-link", h.RequestMagicLink)
+		authGroup.POST("/magic-link/consume", h.ConsumeMagicLink)
+	}
+
+	// Admin-only session management endpoints
+	adminAuthGroup := e.Group("/admin/users")
+	adminAuthGroup.Use(authMiddleware.JWTAuth)
+	adminAuthGroup.Use(authMiddleware.RequireAdmin())
+	adminAuthGroup.Use(authMiddleware.DenyImpersonation)
+	// Accounts are platform-wide, so organization admins can't manage them
+	adminAuthGroup.Use(authMiddleware.DenyTenant)
+	{
+		adminAuthGroup.POST("/:id/revoke-sessions", h.RevokeUserSessions)
+		adminAuthGroup.GET("/:id/sessions", h.ListUserSessions)
+		adminAuthGroup.DELETE("/:id/sessions/:sessionId", h.RevokeUserSession)
+		adminAuthGroup.POST("/:id/unlock", h.UnlockUser)
+		adminAuthGroup.GET("/:id/login-history", h.GetLoginHistory)
+		adminAuthGroup.GET("/:id/audit-log", h.GetAuditLog)
+		adminAuthGroup.GET("/:id/explain", h.ExplainPermission)
+		adminAuthGroup.POST("/:id/impersonate", h.ImpersonateUser, authMiddleware.DenyAPIKey)
+	}
+
+	// Role assignment and grants also work within an organization, for its members
+	roleAdminGroup := e.Group("/admin/users/:id")
+	roleAdminGroup.Use(authMiddleware.JWTAuth)
+	roleAdminGroup.Use(authMiddleware.RequireAdmin())
+	roleAdminGroup.Use(authMiddleware.DenyImpersonation)
+	{
+		roleAdminGroup.PUT("/role", h.AssignUserRole)
+		roleAdminGroup.POST("/grants", h.CreateRoleGrant)
+		roleAdminGroup.GET("/grants", h.ListRoleGrants)
+		roleAdminGroup.DELETE("/grants/:grantId", h.RevokeRoleGrant)
 	}
 }
@@ -33,15 +33,34 @@ func NewUserHandler(userRepo repository.UserRepository, authService *auth.AuthSe
 	}
 }
 
-func NewAuthHandler(authRepo repository.AuthRepository, verifyRepo repository.VerificationRepository, authService *auth.AuthService, emailService *email.EmailService, logger *logger.Logger) *AuthHandler {
+func NewAuthHandler(userRepo repository.UserRepository, roleRepo repository.RoleRepository, authRepo repository.AuthRepository, verifyRepo repository.VerificationRepository, authService *auth.AuthService, oauthService *auth.OAuthService, emailService *email.EmailService, wsService *services.WebSocketService, cache cache.Cache, logger *logger.Logger) *AuthHandler {
 	return &AuthHandler{
 		Handler: Handler{
+			userRepo:     userRepo,
+			roleRepo:     roleRepo,
 			authRepo:     authRepo,
 			verifyRepo:   verifyRepo,
 			authService:  authService,
 			emailService: emailService,
 			logger:       logger,
 		},
+		oauthService: oauthService,
+		wsService:    wsService,
+		cache:        cache,
+	}
+}
+
+func NewAccountHandler(userRepo repository.UserRepository, authRepo repository.AuthRepository, authService *auth.AuthService, emailService *email.EmailService, wsService *services.WebSocketService, cache cache.Cache, logger *logger.Logger) *AccountHandler {
+	return &AccountHandler{
+		Handler: Handler{
+			userRepo:     userRepo,
+			authRepo:     authRepo,
+			authService:  authService,
+			emailService: emailService,
+			logger:       logger,
+		},
+		wsService: wsService,
+		cache:     cache,
 	}
 }
 
@@ -55,6 +74,16 @@ func NewRoleHandler(roleRepo repository.RoleRepository, authService *auth.AuthSe
 	}
 }
 
+func NewOrganizationHandler(authService *auth.AuthService, cache cache.Cache, logger *logger.Logger) *OrganizationHandler {
+	return &OrganizationHandler{
+		Handler: Handler{
+			authService: authService,
+			logger:      logger,
+		},
+		cache: cache,
+	}
+}
+
 func NewEmailHandler(emailService *email.EmailService, logger *logger.Logger) *EmailHandler {
 	return &EmailHandler{
 		Handler: Handler{
@@ -80,12 +109,26 @@ type UserHandler struct {
 
 type AuthHandler struct {
 	Handler
+	oauthService *auth.OAuthService
+	wsService    *services.WebSocketService
+	cache        cache.Cache
+}
+
+type AccountHandler struct {
+	Handler
+	wsService *services.WebSocketService
+	cache     cache.Cache
 }
 
 type RoleHandler struct {
 	Handler
 }
 
+type OrganizationHandler struct {
+	Handler
+	cache cache.Cache
+}
+
 type EmailHandler struct {
 	Handler
 }
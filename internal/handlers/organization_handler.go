@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/madhiyono/base-api-nosql/internal/auth"
+	"github.com/madhiyono/base-api-nosql/internal/cache"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/pkg/response"
+	"github.com/madhiyono/base-api-nosql/pkg/validation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateOrganization creates an organization (platform admin only)
+func (h *OrganizationHandler) CreateOrganization(c echo.Context) error {
+	request := new(models.CreateOrganizationRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind Organization: %v", err)
+		return response.BadRequest(c, "Failed to Create Organization: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		return response.BadRequest(c, "Failed to Create Organization: Validation Error", nil)
+	}
+
+	creatorID, _ := c.Get("user_id").(primitive.ObjectID)
+	organization, err := h.authService.CreateOrganization(creatorID, request)
+	if err != nil {
+		h.logger.Error("Failed to Create Organization: %v", err)
+		return response.InternalServerError(c, "Failed to Create Organization", nil)
+	}
+
+	return response.Created(c, "Organization Created Successfully", organization)
+}
+
+// ListOrganizations returns every organization (platform admin only)
+func (h *OrganizationHandler) ListOrganizations(c echo.Context) error {
+	organizations, err := h.authService.ListOrganizations()
+	if err != nil {
+		h.logger.Error("Failed to List Organizations: %v", err)
+		return response.InternalServerError(c, "Failed to Retrieve Organizations", nil)
+	}
+
+	return response.Success(c, "Organizations Retrieved Successfully", organizations)
+}
+
+// ListMembers returns an organization's members (platform admin only)
+func (h *OrganizationHandler) ListMembers(c echo.Context) error {
+	organizationID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid Organization ID", nil)
+	}
+
+	memberships, err := h.authService.ListMembers(organizationID)
+	if err != nil {
+		return response.NotFound(c, "Organization Not Found")
+	}
+
+	return response.Success(c, "Organization Members Retrieved Successfully", memberships)
+}
+
+// AddMember adds a user to an organization or changes their role there (platform admin only)
+func (h *OrganizationHandler) AddMember(c echo.Context) error {
+	organizationID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid Organization ID", nil)
+	}
+
+	request := new(models.AddMemberRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind Add Member Request: %v", err)
+		return response.BadRequest(c, "Failed to Add Member: Invalid Request Format", nil)
+	}
+
+	if err := validation.ValidateStruct(request); err != nil {
+		return response.BadRequest(c, "Failed to Add Member: Validation Error", nil)
+	}
+
+	userID, err := primitive.ObjectIDFromHex(request.UserID)
+	if err != nil {
+		return response.BadRequest(c, "Invalid User ID", nil)
+	}
+
+	roleID, err := primitive.ObjectIDFromHex(request.RoleID)
+	if err != nil {
+		return response.BadRequest(c, "Invalid Role ID", nil)
+	}
+
+	membership, err := h.authService.AddMember(organizationID, userID, roleID)
+	if err != nil {
+		h.logger.Error("Failed to Add Member: %v", err)
+		return response.BadRequest(c, "Failed to Add Member: "+err.Error(), nil)
+	}
+
+	h.invalidateUser(userID)
+
+	return response.Success(c, "Member Added Successfully", membership)
+}
+
+// RemoveMember removes a user from an organization (platform admin only)
+func (h *OrganizationHandler) RemoveMember(c echo.Context) error {
+	organizationID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid Organization ID", nil)
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid User ID", nil)
+	}
+
+	if err := h.authService.RemoveMember(organizationID, userID); err != nil {
+		h.logger.Error("Failed to Remove Member: %v", err)
+		return response.NotFound(c, "Member Not Found")
+	}
+
+	h.invalidateUser(userID)
+
+	return response.Success(c, "Member Removed Successfully", nil)
+}
+
+// ListMyOrganizations returns the organizations of the authenticated user
+func (h *OrganizationHandler) ListMyOrganizations(c echo.Context) error {
+	userID, ok := c.Get("user_id").(primitive.ObjectID)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User Not Authenticated", nil)
+	}
+
+	organizations, err := h.authService.ListUserOrganizations(userID)
+	if err != nil {
+		h.logger.Error("Failed to List User Organizations: %v", err)
+		return response.InternalServerError(c, "Failed to Retrieve Organizations", nil)
+	}
+
+	return response.Success(c, "Organizations Retrieved Successfully", organizations)
+}
+
+// SwitchOrganization issues tokens acting within another organization
+func (h *OrganizationHandler) SwitchOrganization(c echo.Context) error {
+	claims, ok := c.Get("claims").(*models.Claims)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User Not Authenticated", nil)
+	}
+
+	request := new(models.SwitchOrganizationRequest)
+	if err := c.Bind(request); err != nil {
+		h.logger.Error("Failed to Bind Switch Organization Request: %v", err)
+		return response.BadRequest(c, "Failed to Switch Organization: Invalid Request Format", nil)
+	}
+
+	var organizationID primitive.ObjectID
+	if request.OrganizationID != "" {
+		var err error
+		organizationID, err = primitive.ObjectIDFromHex(request.OrganizationID)
+		if err != nil {
+			return response.BadRequest(c, "Invalid Organization ID", nil)
+		}
+	}
+
+	authResponse, err := h.authService.SwitchOrganization(claims, organizationID)
+	if err != nil {
+		h.logger.Error("Failed to Switch Organization: %v", err)
+		return response.Error(c, http.StatusForbidden, "Failed to Switch Organization: "+err.Error(), nil)
+	}
+
+	return response.Success(c, "Organization Switched Successfully", authResponse)
+}
+
+// invalidateUser drops cached copies of a user whose memberships changed
+func (h *OrganizationHandler) invalidateUser(userID primitive.ObjectID) {
+	if err := h.cache.InvalidateTag(cache.UserCachePrefix + userID.Hex()); err != nil {
+		h.logger.Error("Failed to Delete User Cache: %v", err)
+	}
+	if err := h.cache.InvalidateTag(cache.UsersListTag); err != nil {
+		h.logger.Error("Failed to Invalidate Users List Cache: %v", err)
+	}
+}
+
+// Register organization routes
+func (h *OrganizationHandler) RegisterRoutes(e *echo.Echo, authMiddleware *auth.Middleware) {
+	// Organizations are managed by platform admins, outside any organization
+	adminGroup := e.Group("/admin/organizations")
+	adminGroup.Use(authMiddleware.JWTAuth)
+	adminGroup.Use(authMiddleware.RequireAdmin())
+	adminGroup.Use(authMiddleware.DenyImpersonation)
+	adminGroup.Use(authMiddleware.DenyTenant)
+	{
+		adminGroup.POST("", h.CreateOrganization)
+		adminGroup.GET("", h.ListOrganizations)
+		adminGroup.GET("/:id/members", h.ListMembers)
+		adminGroup.POST("/:id/members", h.AddMember)
+		adminGroup.DELETE("/:id/members/:userId", h.RemoveMember)
+	}
+
+	// Switching needs an interactive session, not an API key
+	e.GET("/me/organizations", h.ListMyOrganizations, authMiddleware.JWTAuth, authMiddleware.DenyAPIKey, authMiddleware.DenyImpersonation)
+	e.POST("/auth/switch-organization", h.SwitchOrganization, authMiddleware.JWTAuth, authMiddleware.DenyAPIKey, authMiddleware.DenyImpersonation)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/pkg/response"
+)
+
+// Page sizes for list endpoints
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// parsePageQuery reads limit, offset, cursor and sort from the query string.
+// sort is a field name, prefixed with "-" for descending order.
+func parsePageQuery(c echo.Context, defaultSort string) (models.PageQuery, error) {
+	query := models.PageQuery{Limit: defaultPageLimit, Sort: defaultSort}
+
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		query.Limit = limit
+	}
+
+	if value := c.QueryParam("offset"); value != "" {
+		offset, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || offset < 0 {
+			return query, fmt.Errorf("offset must be a non-negative number")
+		}
+		query.Offset = offset
+	}
+
+	query.Cursor = c.QueryParam("cursor")
+	if query.Cursor != "" && query.Offset > 0 {
+		return query, fmt.Errorf("use either cursor or offset")
+	}
+
+	if value := c.QueryParam("sort"); value != "" {
+		query.Sort = strings.TrimPrefix(value, "-")
+		query.Desc = strings.HasPrefix(value, "-")
+	}
+
+	return query, nil
+}
+
+// parseTimeParam reads an optional RFC 3339 timestamp from the query string
+func parseTimeParam(c echo.Context, name string) (time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+	}
+	return parsed, nil
+}
+
+// pageMeta builds the response meta block for a page
+func pageMeta(query models.PageQuery, page *models.Page) response.Meta {
+	return response.Meta{
+		Total:      page.Total,
+		Limit:      query.Limit,
+		Offset:     query.Offset,
+		NextCursor: page.NextCursor,
+	}
+}
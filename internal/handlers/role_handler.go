@@ -1,13 +1,24 @@
 package handlers
 
 import (
+	"errors"
+	"net/http"
+	"strconv"
+
 	"github.com/labstack/echo/v4"
+	"github.com/madhiyono/base-api-nosql/internal/auth"
 	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
 	"github.com/madhiyono/base-api-nosql/pkg/response"
 	"github.com/madhiyono/base-api-nosql/pkg/validation"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// roles returns the role repository scoped to the caller's organization
+func (h *RoleHandler) roles(c echo.Context) repository.RoleRepository {
+	return h.roleRepo.ForTenant(auth.TenantID(c))
+}
+
 // CreateRole creates a new role (admin only)
 func (h *RoleHandler) CreateRole(c echo.Context) error {
 	role := new(models.Role)
@@ -25,7 +36,25 @@ func (h *RoleHandler) CreateRole(c echo.Context) error {
 		return response.BadRequest(c, "Failed to Create Role: Validation Error", nil)
 	}
 
-	if err := h.roleRepo.Create(role); err != nil {
+	if err := auth.ValidatePermissions(role.Permissions); err != nil {
+		return response.BadRequest(c, "Failed to Create Role: "+err.Error(), nil)
+	}
+
+	if err := h.authService.ValidateRoleParents(auth.TenantID(c), primitive.NilObjectID, role.ParentIDs); err != nil {
+		return response.BadRequest(c, "Failed to Create Role: "+err.Error(), nil)
+	}
+
+	if !auth.TenantID(c).IsZero() && models.IsReservedRoleName(role.Name) {
+		return response.BadRequest(c, "Failed to Create Role: Reserved Role Name", nil)
+	}
+
+	// System roles are only flagged at startup
+	role.IsSystem = false
+
+	if err := h.roles(c).Create(role); err != nil {
+		if errors.Is(err, repository.ErrRoleNameTaken) {
+			return response.Error(c, http.StatusConflict, "Failed to Create Role: Role Name Already Exists", nil)
+		}
 		h.logger.Error("Failed to Create Role: %v", err)
 		return response.InternalServerError(c, "Failed to Create Role", err)
 	}
@@ -40,7 +69,7 @@ func (h *RoleHandler) GetRole(c echo.Context) error {
 		return response.BadRequest(c, "Invalid Role ID", nil)
 	}
 
-	role, err := h.roleRepo.GetByID(id)
+	role, err := h.roles(c).GetByID(id)
 	if err != nil {
 		h.logger.Error("Failed to Get Role: %v", err)
 		return response.NotFound(c, "Role Not Found")
@@ -49,6 +78,46 @@ func (h *RoleHandler) GetRole(c echo.Context) error {
 	return response.Success(c, "Role Retrieved Successfully", role)
 }
 
+// GetRolePermissions returns the role's permissions resolved through its parents (admin only)
+func (h *RoleHandler) GetRolePermissions(c echo.Context) error {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid Role ID", nil)
+	}
+
+	if _, err := h.roles(c).GetByID(id); err != nil {
+		return response.NotFound(c, "Role Not Found")
+	}
+
+	effective, err := h.authService.ResolveRole(id)
+	if err != nil {
+		h.logger.Error("Failed to Resolve Role Permissions: %v", err)
+		return response.NotFound(c, "Role Not Found")
+	}
+
+	return response.Success(c, "Role Permissions Retrieved Successfully", effective)
+}
+
+// ListRoleUsers returns the users holding a role (admin only)
+func (h *RoleHandler) ListRoleUsers(c echo.Context) error {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid Role ID", nil)
+	}
+
+	if _, err := h.roles(c).GetByID(id); err != nil {
+		return response.NotFound(c, "Role Not Found")
+	}
+
+	members, err := h.authService.ListUsersByRole(auth.TenantID(c), id)
+	if err != nil {
+		h.logger.Error("Failed to List Role Users: %v", err)
+		return response.InternalServerError(c, "Failed to Retrieve Role Users", err)
+	}
+
+	return response.Success(c, "Role Users Retrieved Successfully", members)
+}
+
 // UpdateRole updates an existing role (admin only)
 func (h *RoleHandler) UpdateRole(c echo.Context) error {
 	id, err := primitive.ObjectIDFromHex(c.Param("id"))
@@ -71,11 +140,44 @@ func (h *RoleHandler) UpdateRole(c echo.Context) error {
 		return response.BadRequest(c, "Failed to Update Role: Validation Error", nil)
 	}
 
-	if err := h.roleRepo.Update(id, role); err != nil {
+	existing, err := h.roles(c).GetByID(id)
+	if err != nil {
+		return response.NotFound(c, "Role Not Found")
+	}
+	if existing.TenantID != auth.TenantID(c) {
+		return response.Error(c, http.StatusForbidden, "Failed to Update Role: Shared Roles Cannot Be Changed Within an Organization", nil)
+	}
+	if existing.IsSystem && role.Name != existing.Name {
+		return response.Error(c, http.StatusForbidden, "Failed to Update Role: System Roles Cannot Be Renamed", nil)
+	}
+	role.IsSystem = existing.IsSystem
+	if !auth.TenantID(c).IsZero() && models.IsReservedRoleName(role.Name) {
+		return response.BadRequest(c, "Failed to Update Role: Reserved Role Name", nil)
+	}
+
+	if err := auth.ValidatePermissions(role.Permissions); err != nil {
+		return response.BadRequest(c, "Failed to Update Role: "+err.Error(), nil)
+	}
+
+	if err := h.authService.ValidateRoleParents(auth.TenantID(c), id, role.ParentIDs); err != nil {
+		return response.BadRequest(c, "Failed to Update Role: "+err.Error(), nil)
+	}
+
+	if err := h.authService.UpdateRole(auth.TenantID(c), id, role); err != nil {
+		if errors.Is(err, repository.ErrRoleNameTaken) {
+			return response.Error(c, http.StatusConflict, "Failed to Update Role: Role Name Already Exists", nil)
+		}
+		if errors.Is(err, auth.ErrLastAdmin) {
+			return response.Error(c, http.StatusConflict, "Failed to Update Role: Cannot Remove the Last Administrator", nil)
+		}
 		h.logger.Error("Failed to Update Role: %v", err)
 		return response.InternalServerError(c, "Failed to Update Role", err)
 	}
 
+	if err := h.authService.InvalidateRolePermissions(id); err != nil {
+		h.logger.Error("Failed to Invalidate Role Permissions: %v", err)
+	}
+
 	return response.Success(c, "Role Updated Successfully", role)
 }
 
@@ -86,21 +188,72 @@ func (h *RoleHandler) DeleteRole(c echo.Context) error {
 		return response.BadRequest(c, "Invalid Role ID", nil)
 	}
 
-	if err := h.roleRepo.Delete(id); err != nil {
+	// Users of the role are moved to the replacement, if one is given
+	var replacementID primitive.ObjectID
+	if value := c.QueryParam("replacement_role_id"); value != "" {
+		replacementID, err = primitive.ObjectIDFromHex(value)
+		if err != nil {
+			return response.BadRequest(c, "Invalid Replacement Role ID", nil)
+		}
+	}
+
+	if _, err := h.roles(c).GetByID(id); err != nil {
+		return response.NotFound(c, "Role Not Found")
+	}
+
+	reassigned, err := h.authService.DeleteRole(auth.TenantID(c), id, replacementID)
+	if err != nil {
 		h.logger.Error("Failed to Delete Role: %v", err)
-		return response.InternalServerError(c, "Failed to Delete Role", err)
+		switch {
+		case errors.Is(err, auth.ErrSharedRole):
+			return response.Error(c, http.StatusForbidden, "Failed to Delete Role: Shared Roles Cannot Be Changed Within an Organization", nil)
+		case errors.Is(err, auth.ErrSystemRole):
+			return response.Error(c, http.StatusForbidden, "Failed to Delete Role: System Roles Cannot Be Deleted", nil)
+		case errors.Is(err, auth.ErrRoleInUse):
+			return response.Error(c, http.StatusConflict, "Failed to Delete Role: Role Is Assigned to Users, Provide a replacement_role_id", nil)
+		case errors.Is(err, auth.ErrLastAdmin):
+			return response.Error(c, http.StatusConflict, "Failed to Delete Role: Cannot Demote the Last Administrator", nil)
+		}
+		return response.BadRequest(c, "Failed to Delete Role: "+err.Error(), nil)
+	}
+
+	if err := h.authService.InvalidateRolePermissions(id); err != nil {
+		h.logger.Error("Failed to Invalidate Role Permissions: %v", err)
 	}
 
-	return response.Success(c, "Role Deleted Successfully", nil)
+	return response.Success(c, "Role Deleted Successfully", map[string]int64{"reassigned_users": reassigned})
 }
 
-// ListRoles returns all roles (admin only)
+// ListPermissionCatalog returns the permissions roles may grant (admin only)
+func (h *RoleHandler) ListPermissionCatalog(c echo.Context) error {
+	return response.Success(c, "Permission Catalog Retrieved Successfully", auth.RegisteredPermissions())
+}
+
+// ListRoles returns a page of roles filtered by name and status, sorted by
+// name or created_at (admin only)
 func (h *RoleHandler) ListRoles(c echo.Context) error {
-	roles, err := h.roleRepo.List()
+	query, err := parsePageQuery(c, "name")
 	if err != nil {
+		return response.BadRequest(c, "Failed to Retrieve Roles: "+err.Error(), nil)
+	}
+
+	filter := models.RoleFilter{Name: c.QueryParam("name")}
+	if value := c.QueryParam("is_active"); value != "" {
+		isActive, err := strconv.ParseBool(value)
+		if err != nil {
+			return response.BadRequest(c, "Failed to Retrieve Roles: is_active must be true or false", nil)
+		}
+		filter.IsActive = &isActive
+	}
+
+	roles, page, err := h.roles(c).ListPage(filter, query)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) || errors.Is(err, repository.ErrInvalidSort) {
+			return response.BadRequest(c, "Failed to Retrieve Roles: "+err.Error(), nil)
+		}
 		h.logger.Error("Failed to List Roles: %v", err)
 		return response.InternalServerError(c, "Failed to Retrieve Roles", err)
 	}
 
-	return response.Success(c, "Roles Retrieved Successfully", roles)
+	return response.Paginated(c, "Roles Retrieved Successfully", roles, pageMeta(query, page))
 }
@@ -1,18 +1,50 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/labstack/echo/v4"
+	"github.com/madhiyono/base-api-nosql/internal/auth"
 	"github.com/madhiyono/base-api-nosql/internal/cache"
 	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
 	"github.com/madhiyono/base-api-nosql/pkg/response"
 	"github.com/madhiyono/base-api-nosql/pkg/validation"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// users returns the user repository scoped to the caller's organization
+func (h *UserHandler) users(c echo.Context) repository.UserRepository {
+	return h.userRepo.ForTenant(auth.TenantID(c))
+}
+
+// userWriter returns the repository to change a user with, or nil when the
+// caller's organization shares the account with another organization. Users
+// can always change their own account.
+func (h *UserHandler) userWriter(c echo.Context, user *models.User) repository.UserRepository {
+	if callerID, ok := c.Get("user_id").(primitive.ObjectID); ok && callerID == user.ID {
+		return h.userRepo
+	}
+
+	tenantID := auth.TenantID(c)
+	if !user.BelongsOnlyTo(tenantID) {
+		return nil
+	}
+	return h.userRepo.ForTenant(tenantID)
+}
+
+// userCacheKeyFor keys cached users by organization so a copy read in one
+// organization is never served to another
+func userCacheKeyFor(tenantID primitive.ObjectID, id string) string {
+	if tenantID.IsZero() {
+		return fmt.Sprintf("%s%s", cache.UserCachePrefix, id)
+	}
+	return fmt.Sprintf("%s%s:%s", cache.UserCachePrefix, tenantID.Hex(), id)
+}
+
 // In CreateUser method, you might want to check if the authenticated user has permission
 // to create other users (admin-only functionality)
 func (h *UserHandler) CreateUser(c echo.Context) error {
@@ -32,7 +64,7 @@ func (h *UserHandler) CreateUser(c echo.Context) error {
 		return response.BadRequest(c, "Failed to Create User: Validation Error", nil)
 	}
 
-	if err := h.userRepo.Create(user); err != nil {
+	if err := h.users(c).Create(user); err != nil {
 		h.logger.Error("Failed to Create User: %v", err)
 		return response.InternalServerError(c, "Failed to Create User: Internal Server Error", nil)
 	}
@@ -50,7 +82,7 @@ func (h *UserHandler) GetUser(c echo.Context) error {
 	id := c.Param("id")
 
 	// Try to get user from cache first
-	cacheKey := fmt.Sprintf("%s%s", cache.UserCachePrefix, id)
+	cacheKey := userCacheKeyFor(auth.TenantID(c), id)
 
 	var cachedUser models.User
 	if err := h.cache.Get(cacheKey, &cachedUser); err == nil {
@@ -59,23 +91,14 @@ func (h *UserHandler) GetUser(c echo.Context) error {
 	}
 
 	// If not in cache, get from database
-	user, err := h.userRepo.GetByID(id)
+	user, err := h.users(c).GetByID(id)
 	if err != nil {
 		h.logger.Error("Failed to Get User: %v", err)
 		return response.NotFound(c, "User Not Found")
 	}
 
-	// Check if user is trying to access their own profile or has permission
-	authUserID, _ := c.Get("user_id").(primitive.ObjectID)
-	roleID := c.Get("role_id").(primitive.ObjectID)
-
-	hasAdminPermission, _ := h.authService.HasPermission(roleID, "users", "read")
-	if user.ID != authUserID && !hasAdminPermission {
-		return response.Error(c, http.StatusForbidden, "Access Denied to This User Record", nil)
-	}
-
 	// Cache the user data with tags for easy invalidation
-	tags := []string{cache.UsersTag}
+	tags := []string{cache.UsersTag, cache.UserCachePrefix + id}
 	if err := h.cache.SetWithTags(cacheKey, *user, tags, cache.DefaultExpiration); err != nil {
 		h.logger.Error("Failed to Cache User Data: %v", err)
 		// Don't return error, just continue without caching
@@ -85,33 +108,29 @@ func (h *UserHandler) GetUser(c echo.Context) error {
 	return response.Success(c, "User Retrieved Successfully", user)
 }
 
-// In other methods, you might want to add authorization checks
-// For example, users can only update their own profile
+// UpdateUser updates a user's profile. Access is checked by the route's policy.
 func (h *UserHandler) UpdateUser(c echo.Context) error {
 	id := c.Param("id")
 
-	// Check authorization - users can only update their own profile unless they have admin permissions
-	authUserID, _ := c.Get("user_id").(primitive.ObjectID)
-	roleID, _ := c.Get("role_id").(primitive.ObjectID)
-
-	// Get existing user to check permissions
-	existingUser, err := h.userRepo.GetByID(id)
+	existingUser, err := h.users(c).GetByID(id)
 	if err != nil {
 		return response.NotFound(c, "User Not Found!")
 	}
 
-	// Non-admin users can only update their own profile
-	hasAdminPermission, _ := h.authService.HasPermission(roleID, "users", "update")
-	if existingUser.ID != authUserID && !hasAdminPermission {
-		return response.Error(c, http.StatusForbidden, "Cannot Update This User Record", nil)
-	}
-
 	user := new(models.User)
 	if err := c.Bind(user); err != nil {
 		h.logger.Error("Failed to Bind User: %v", err)
 		return response.BadRequest(c, "Failed to Update User: Invalid Request Format", nil)
 	}
 
+	writer := h.userWriter(c, existingUser)
+	if writer == nil {
+		return response.Error(c, http.StatusForbidden, "Failed to Update User: The User Belongs to Other Organizations", nil)
+	}
+
+	// Email changes go through /me/email so the user and auth records stay in sync
+	user.Email = existingUser.Email
+
 	// Validate user data (log detailed errors but return generic message)
 	if err := validation.ValidateStruct(user); err != nil {
 		// Log detailed validation errors for debugging
@@ -122,19 +141,18 @@ func (h *UserHandler) UpdateUser(c echo.Context) error {
 		return response.BadRequest(c, "Failed to Update User: Validation Error", nil)
 	}
 
-	if err := h.userRepo.Update(id, user); err != nil {
+	if err := writer.Update(id, user); err != nil {
 		h.logger.Error("Failed to Update User: %v", err)
 		return response.InternalServerError(c, "Failed to Update User: Internal Server Error", nil)
 	}
 
-	// Invalidate cache for this specific user
-	cacheKey := fmt.Sprintf("%s%s", cache.UserCachePrefix, id)
-	if err := h.cache.Delete(cacheKey); err != nil {
+	// Invalidate cache for this specific user in every organization
+	if err := h.cache.InvalidateTag(cache.UserCachePrefix + id); err != nil {
 		h.logger.Error("Failed to invalidate user cache: %v", err)
 	}
 
 	// Invalidate cache for this specific user using tags
-	userCacheKey := fmt.Sprintf("%s%s", cache.UserCachePrefix, id)
+	userCacheKey := userCacheKeyFor(auth.TenantID(c), id)
 	if err := h.cache.InvalidateTag(cache.UsersTag); err != nil {
 		h.logger.Error("Failed to Invalidate User Cache by Tag: %v", err)
 	}
@@ -152,30 +170,30 @@ func (h *UserHandler) UpdateUser(c echo.Context) error {
 	return response.Success(c, "User Updated Successfully", user)
 }
 
-// DeleteUser: Deletes a user by ID
+// DeleteUser: Deletes a user by ID. Within an organization the user is only
+// removed from the organization, since the account isn't the organization's.
 func (h *UserHandler) DeleteUser(c echo.Context) error {
 	id := c.Param("id")
 
-	// Check authorization - users can only delete their own profile unless they have admin permissions
-	authUserID, _ := c.Get("user_id").(primitive.ObjectID)
-	roleID, _ := c.Get("role_id").(primitive.ObjectID)
-
-	existingUser, err := h.userRepo.GetByID(id)
+	user, err := h.users(c).GetByID(id)
 	if err != nil {
 		return response.NotFound(c, "User Not Found!")
 	}
 
-	// Non-admin users can only delete their own profile
-	hasAdminPermission, _ := h.authService.HasPermission(roleID, "users", "delete")
-	if existingUser.ID != authUserID && !hasAdminPermission {
-		return response.Error(c, http.StatusForbidden, "Cannot Delete This User Record", nil)
-	}
-
-	if err := h.userRepo.Delete(id); err != nil {
+	if tenantID := auth.TenantID(c); !tenantID.IsZero() {
+		if err := h.authService.RemoveMember(tenantID, user.ID); err != nil {
+			h.logger.Error("Failed to Remove User From Organization: %v", err)
+			return response.InternalServerError(c, "Failed to Delete User: Internal Server Error", nil)
+		}
+	} else if err := h.userRepo.Delete(id); err != nil {
 		h.logger.Error("Failed to Delete User: %v", err)
 		return response.InternalServerError(c, "Failed to Delete User: Internal Server Error", nil)
 	}
 
+	if err := h.cache.InvalidateTag(cache.UserCachePrefix + id); err != nil {
+		h.logger.Error("Failed to Delete User Cache: %v", err)
+	}
+
 	// Invalidate cache using tags
 	if err := h.cache.InvalidateTag(cache.UsersTag); err != nil {
 		h.logger.Error("Failed to Invalidate User Cache by Tag: %v", err)
@@ -189,48 +207,87 @@ func (h *UserHandler) DeleteUser(c echo.Context) error {
 	return response.Success(c, "User Deleted Successfully", nil)
 }
 
-// ListUsers: Returns all users
+// cachedUserPage is a page of users as stored in the cache
+type cachedUserPage struct {
+	Users []*models.User `json:"users"`
+	Meta  response.Meta  `json:"meta"`
+}
+
+// ListUsers returns a page of users filtered by name, email and creation
+// date, sorted by name, email or created_at
 func (h *UserHandler) ListUsers(c echo.Context) error {
 	authUserID := c.Get("user_id").(primitive.ObjectID)
 	roleID := c.Get("role_id").(primitive.ObjectID)
 
-	// Try to get users list from cache first
-	cacheKey := fmt.Sprintf("users_list:%s:%s", authUserID.Hex(), roleID.Hex())
-
-	var cachedUsers []*models.User
-	if err := h.cache.Get(cacheKey, &cachedUsers); err == nil {
-		h.logger.Info("Users list retrieved from cache")
-		return response.Success(c, "Users retrieved successfully", cachedUsers)
+	query, err := parsePageQuery(c, "created_at")
+	if err != nil {
+		return response.BadRequest(c, "Failed to Retrieve Users: "+err.Error(), nil)
 	}
 
-	// Check if user has admin permission to see all users
-	hasAdminPermission, _ := h.authService.HasPermission(roleID, "users", "read")
+	filter := models.UserFilter{
+		Name:  c.QueryParam("name"),
+		Email: c.QueryParam("email"),
+	}
+	if filter.CreatedFrom, err = parseTimeParam(c, "created_from"); err != nil {
+		return response.BadRequest(c, "Failed to Retrieve Users: "+err.Error(), nil)
+	}
+	if filter.CreatedTo, err = parseTimeParam(c, "created_to"); err != nil {
+		return response.BadRequest(c, "Failed to Retrieve Users: "+err.Error(), nil)
+	}
 
-	var users []*models.User
-	var err error
+	// Try to get the page from cache first. Encode sorts the parameters,
+	// so the same query always maps to the same key.
+	cacheKey := fmt.Sprintf("users_list:%s:%s:%s:%s", auth.TenantID(c).Hex(), authUserID.Hex(), roleID.Hex(), c.QueryParams().Encode())
 
-	if hasAdminPermission {
-		// Admin can see all users
-		users, err = h.userRepo.List()
-	} else {
-		// Regular users can only see their own records or records they own
-		return response.Error(c, http.StatusForbidden, "Access Denied to This User Record", nil)
+	var cached cachedUserPage
+	if err := h.cache.Get(cacheKey, &cached); err == nil {
+		h.logger.Info("Users list retrieved from cache")
+		return response.Paginated(c, "Users Retrieved Successfully", cached.Users, cached.Meta)
 	}
 
+	users, page, err := h.users(c).ListPage(filter, query)
 	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) || errors.Is(err, repository.ErrInvalidSort) {
+			return response.BadRequest(c, "Failed to Retrieve Users: "+err.Error(), nil)
+		}
 		h.logger.Error("Failed to List Users: %v", err)
 		return response.InternalServerError(c, "Failed to Retrieve Users: Internal Server Error", nil)
 	}
+	meta := pageMeta(query, page)
 
-	// Cache the users list with tags for easy invalidation
+	// Cache the page with tags for easy invalidation
 	tags := []string{cache.UsersListTag, cache.UsersTag}
-	if err := h.cache.SetWithTags(cacheKey, users, tags, cache.DefaultExpiration); err != nil {
+	if err := h.cache.SetWithTags(cacheKey, cachedUserPage{Users: users, Meta: meta}, tags, cache.DefaultExpiration); err != nil {
 		h.logger.Error("Failed to Cache Users List: %v", err)
 		// Don't return error, just continue without caching
 	}
 
 	h.logger.Info("Users List Retrieved from Database and Cached")
-	return response.Success(c, "Users Retrieved Successfully", users)
+	return response.Paginated(c, "Users Retrieved Successfully", users, meta)
+}
+
+// SearchUsers finds users by a partial name or email, most relevant first
+func (h *UserHandler) SearchUsers(c echo.Context) error {
+	term := strings.TrimSpace(c.QueryParam("q"))
+	if term == "" {
+		return response.BadRequest(c, "Failed to Search Users: A Search Term is Required", nil)
+	}
+
+	query, err := parsePageQuery(c, "")
+	if err != nil {
+		return response.BadRequest(c, "Failed to Search Users: "+err.Error(), nil)
+	}
+	if query.Cursor != "" || c.QueryParam("sort") != "" {
+		return response.BadRequest(c, "Failed to Search Users: Results Are Ranked by Relevance and Paged by Offset", nil)
+	}
+
+	users, page, err := h.users(c).Search(term, query)
+	if err != nil {
+		h.logger.Error("Failed to Search Users: %v", err)
+		return response.InternalServerError(c, "Failed to Search Users: Internal Server Error", nil)
+	}
+
+	return response.Paginated(c, "Users Retrieved Successfully", users, pageMeta(query, page))
 }
 
 // UploadProfilePhoto uploads a profile photo for the user
@@ -238,13 +295,14 @@ func (h *UserHandler) UploadProfilePhoto(c echo.Context) error {
 	authUserID := c.Get("user_id").(primitive.ObjectID)
 	userID := c.Param("id")
 
-	// Check if user is updating their own profile or has admin permission
-	if userID != authUserID.Hex() {
-		roleID := c.Get("role_id").(primitive.ObjectID)
-		hasAdminPermission, _ := h.authService.HasPermission(roleID, "users", "update")
-		if !hasAdminPermission {
-			return response.Error(c, http.StatusForbidden, "Cannot update other users' profile photos", nil)
-		}
+	existingUser, err := h.users(c).GetByID(userID)
+	if err != nil {
+		return response.NotFound(c, "User not found")
+	}
+
+	writer := h.userWriter(c, existingUser)
+	if writer == nil {
+		return response.Error(c, http.StatusForbidden, "User belongs to other organizations", nil)
 	}
 
 	// Parse multipart form with max memory of 32MB
@@ -308,7 +366,7 @@ func (h *UserHandler) UploadProfilePhoto(c echo.Context) error {
 	}
 
 	// Update user record with photo URL
-	err = h.userRepo.UpdateProfilePhoto(userID, uploadResult.URL)
+	err = writer.UpdateProfilePhoto(userID, uploadResult.URL)
 	if err != nil {
 		h.logger.Error("Failed to update user with photo URL: %v", err)
 		// Try to clean up uploaded file
@@ -317,7 +375,7 @@ func (h *UserHandler) UploadProfilePhoto(c echo.Context) error {
 	}
 
 	// Get updated user
-	user, err := h.userRepo.GetByID(userID)
+	user, err := h.users(c).GetByID(userID)
 	if err != nil {
 		h.logger.Error("Failed to get updated user: %v", err)
 		return response.InternalServerError(c, "Failed to retrieve updated user", nil)
@@ -328,24 +386,19 @@ func (h *UserHandler) UploadProfilePhoto(c echo.Context) error {
 
 // DeleteProfilePhoto removes the profile photo
 func (h *UserHandler) DeleteProfilePhoto(c echo.Context) error {
-	authUserID := c.Get("user_id").(primitive.ObjectID)
 	userID := c.Param("id")
 
-	// Check if user is updating their own profile or has admin permission
-	if userID != authUserID.Hex() {
-		roleID := c.Get("role_id").(primitive.ObjectID)
-		hasAdminPermission, _ := h.authService.HasPermission(roleID, "users", "update")
-		if !hasAdminPermission {
-			return response.Error(c, http.StatusForbidden, "Cannot delete other users' profile photos", nil)
-		}
-	}
-
 	// Get current user to get photo URL
-	user, err := h.userRepo.GetByID(userID)
+	user, err := h.users(c).GetByID(userID)
 	if err != nil {
 		return response.NotFound(c, "User not found")
 	}
 
+	writer := h.userWriter(c, user)
+	if writer == nil {
+		return response.Error(c, http.StatusForbidden, "User belongs to other organizations", nil)
+	}
+
 	// If user has a profile photo, delete it from storage
 	if user.ProfilePhoto != "" {
 		// Extract key from URL (this is a simplified approach)
@@ -361,14 +414,14 @@ func (h *UserHandler) DeleteProfilePhoto(c echo.Context) error {
 	}
 
 	// Update user record to remove photo URL
-	err = h.userRepo.UpdateProfilePhoto(userID, "")
+	err = writer.UpdateProfilePhoto(userID, "")
 	if err != nil {
 		h.logger.Error("Failed to remove photo URL from user: %v", err)
 		return response.InternalServerError(c, "Failed to remove profile photo", nil)
 	}
 
 	// Get updated user
-	updatedUser, err := h.userRepo.GetByID(userID)
+	updatedUser, err := h.users(c).GetByID(userID)
 	if err != nil {
 		h.logger.Error("Failed to get updated user: %v", err)
 		return response.InternalServerError(c, "Failed to retrieve updated user", nil)
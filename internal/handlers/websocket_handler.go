@@ -26,7 +26,9 @@ func (h *WebSocketHandler) WebSocketConnection(c echo.Context) error {
 	}
 
 	// Handle WebSocket connection
-	go h.wsService.HandleConnection(conn, userID)
+	tokenID, _ := c.Get("token_id").(string)
+	sessionID, _ := c.Get("session_id").(string)
+	go h.wsService.HandleConnection(conn, userID, tokenID, sessionID)
 
 	return nil
 }
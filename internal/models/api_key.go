@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKey is a long-lived credential for scripts and integrations. Only a hash
+// of the key is stored; the key itself is shown once when it is created.
+type APIKey struct {
+	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Name        string             `json:"name" bson:"name"`
+	Prefix      string             `json:"prefix" bson:"prefix"` // first characters of the key, to tell keys apart
+	KeyHash     string             `json:"-" bson:"key_hash"`
+	Permissions []Permission       `json:"permissions" bson:"permissions"` // subset of the owner's role permissions
+	MFA         bool               `json:"-" bson:"mfa"`                   // created from a session that passed MFA
+	ExpiresAt   *time.Time         `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	LastUsedAt  *time.Time         `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	RevokedAt   *time.Time         `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Allows reports whether the key's permissions allow the action on the resource
+func (k *APIKey) Allows(resource, action string) bool {
+	return Evaluate(k.Permissions, resource, action)
+}
+
+type CreateAPIKeyRequest struct {
+	Name        string       `json:"name" validate:"required,min=1,max=100"`
+	Permissions []Permission `json:"permissions" validate:"required,min=1,dive"`
+	ExpiresAt   *time.Time   `json:"expires_at"`
+}
+
+type CreateAPIKeyResponse struct {
+	Key    string  `json:"key"`
+	APIKey *APIKey `json:"api_key"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditLog records an action taken by one user on behalf of another, such as
+// an admin impersonating a user
+type AuditLog struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	ActorID   primitive.ObjectID `json:"actor_id" bson:"actor_id"`
+	SubjectID primitive.ObjectID `json:"subject_id" bson:"subject_id"`
+	Action    string             `json:"action" bson:"action"`
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	Method    string             `json:"method,omitempty" bson:"method,omitempty"`
+	Path      string             `json:"path,omitempty" bson:"path,omitempty"`
+	Status    int                `json:"status,omitempty" bson:"status,omitempty"`
+	TokenID   string             `json:"token_id,omitempty" bson:"token_id,omitempty"`
+	IPAddress string             `json:"ip_address,omitempty" bson:"ip_address,omitempty"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Audit actions
+const (
+	AuditActionImpersonationStarted = "impersonation_started"
+	AuditActionImpersonatedRequest  = "impersonated_request"
+	AuditActionRoleAssigned         = "role_assigned"
+	AuditActionRoleGranted          = "role_granted"
+	AuditActionRoleGrantRevoked     = "role_grant_revoked"
+)
+
+type ImpersonateRequest struct {
+	Reason string `json:"reason" validate:"required,min=3,max=500"`
+}
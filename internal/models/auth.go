@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -16,28 +17,104 @@ type UserAuth struct {
 	IsActive  bool               `json:"is_active" bson:"is_active"`
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+
+	// Two-factor authentication. The TOTP secret is stored encrypted and
+	// recovery codes are stored as hashes.
+	MFAEnabled    bool       `json:"mfa_enabled" bson:"mfa_enabled"`
+	MFASecret     string     `json:"-" bson:"mfa_secret,omitempty"`
+	RecoveryCodes []string   `json:"-" bson:"recovery_codes,omitempty"`
+	MFAEnabledAt  *time.Time `json:"mfa_enabled_at,omitempty" bson:"mfa_enabled_at,omitempty"`
+}
+
+// NormalizeEmail is the form account emails are stored and looked up in
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
+
+	// Filled in by the handler from the HTTP request
+	IPAddress string `json:"-"`
+	UserAgent string `json:"-"`
 }
 
 type RegisterRequest struct {
 	Name     string `json:"name" validate:"required,min=2,max=100"`
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
+	Password string `json:"password" validate:"required"` // checked against the password policy
 }
 
+// AuthResponse is returned by every sign-in flow. When MFARequired is set only
+// MFAToken is filled in and must be exchanged through /auth/mfa/verify.
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  *User  `json:"user"`
-	Role  *Role  `json:"role"`
+	Token        string    `json:"token,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	User         *User     `json:"user,omitempty"`
+	Role         *Role     `json:"role,omitempty"`
+	MFARequired  bool      `json:"mfa_required,omitempty"`
+	MFAToken     string    `json:"mfa_token,omitempty"`
 }
 
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Claims are the JWT access token claims. RegisteredClaims.ID carries the
+// token ID (jti) used for revocation.
 type Claims struct {
 	UserID primitive.ObjectID `json:"user_id"`
 	Email  string             `json:"email"`
 	RoleID primitive.ObjectID `json:"role_id"`
+	// TenantID is the organization the token acts in; zero is the default scope
+	TenantID primitive.ObjectID `json:"tid"`
+	// SessionID binds the token to a session so revoking the session rejects it
+	SessionID string `json:"sid,omitempty"`
+	// MFA is set when the session was completed with a second factor
+	MFA bool `json:"mfa,omitempty"`
+	// Purpose marks restricted tokens (e.g. an MFA challenge); access tokens leave it empty
+	Purpose string `json:"purpose,omitempty"`
+	// Actor is set on impersonation tokens and names the admin acting as the user (RFC 8693)
+	Actor *ActorClaim `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
+
+type ActorClaim struct {
+	UserID primitive.ObjectID `json:"sub"`
+	Email  string             `json:"email"`
+}
+
+const TokenPurposeMFAPending = "mfa_pending"
+
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+
+	// Filled in by the handler from the HTTP request
+	IPAddress string `json:"-"`
+	UserAgent string `json:"-"`
+}
+
+type MFAEnrollRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type MFADisableRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type MFAEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
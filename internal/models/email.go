@@ -10,6 +10,8 @@ const (
 	TemplateVerification  EmailTemplate = "verification"
 	TemplateWelcome       EmailTemplate = "welcome"
 	TemplateResetPassword EmailTemplate = "reset_password"
+	TemplateEmailChange   EmailTemplate = "email_change"
+	TemplateMagicLink     EmailTemplate = "magic_link"
 )
 
 type EmailMessage struct {
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Identity links an external OAuth2/OIDC account to a user
+type Identity struct {
+	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Provider    string             `json:"provider" bson:"provider"`
+	Subject     string             `json:"subject" bson:"subject"`
+	Email       string             `json:"email,omitempty" bson:"email,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	LastLoginAt time.Time          `json:"last_login_at" bson:"last_login_at"`
+}
+
+// OAuthProfile is the user information returned by an identity provider
+type OAuthProfile struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
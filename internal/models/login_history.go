@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Login history events
+const (
+	LoginEventSuccess         = "login_success"
+	LoginEventFailure         = "login_failure"
+	LoginEventBlocked         = "login_blocked"
+	LoginEventAccountLocked   = "account_locked"
+	LoginEventIPLocked        = "ip_locked"
+	LoginEventAccountUnlocked = "account_unlocked"
+)
+
+// LoginEvent records a sign-in attempt or lockout so support can explain what
+// happened to an account
+type LoginEvent struct {
+	ID        primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID    *primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Email     string              `json:"email" bson:"email"`
+	Event     string              `json:"event" bson:"event"`
+	Reason    string              `json:"reason,omitempty" bson:"reason,omitempty"`
+	IPAddress string              `json:"ip_address,omitempty" bson:"ip_address,omitempty"`
+	UserAgent string              `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	ActorID   *primitive.ObjectID `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	CreatedAt time.Time           `json:"created_at" bson:"created_at"`
+}
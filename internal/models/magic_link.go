@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MagicLink is a single-use passwordless sign-in token. Only the token hash is stored.
+type MagicLink struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Email     string             `json:"email" bson:"email"`
+	TokenHash string             `json:"-" bson:"token_hash"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+	IsUsed    bool               `json:"is_used" bson:"is_used"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	UsedAt    *time.Time         `json:"used_at,omitempty" bson:"used_at,omitempty"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type MagicLinkConsumeRequest struct {
+	Token string `json:"token" validate:"required"`
+}
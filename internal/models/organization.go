@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Organization is a customer company served by the deployment. Its ID is the
+// tenant ID that scopes users and roles.
+type Organization struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	CreatedBy primitive.ObjectID `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// Membership gives a user a role within an organization
+type Membership struct {
+	ID             primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	OrganizationID primitive.ObjectID `json:"organization_id" bson:"organization_id"`
+	UserID         primitive.ObjectID `json:"user_id" bson:"user_id"`
+	RoleID         primitive.ObjectID `json:"role_id" bson:"role_id"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// UserOrganization is an organization the user belongs to and their role there
+type UserOrganization struct {
+	Organization *Organization      `json:"organization"`
+	RoleID       primitive.ObjectID `json:"role_id"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required,min=2,max=100"`
+}
+
+type AddMemberRequest struct {
+	UserID string `json:"user_id" validate:"required"`
+	RoleID string `json:"role_id" validate:"required"`
+}
+
+// SwitchOrganizationRequest selects the organization for new tokens. An
+// empty OrganizationID returns to the default scope outside any organization.
+type SwitchOrganizationRequest struct {
+	OrganizationID string `json:"organization_id"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// PageQuery selects one page of a list. Pages are addressed either by
+// Offset or, for stable iteration over changing data, by the Cursor
+// returned with the previous page.
+type PageQuery struct {
+	Limit  int64
+	Offset int64
+	Cursor string
+	Sort   string // field to sort by, one the repository allows
+	Desc   bool
+}
+
+// Page describes the page a list query returned
+type Page struct {
+	Total      int64  // documents matching the filter, on every page
+	NextCursor string // empty on the last page
+}
+
+// UserFilter narrows a user list. Zero fields don't filter.
+type UserFilter struct {
+	Name        string // case-insensitive substring
+	Email       string // case-insensitive substring
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+}
+
+// RoleFilter narrows a role list. Zero fields don't filter.
+type RoleFilter struct {
+	Name     string // case-insensitive substring
+	IsActive *bool
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefreshToken is an opaque, single-use token that can be exchanged for a new
+// access token. Every rotation issues a new token in the same family, so reuse
+// of an already rotated token can revoke the whole chain.
+type RefreshToken struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	FamilyID  primitive.ObjectID `json:"family_id" bson:"family_id"`
+	TokenHash string             `json:"-" bson:"token_hash"`
+	MFA       bool               `json:"mfa" bson:"mfa"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	RotatedAt *time.Time         `json:"rotated_at,omitempty" bson:"rotated_at,omitempty"`
+	RevokedAt *time.Time         `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
@@ -1,30 +1,103 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Permission grants or denies an action on a resource. See Evaluate for how
+// wildcards, hierarchical resources and deny entries are matched.
 type Permission struct {
-	Resource string `json:"resource" bson:"resource"`
-	Action   string `json:"action" bson:"action"`
+	Resource string `json:"resource" bson:"resource" validate:"required"`
+	Action   string `json:"action" bson:"action" validate:"required"`
+	// Effect is EffectAllow (the default when empty) or EffectDeny
+	Effect string `json:"effect,omitempty" bson:"effect,omitempty" validate:"omitempty,oneof=allow deny"`
 }
 
 type Role struct {
-	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Name        string             `json:"name" bson:"name" validate:"required"`
-	Description string             `json:"description" bson:"description"`
-	Permissions []Permission       `json:"permissions" bson:"permissions"`
-	IsActive    bool               `json:"is_active" bson:"is_active"`
-	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+	ID          primitive.ObjectID   `json:"id,omitempty" bson:"_id,omitempty"`
+	Name        string               `json:"name" bson:"name" validate:"required"`
+	Description string               `json:"description" bson:"description"`
+	Permissions []Permission         `json:"permissions" bson:"permissions" validate:"dive"`
+	ParentIDs   []primitive.ObjectID `json:"parent_ids,omitempty" bson:"parent_ids,omitempty"` // roles whose permissions are inherited
+	RequireMFA  bool                 `json:"require_mfa" bson:"require_mfa"`
+	IsActive    bool                 `json:"is_active" bson:"is_active"`
+	IsSystem    bool                 `json:"is_system" bson:"is_system"`           // set at startup, can't be deleted or renamed
+	TenantID    primitive.ObjectID   `json:"tenant_id" bson:"tenant_id,omitempty"` // zero for roles shared by every organization
+	CreatedAt   time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at" bson:"updated_at"`
+}
+
+// ResolvedPermission is an effective permission and the role it comes from
+type ResolvedPermission struct {
+	Permission
+	RoleID   primitive.ObjectID `json:"role_id"`
+	RoleName string             `json:"role_name"`
+}
+
+// EffectivePermissions is a role's permission set after resolving inheritance
+type EffectivePermissions struct {
+	RoleID primitive.ObjectID `json:"role_id"`
+	// Roles lists the role and every active ancestor in resolution order
+	Roles       []primitive.ObjectID `json:"roles"`
+	Permissions []ResolvedPermission `json:"permissions"`
+}
+
+type AssignRoleRequest struct {
+	RoleID string `json:"role_id" validate:"required"`
+}
+
+// RoleMember is a user holding a role
+type RoleMember struct {
+	UserID   primitive.ObjectID `json:"user_id"`
+	Name     string             `json:"name"`
+	Email    string             `json:"email"`
+	IsActive bool               `json:"is_active"`
+}
+
+// PermissionExplanation answers whether a user may perform an action on a
+// resource and which of their role's permissions decided it
+type PermissionExplanation struct {
+	UserID     primitive.ObjectID `json:"user_id"`
+	RoleID     primitive.ObjectID `json:"role_id"`
+	RoleName   string             `json:"role_name"`
+	Resource   string             `json:"resource"`
+	Action     string             `json:"action"`
+	Allowed    bool               `json:"allowed"`
+	Reason     string             `json:"reason"`
+	Registered bool               `json:"registered"` // whether any route checks this permission
+	RequireMFA bool               `json:"require_mfa"`
+	// Matched lists every effective permission covering the request, allows and denies
+	Matched []ResolvedPermission `json:"matched"`
+}
+
+// Built-in roles. New users get DefaultRoleName.
+const (
+	DefaultRoleName = "user"
+	AdminRoleName   = "admin"
+)
+
+// SystemRoleNames are the roles marked as system roles at startup
+var SystemRoleNames = []string{DefaultRoleName, AdminRoleName}
+
+// IsReservedRoleName reports whether the name belongs to a system role, which
+// organizations can't use for their own roles
+func IsReservedRoleName(name string) bool {
+	for _, reserved := range SystemRoleNames {
+		if strings.EqualFold(strings.TrimSpace(name), reserved) {
+			return true
+		}
+	}
+	return false
 }
 
 // Predefined permissions
 const (
-	ResourceUsers = "users"
-	ResourceRoles = "roles"
+	ResourceUsers      = "users"
+	ResourceUserPhotos = "users.photos"
+	ResourceRoles      = "roles"
 
 	ActionCreate = "create"
 	ActionRead   = "read"
@@ -32,6 +105,14 @@ const (
 	ActionDelete = "delete"
 )
 
+// Permission effects and wildcard
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+
+	Wildcard = "*"
+)
+
 // Helper function to create permission
 func NewPermission(resource, action string) Permission {
 	return Permission{
@@ -39,3 +120,72 @@ func NewPermission(resource, action string) Permission {
 		Action:   action,
 	}
 }
+
+// Helper function to create a deny permission
+func NewDenyPermission(resource, action string) Permission {
+	return Permission{
+		Resource: resource,
+		Action:   action,
+		Effect:   EffectDeny,
+	}
+}
+
+// IsDeny reports whether the permission is a deny entry
+func (p Permission) IsDeny() bool {
+	return p.Effect == EffectDeny
+}
+
+// Matches reports whether the permission covers the action on the resource.
+//
+// Resources are dot-separated paths such as "users.photos":
+//   - "*" matches every resource
+//   - "users" matches "users" and everything below it ("users.photos", ...)
+//   - "users.*" matches everything below "users", but not "users" itself
+//
+// Actions match exactly, or "*" matches every action.
+func (p Permission) Matches(resource, action string) bool {
+	if p.Action != Wildcard && p.Action != action {
+		return false
+	}
+
+	switch {
+	case p.Resource == Wildcard, p.Resource == resource:
+		return true
+	case strings.HasSuffix(p.Resource, "."+Wildcard):
+		return strings.HasPrefix(resource, strings.TrimSuffix(p.Resource, Wildcard))
+	default:
+		return strings.HasPrefix(resource, p.Resource+".")
+	}
+}
+
+// Evaluate decides whether the permissions allow the action on the resource.
+// A matching deny entry always wins over any allow entry, and nothing is
+// allowed unless an allow entry matches.
+func Evaluate(permissions []Permission, resource, action string) bool {
+	allowed := false
+	for _, permission := range permissions {
+		if !permission.Matches(resource, action) {
+			continue
+		}
+		if permission.IsDeny() {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+// Denies reports whether a deny entry matches the action on the resource
+func Denies(permissions []Permission, resource, action string) bool {
+	for _, permission := range permissions {
+		if permission.IsDeny() && permission.Matches(resource, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the role's permissions allow the action on the resource
+func (r *Role) Allows(resource, action string) bool {
+	return Evaluate(r.Permissions, resource, action)
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RoleGrant gives a user a role's permissions in addition to their own role
+// between StartsAt and ExpiresAt, for example for a contractor needing
+// temporary elevated access
+type RoleGrant struct {
+	ID       primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID   primitive.ObjectID `json:"user_id" bson:"user_id"`
+	RoleID   primitive.ObjectID `json:"role_id" bson:"role_id"`
+	TenantID primitive.ObjectID `json:"tenant_id" bson:"tenant_id,omitempty"` // organization the grant applies in, zero for the default scope
+	// ResourceID, when set, limits the grant to requests targeting that resource
+	ResourceID string             `json:"resource_id,omitempty" bson:"resource_id,omitempty"`
+	Reason     string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	GrantedBy  primitive.ObjectID `json:"granted_by" bson:"granted_by"`
+	StartsAt   time.Time          `json:"starts_at" bson:"starts_at"`
+	ExpiresAt  time.Time          `json:"expires_at" bson:"expires_at"`
+	Expired    bool               `json:"expired" bson:"expired"` // set by the sweeper once the user was notified
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// IsActive reports whether the grant applies at the given time
+func (g *RoleGrant) IsActive(now time.Time) bool {
+	return !now.Before(g.StartsAt) && now.Before(g.ExpiresAt)
+}
+
+// Covers reports whether the grant applies to a request targeting resourceID
+func (g *RoleGrant) Covers(resourceID string) bool {
+	return g.ResourceID == "" || g.ResourceID == resourceID
+}
+
+type CreateRoleGrantRequest struct {
+	RoleID     string     `json:"role_id" validate:"required"`
+	ResourceID string     `json:"resource_id" validate:"omitempty,max=100"`
+	Reason     string     `json:"reason" validate:"omitempty,max=500"`
+	StartsAt   *time.Time `json:"starts_at"` // defaults to now
+	ExpiresAt  time.Time  `json:"expires_at" validate:"required"`
+}
@@ -0,0 +1,128 @@
+package models
+
+import "testing"
+
+func TestPermissionMatches(t *testing.T) {
+	tests := []struct {
+		name       string
+		permission Permission
+		resource   string
+		action     string
+		want       bool
+	}{
+		{"exact match", NewPermission("users", "read"), "users", "read", true},
+		{"other action", NewPermission("users", "read"), "users", "update", false},
+		{"other resource", NewPermission("users", "read"), "roles", "read", false},
+		{"wildcard everything", NewPermission("*", "*"), "roles", "delete", true},
+		{"wildcard action", NewPermission("users", "*"), "users", "delete", true},
+		{"wildcard action other resource", NewPermission("users", "*"), "roles", "delete", false},
+		{"wildcard resource", NewPermission("*", "read"), "roles", "read", true},
+		{"wildcard resource other action", NewPermission("*", "read"), "roles", "update", false},
+		{"parent covers child", NewPermission("users", "update"), "users.photos", "update", true},
+		{"parent covers grandchild", NewPermission("users", "update"), "users.photos.thumbnails", "update", true},
+		{"child does not cover parent", NewPermission("users.photos", "update"), "users", "update", false},
+		{"child does not cover sibling", NewPermission("users.photos", "update"), "users.settings", "update", false},
+		{"prefix is not a parent", NewPermission("user", "read"), "users", "read", false},
+		{"children wildcard covers child", NewPermission("users.*", "read"), "users.photos", "read", true},
+		{"children wildcard covers grandchild", NewPermission("users.*", "read"), "users.photos.thumbnails", "read", true},
+		{"children wildcard excludes parent", NewPermission("users.*", "read"), "users", "read", false},
+		{"literal wildcard action request", NewPermission("users", "read"), "users", "*", false},
+		{"wildcard covers wildcard request", NewPermission("users", "*"), "users", "*", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.permission.Matches(tt.resource, tt.action); got != tt.want {
+				t.Errorf("%s:%s Matches(%s, %s) = %v, want %v",
+					tt.permission.Resource, tt.permission.Action, tt.resource, tt.action, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions []Permission
+		resource    string
+		action      string
+		want        bool
+	}{
+		{"no permissions", nil, "users", "read", false},
+		{"allowed", []Permission{NewPermission("users", "read")}, "users", "read", true},
+		{"not allowed", []Permission{NewPermission("users", "read")}, "users", "delete", false},
+		{"explicit allow effect", []Permission{{Resource: "users", Action: "read", Effect: EffectAllow}}, "users", "read", true},
+		{
+			"deny wins over exact allow",
+			[]Permission{NewPermission("users", "read"), NewDenyPermission("users", "read")},
+			"users", "read", false,
+		},
+		{
+			"deny wins regardless of order",
+			[]Permission{NewDenyPermission("users", "read"), NewPermission("users", "read")},
+			"users", "read", false,
+		},
+		{
+			"deny wins over wildcard allow",
+			[]Permission{NewPermission("*", "*"), NewDenyPermission("roles", "delete")},
+			"roles", "delete", false,
+		},
+		{
+			"deny leaves other actions allowed",
+			[]Permission{NewPermission("*", "*"), NewDenyPermission("roles", "delete")},
+			"roles", "update", true,
+		},
+		{
+			"deny on parent covers child",
+			[]Permission{NewPermission("users.photos", "update"), NewDenyPermission("users", "update")},
+			"users.photos", "update", false,
+		},
+		{
+			"deny on child leaves parent allowed",
+			[]Permission{NewPermission("users", "update"), NewDenyPermission("users.photos", "update")},
+			"users", "update", true,
+		},
+		{
+			"deny on child blocks child",
+			[]Permission{NewPermission("users", "update"), NewDenyPermission("users.photos", "update")},
+			"users.photos", "update", false,
+		},
+		{
+			"wildcard deny blocks everything",
+			[]Permission{NewPermission("users", "read"), NewDenyPermission("*", "*")},
+			"users", "read", false,
+		},
+		{"deny only", []Permission{NewDenyPermission("users", "read")}, "users", "update", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Evaluate(tt.permissions, tt.resource, tt.action); got != tt.want {
+				t.Errorf("Evaluate(%s, %s) = %v, want %v", tt.resource, tt.action, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsReservedRoleName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"user", true},
+		{"admin", true},
+		{"Admin", true},
+		{" admin ", true},
+		{"admins", false},
+		{"support", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsReservedRoleName(tt.name); got != tt.want {
+				t.Errorf("IsReservedRoleName(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is one signed-in device. Its ID is also the refresh token family ID
+// and the "sid" claim of every access token issued for it.
+type Session struct {
+	ID         primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `json:"user_id" bson:"user_id"`
+	IPAddress  string             `json:"ip_address" bson:"ip_address"`
+	UserAgent  string             `json:"user_agent" bson:"user_agent"`
+	MFA        bool               `json:"mfa" bson:"mfa"`
+	TenantID   primitive.ObjectID `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"` // organization selected for the session
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	LastSeenAt time.Time          `json:"last_seen_at" bson:"last_seen_at"`
+	ExpiresAt  time.Time          `json:"expires_at" bson:"expires_at"`
+	RevokedAt  *time.Time         `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+
+	// Current marks the session of the request listing the sessions
+	Current bool `json:"current" bson:"-"`
+}
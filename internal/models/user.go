@@ -11,6 +11,29 @@ type User struct {
 	Name         string             `json:"name" bson:"name" validate:"required,min=2,max=100"`
 	Email        string             `json:"email" bson:"email" validate:"required,email"`
 	ProfilePhoto string             `json:"profile_photo,omitempty" bson:"profile_photo,omitempty"`
-	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
+	// OrganizationIDs mirrors the user's memberships so queries can be scoped
+	// to a tenant. Not exposed, it would reveal the user's other organizations.
+	OrganizationIDs []primitive.ObjectID `json:"-" bson:"organization_ids,omitempty"`
+	CreatedAt       time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time            `json:"updated_at" bson:"updated_at"`
+}
+
+// BelongsOnlyTo reports whether the account is owned by the tenant alone:
+// in the default scope every account is, within an organization only users
+// who belong to no other organization are
+func (u *User) BelongsOnlyTo(tenantID primitive.ObjectID) bool {
+	if tenantID.IsZero() {
+		return true
+	}
+	return len(u.OrganizationIDs) == 1 && u.OrganizationIDs[0] == tenantID
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"` // checked against the password policy
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
 }
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUserBelongsOnlyTo(t *testing.T) {
+	orgA := primitive.NewObjectID()
+	orgB := primitive.NewObjectID()
+
+	tests := []struct {
+		name          string
+		organizations []primitive.ObjectID
+		tenant        primitive.ObjectID
+		want          bool
+	}{
+		{"default scope owns platform user", nil, primitive.NilObjectID, true},
+		{"default scope owns member", []primitive.ObjectID{orgA, orgB}, primitive.NilObjectID, true},
+		{"only organization", []primitive.ObjectID{orgA}, orgA, true},
+		{"member of two organizations", []primitive.ObjectID{orgA, orgB}, orgA, false},
+		{"member of two organizations, other one", []primitive.ObjectID{orgA, orgB}, orgB, false},
+		{"member of another organization", []primitive.ObjectID{orgB}, orgA, false},
+		{"platform user within organization", nil, orgA, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &User{OrganizationIDs: tt.organizations}
+			if got := user.BelongsOnlyTo(tt.tenant); got != tt.want {
+				t.Errorf("BelongsOnlyTo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,11 +6,19 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Verification purposes. Records without a purpose predate email changes and
+// are treated as registration verifications.
+const (
+	VerificationPurposeRegistration = "registration"
+	VerificationPurposeEmailChange  = "email_change"
+)
+
 type EmailVerification struct {
 	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
 	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
 	Email     string             `json:"email" bson:"email"`
 	Token     string             `json:"token" bson:"token"`
+	Purpose   string             `json:"purpose,omitempty" bson:"purpose,omitempty"`
 	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
 	IsUsed    bool               `json:"is_used" bson:"is_used"`
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
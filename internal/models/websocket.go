@@ -17,6 +17,8 @@ type WebSocketMessage struct {
 type WebSocketConnection struct {
 	ID        primitive.ObjectID `json:"id"`
 	UserID    primitive.ObjectID `json:"user_id"`
+	TokenID   string             `json:"-"`
+	SessionID string             `json:"-"`
 	Conn      *websocket.Conn    `json:"-"`
 	Channels  []string           `json:"channels"`
 	Connected bool               `json:"connected"`
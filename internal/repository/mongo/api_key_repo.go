@@ -0,0 +1,107 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type apiKeyRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAPIKeyRepository(db *mongo.Database) *apiKeyRepository {
+	return &apiKeyRepository{
+		collection: db.Collection("api_keys"),
+	}
+}
+
+func (r *apiKeyRepository) Create(key *models.APIKey) error {
+	key.CreatedAt = time.Now()
+
+	result, err := r.collection.InsertOne(context.TODO(), key)
+	if err != nil {
+		return err
+	}
+
+	key.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *apiKeyRepository) GetByHash(keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.collection.FindOne(context.TODO(), bson.M{"key_hash": keyHash}).Decode(&key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// ListByUserID returns the user's keys, newest first
+func (r *apiKeyRepository) ListByUserID(userID primitive.ObjectID) ([]*models.APIKey, error) {
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := r.collection.Find(context.TODO(), bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var keys []*models.APIKey
+	for cursor.Next(context.TODO()) {
+		var key models.APIKey
+		if err := cursor.Decode(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Revoke revokes one of the user's keys. It returns mongo.ErrNoDocuments when
+// the user has no live key with that ID.
+func (r *apiKeyRepository) Revoke(id, userID primitive.ObjectID) error {
+	filter := bson.M{
+		"_id":        id,
+		"user_id":    userID,
+		"revoked_at": nil,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"revoked_at": time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepository) UpdateLastUsed(id primitive.ObjectID) error {
+	filter := bson.M{"_id": id}
+	update := bson.M{
+		"$set": bson.M{
+			"last_used_at": time.Now(),
+		},
+	}
+
+	_, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	return err
+}
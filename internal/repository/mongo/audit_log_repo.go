@@ -0,0 +1,67 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type auditLogRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAuditLogRepository(db *mongo.Database) *auditLogRepository {
+	return &auditLogRepository{
+		collection: db.Collection("audit_logs"),
+	}
+}
+
+func (r *auditLogRepository) Create(entry *models.AuditLog) error {
+	entry.CreatedAt = time.Now()
+
+	result, err := r.collection.InsertOne(context.TODO(), entry)
+	if err != nil {
+		return err
+	}
+
+	entry.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ListByUserID returns entries where the user is either the actor or the
+// subject, most recent first
+func (r *auditLogRepository) ListByUserID(userID primitive.ObjectID, limit int64) ([]*models.AuditLog, error) {
+	filter := bson.M{
+		"$or": []bson.M{
+			{"actor_id": userID},
+			{"subject_id": userID},
+		},
+	}
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(limit)
+
+	cursor, err := r.collection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var entries []*models.AuditLog
+	for cursor.Next(context.TODO()) {
+		var entry models.AuditLog
+		if err := cursor.Decode(&entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -8,6 +8,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type authRepository struct {
@@ -21,6 +22,7 @@ func NewAuthRepository(db *mongo.Database) *authRepository {
 }
 
 func (r *authRepository) Create(auth *models.UserAuth) error {
+	auth.Email = models.NormalizeEmail(auth.Email)
 	auth.CreatedAt = time.Now()
 	auth.UpdatedAt = time.Now()
 
@@ -33,9 +35,12 @@ func (r *authRepository) Create(auth *models.UserAuth) error {
 	return nil
 }
 
+// GetByEmail ignores case, accounts stored before emails were normalized
+// may still have mixed case
 func (r *authRepository) GetByEmail(email string) (*models.UserAuth, error) {
 	var auth models.UserAuth
-	err := r.collection.FindOne(context.TODO(), bson.M{"email": email}).Decode(&auth)
+	opts := options.FindOne().SetCollation(&options.Collation{Locale: "en", Strength: 2})
+	err := r.collection.FindOne(context.TODO(), bson.M{"email": models.NormalizeEmail(email)}, opts).Decode(&auth)
 	if err != nil {
 		return nil, err
 	}
@@ -66,6 +71,19 @@ func (r *authRepository) UpdatePassword(userID primitive.ObjectID, password stri
 	return err
 }
 
+func (r *authRepository) UpdateEmail(userID primitive.ObjectID, email string) error {
+	filter := bson.M{"user_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"email":      models.NormalizeEmail(email),
+			"updated_at": time.Now(),
+		},
+	}
+
+	_, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	return err
+}
+
 func (r *authRepository) UpdateRole(userID, roleID primitive.ObjectID) error {
 	filter := bson.M{"user_id": userID}
 	update := bson.M{
@@ -79,6 +97,44 @@ func (r *authRepository) UpdateRole(userID, roleID primitive.ObjectID) error {
 	return err
 }
 
+func (r *authRepository) ListByRoleID(roleID primitive.ObjectID) ([]*models.UserAuth, error) {
+	opts := options.Find().SetSort(bson.M{"created_at": 1})
+
+	cursor, err := r.collection.Find(context.TODO(), bson.M{"role_id": roleID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var auths []*models.UserAuth
+	for cursor.Next(context.TODO()) {
+		var auth models.UserAuth
+		if err := cursor.Decode(&auth); err != nil {
+			return nil, err
+		}
+		auths = append(auths, &auth)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return auths, nil
+}
+
+func (r *authRepository) CountByRoleID(roleID primitive.ObjectID) (int64, error) {
+	return r.collection.CountDocuments(context.TODO(), bson.M{"role_id": roleID})
+}
+
+func (r *authRepository) CountActiveByRoleIDs(roleIDs []primitive.ObjectID) (int64, error) {
+	filter := bson.M{
+		"role_id":   bson.M{"$in": roleIDs},
+		"is_active": true,
+	}
+
+	return r.collection.CountDocuments(context.TODO(), filter)
+}
+
 func (r *authRepository) ActivateUser(userID primitive.ObjectID) error {
 	filter := bson.M{"user_id": userID}
 	update := bson.M{
@@ -91,3 +147,83 @@ func (r *authRepository) ActivateUser(userID primitive.ObjectID) error {
 	_, err := r.collection.UpdateOne(context.TODO(), filter, update)
 	return err
 }
+
+// SetMFASecret stores a pending secret; MFA stays disabled until confirmed
+func (r *authRepository) SetMFASecret(userID primitive.ObjectID, secret string) error {
+	filter := bson.M{"user_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"mfa_secret": secret,
+			"updated_at": time.Now(),
+		},
+	}
+
+	_, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	return err
+}
+
+func (r *authRepository) EnableMFA(userID primitive.ObjectID, recoveryCodes []string) error {
+	now := time.Now()
+	filter := bson.M{"user_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"mfa_enabled":    true,
+			"mfa_enabled_at": &now,
+			"recovery_codes": recoveryCodes,
+			"updated_at":     now,
+		},
+	}
+
+	_, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	return err
+}
+
+func (r *authRepository) DisableMFA(userID primitive.ObjectID) error {
+	filter := bson.M{"user_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"mfa_enabled": false,
+			"updated_at":  time.Now(),
+		},
+		"$unset": bson.M{
+			"mfa_secret":     "",
+			"mfa_enabled_at": "",
+			"recovery_codes": "",
+		},
+	}
+
+	_, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	return err
+}
+
+func (r *authRepository) SetRecoveryCodes(userID primitive.ObjectID, recoveryCodes []string) error {
+	filter := bson.M{"user_id": userID}
+	update := bson.M{
+		"$set": bson.M{
+			"recovery_codes": recoveryCodes,
+			"updated_at":     time.Now(),
+		},
+	}
+
+	_, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	return err
+}
+
+// UseRecoveryCode removes a recovery code hash and reports whether it was present
+func (r *authRepository) UseRecoveryCode(userID primitive.ObjectID, recoveryCode string) (bool, error) {
+	filter := bson.M{
+		"user_id":        userID,
+		"recovery_codes": recoveryCode,
+	}
+	update := bson.M{
+		"$pull": bson.M{"recovery_codes": recoveryCode},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	result, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
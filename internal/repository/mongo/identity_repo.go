@@ -0,0 +1,83 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type identityRepository struct {
+	collection *mongo.Collection
+}
+
+func NewIdentityRepository(db *mongo.Database) *identityRepository {
+	return &identityRepository{
+		collection: db.Collection("identities"),
+	}
+}
+
+func (r *identityRepository) Create(identity *models.Identity) error {
+	identity.CreatedAt = time.Now()
+	identity.LastLoginAt = time.Now()
+
+	result, err := r.collection.InsertOne(context.TODO(), identity)
+	if err != nil {
+		return err
+	}
+
+	identity.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *identityRepository) GetByProviderSubject(provider, subject string) (*models.Identity, error) {
+	var identity models.Identity
+	err := r.collection.FindOne(context.TODO(), bson.M{
+		"provider": provider,
+		"subject":  subject,
+	}).Decode(&identity)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+func (r *identityRepository) ListByUserID(userID primitive.ObjectID) ([]*models.Identity, error) {
+	cursor, err := r.collection.Find(context.TODO(), bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var identities []*models.Identity
+	for cursor.Next(context.TODO()) {
+		var identity models.Identity
+		if err := cursor.Decode(&identity); err != nil {
+			return nil, err
+		}
+		identities = append(identities, &identity)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+func (r *identityRepository) UpdateLastLogin(id primitive.ObjectID) error {
+	filter := bson.M{"_id": id}
+	update := bson.M{
+		"$set": bson.M{
+			"last_login_at": time.Now(),
+		},
+	}
+
+	_, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	return err
+}
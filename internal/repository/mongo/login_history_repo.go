@@ -0,0 +1,59 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type loginHistoryRepository struct {
+	collection *mongo.Collection
+}
+
+func NewLoginHistoryRepository(db *mongo.Database) *loginHistoryRepository {
+	return &loginHistoryRepository{
+		collection: db.Collection("login_history"),
+	}
+}
+
+func (r *loginHistoryRepository) Create(event *models.LoginEvent) error {
+	event.CreatedAt = time.Now()
+
+	result, err := r.collection.InsertOne(context.TODO(), event)
+	if err != nil {
+		return err
+	}
+
+	event.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ListByUserID returns the most recent events first
+func (r *loginHistoryRepository) ListByUserID(userID primitive.ObjectID, limit int64) ([]*models.LoginEvent, error) {
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(limit)
+	cursor, err := r.collection.Find(context.TODO(), bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var events []*models.LoginEvent
+	for cursor.Next(context.TODO()) {
+		var event models.LoginEvent
+		if err := cursor.Decode(&event); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,78 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type magicLinkRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMagicLinkRepository(db *mongo.Database) *magicLinkRepository {
+	return &magicLinkRepository{
+		collection: db.Collection("magic_links"),
+	}
+}
+
+func (r *magicLinkRepository) Create(link *models.MagicLink) error {
+	link.CreatedAt = time.Now()
+
+	result, err := r.collection.InsertOne(context.TODO(), link)
+	if err != nil {
+		return err
+	}
+
+	link.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// Consume atomically marks a valid token as used and returns it, so a token
+// can never be redeemed twice
+func (r *magicLinkRepository) Consume(tokenHash string) (*models.MagicLink, error) {
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"is_used":    false,
+		"expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"is_used": true,
+			"used_at": &now,
+		},
+	}
+
+	var link models.MagicLink
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.collection.FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(&link)
+	if err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// InvalidateByUserID marks every outstanding token of the user as used
+func (r *magicLinkRepository) InvalidateByUserID(userID primitive.ObjectID) error {
+	now := time.Now()
+	filter := bson.M{
+		"user_id": userID,
+		"is_used": false,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"is_used": true,
+			"used_at": &now,
+		},
+	}
+
+	_, err := r.collection.UpdateMany(context.TODO(), filter, update)
+	return err
+}
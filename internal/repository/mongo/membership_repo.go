@@ -0,0 +1,126 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type membershipRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMembershipRepository(db *mongo.Database) *membershipRepository {
+	return &membershipRepository{
+		collection: db.Collection("memberships"),
+	}
+}
+
+// Upsert adds the user to the organization or changes their role there
+func (r *membershipRepository) Upsert(membership *models.Membership) error {
+	now := time.Now()
+	membership.UpdatedAt = now
+
+	filter := bson.M{
+		"organization_id": membership.OrganizationID,
+		"user_id":         membership.UserID,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"role_id":    membership.RoleID,
+			"updated_at": now,
+		},
+		"$setOnInsert": bson.M{
+			"created_at": now,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	return r.collection.FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(membership)
+}
+
+func (r *membershipRepository) Get(organizationID, userID primitive.ObjectID) (*models.Membership, error) {
+	filter := bson.M{
+		"organization_id": organizationID,
+		"user_id":         userID,
+	}
+
+	var membership models.Membership
+	if err := r.collection.FindOne(context.TODO(), filter).Decode(&membership); err != nil {
+		return nil, err
+	}
+
+	return &membership, nil
+}
+
+func (r *membershipRepository) ListByUserID(userID primitive.ObjectID) ([]*models.Membership, error) {
+	return r.find(bson.M{"user_id": userID})
+}
+
+func (r *membershipRepository) ListByOrganizationID(organizationID primitive.ObjectID) ([]*models.Membership, error) {
+	return r.find(bson.M{"organization_id": organizationID})
+}
+
+func (r *membershipRepository) ListByRoleID(organizationID, roleID primitive.ObjectID) ([]*models.Membership, error) {
+	return r.find(bson.M{"organization_id": organizationID, "role_id": roleID})
+}
+
+func (r *membershipRepository) ListAllByRoleID(roleID primitive.ObjectID) ([]*models.Membership, error) {
+	return r.find(bson.M{"role_id": roleID})
+}
+
+func (r *membershipRepository) CountByRoleIDs(organizationID primitive.ObjectID, roleIDs []primitive.ObjectID) (int64, error) {
+	filter := bson.M{
+		"organization_id": organizationID,
+		"role_id":         bson.M{"$in": roleIDs},
+	}
+
+	return r.collection.CountDocuments(context.TODO(), filter)
+}
+
+func (r *membershipRepository) Delete(organizationID, userID primitive.ObjectID) error {
+	filter := bson.M{
+		"organization_id": organizationID,
+		"user_id":         userID,
+	}
+
+	result, err := r.collection.DeleteOne(context.TODO(), filter)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *membershipRepository) find(filter bson.M) ([]*models.Membership, error) {
+	opts := options.Find().SetSort(bson.M{"created_at": 1})
+
+	cursor, err := r.collection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var memberships []*models.Membership
+	for cursor.Next(context.TODO()) {
+		var membership models.Membership
+		if err := cursor.Decode(&membership); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, &membership)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
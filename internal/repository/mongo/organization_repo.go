@@ -0,0 +1,70 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type organizationRepository struct {
+	collection *mongo.Collection
+}
+
+func NewOrganizationRepository(db *mongo.Database) *organizationRepository {
+	return &organizationRepository{
+		collection: db.Collection("organizations"),
+	}
+}
+
+func (r *organizationRepository) Create(organization *models.Organization) error {
+	organization.CreatedAt = time.Now()
+	organization.UpdatedAt = time.Now()
+
+	result, err := r.collection.InsertOne(context.TODO(), organization)
+	if err != nil {
+		return err
+	}
+
+	organization.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *organizationRepository) GetByID(id primitive.ObjectID) (*models.Organization, error) {
+	var organization models.Organization
+	err := r.collection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&organization)
+	if err != nil {
+		return nil, err
+	}
+
+	return &organization, nil
+}
+
+func (r *organizationRepository) List() ([]*models.Organization, error) {
+	opts := options.Find().SetSort(bson.M{"name": 1})
+
+	cursor, err := r.collection.Find(context.TODO(), bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var organizations []*models.Organization
+	for cursor.Next(context.TODO()) {
+		var organization models.Organization
+		if err := cursor.Decode(&organization); err != nil {
+			return nil, err
+		}
+		organizations = append(organizations, &organization)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return organizations, nil
+}
@@ -0,0 +1,146 @@
+package mongo
+
+import (
+	"context"
+	"encoding/base64"
+	"regexp"
+
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// cursorPosition is the last document of a page, encoded into the cursor
+// that continues after it
+type cursorPosition struct {
+	Field string             `bson:"f"`
+	Value bson.RawValue      `bson:"v"`
+	ID    primitive.ObjectID `bson:"id"`
+}
+
+// findPage runs a paginated query sorted by query.Sort, then _id to break
+// ties. sortFields maps the fields callers may sort by to the BSON type of
+// their values.
+func findPage[T any](collection *mongo.Collection, filter bson.M, query models.PageQuery, sortFields map[string]bsontype.Type) ([]*T, *models.Page, error) {
+	valueType, ok := sortFields[query.Sort]
+	if !ok {
+		return nil, nil, repository.ErrInvalidSort
+	}
+
+	total, err := collection.CountDocuments(context.TODO(), filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	order, after := 1, "$gt"
+	if query.Desc {
+		order, after = -1, "$lt"
+	}
+
+	// One extra document tells whether there is a next page
+	opts := options.Find().
+		SetSort(bson.D{{Key: query.Sort, Value: order}, {Key: "_id", Value: order}}).
+		SetLimit(query.Limit + 1)
+
+	if query.Cursor != "" {
+		position, err := decodeCursor(query.Cursor, query.Sort, valueType)
+		if err != nil {
+			return nil, nil, repository.ErrInvalidCursor
+		}
+		filter = bson.M{"$and": []bson.M{filter, {"$or": []bson.M{
+			{query.Sort: bson.M{after: position.Value}},
+			{query.Sort: position.Value, "_id": bson.M{after: position.ID}},
+		}}}}
+	} else if query.Offset > 0 {
+		opts.SetSkip(query.Offset)
+	}
+
+	cursor, err := collection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	items := make([]*T, 0, query.Limit)
+	var last bson.Raw
+	for cursor.Next(context.TODO()) {
+		if int64(len(items)) == query.Limit {
+			// The extra document: there is another page after last
+			page := &models.Page{Total: total}
+			page.NextCursor, err = encodeCursor(query.Sort, last)
+			return items, page, err
+		}
+
+		var item T
+		if err := cursor.Decode(&item); err != nil {
+			return nil, nil, err
+		}
+		items = append(items, &item)
+		// Current is only valid until the next call to Next
+		last = append(bson.Raw(nil), cursor.Current...)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return items, &models.Page{Total: total}, nil
+}
+
+func encodeCursor(field string, document bson.Raw) (string, error) {
+	id, ok := document.Lookup("_id").ObjectIDOK()
+	if !ok {
+		return "", repository.ErrInvalidCursor
+	}
+
+	data, err := bson.Marshal(cursorPosition{Field: field, Value: document.Lookup(field), ID: id})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor decodes a cursor issued for sorting by field. The value must
+// have the field's type: cursors are client input, and a document or array
+// value would be read as query operators.
+func decodeCursor(encoded, field string, valueType bsontype.Type) (*cursorPosition, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	var position cursorPosition
+	if err := bson.Unmarshal(data, &position); err != nil {
+		return nil, err
+	}
+
+	if position.Field != field || position.Value.Type != valueType || !isScalar(valueType) {
+		return nil, repository.ErrInvalidCursor
+	}
+	if err := position.Value.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &position, nil
+}
+
+// isScalar reports whether values of the type can't hold query operators
+func isScalar(valueType bsontype.Type) bool {
+	switch valueType {
+	case bsontype.String, bsontype.DateTime, bsontype.Int32, bsontype.Int64,
+		bsontype.Double, bsontype.Decimal128, bsontype.Boolean, bsontype.ObjectID:
+		return true
+	}
+	return false
+}
+
+// containsFilter matches a case-insensitive substring. The value is
+// escaped, so it can't inject a regular expression.
+func containsFilter(value string) bson.M {
+	return bson.M{"$regex": regexp.QuoteMeta(value), "$options": "i"}
+}
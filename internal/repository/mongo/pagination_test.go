@@ -0,0 +1,98 @@
+package mongo
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// craftCursor encodes a cursor the way a client could forge one
+func craftCursor(t *testing.T, field string, value any) string {
+	t.Helper()
+
+	data, err := bson.Marshal(bson.M{"f": field, "v": value, "id": primitive.NewObjectID()})
+	if err != nil {
+		t.Fatalf("bson.Marshal() error = %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		field     string
+		valueType bsontype.Type
+		document  bson.M
+	}{
+		{"string", "name", bsontype.String, bson.M{"_id": id, "name": "Jane"}},
+		{"empty string", "name", bsontype.String, bson.M{"_id": id, "name": ""}},
+		{"date", "created_at", bsontype.DateTime, bson.M{"_id": id, "created_at": createdAt}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, err := bson.Marshal(tt.document)
+			if err != nil {
+				t.Fatalf("bson.Marshal() error = %v", err)
+			}
+
+			encoded, err := encodeCursor(tt.field, document)
+			if err != nil {
+				t.Fatalf("encodeCursor() error = %v", err)
+			}
+
+			position, err := decodeCursor(encoded, tt.field, tt.valueType)
+			if err != nil {
+				t.Fatalf("decodeCursor() error = %v", err)
+			}
+			if position.ID != id || !position.Value.Equal(bson.Raw(document).Lookup(tt.field)) {
+				t.Errorf("decodeCursor() = %+v, want the document's %s and _id", position, tt.field)
+			}
+		})
+	}
+}
+
+func TestEncodeCursorRequiresID(t *testing.T) {
+	document, _ := bson.Marshal(bson.M{"name": "Jane"})
+	if _, err := encodeCursor("name", document); err == nil {
+		t.Errorf("encodeCursor() without _id succeeded, want error")
+	}
+}
+
+func TestDecodeCursorRejectsForgedValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  string
+		field   string
+		wantErr bool
+	}{
+		{"valid string", craftCursor(t, "name", "Jane"), "name", false},
+		{"valid date", craftCursor(t, "created_at", time.Now()), "created_at", false},
+		{"other sort field", craftCursor(t, "email", "jane@example.com"), "name", true},
+		{"operator document", craftCursor(t, "name", bson.M{"$ne": nil}), "name", true},
+		{"regex operator", craftCursor(t, "name", bson.M{"$regex": ".*"}), "name", true},
+		{"array", craftCursor(t, "name", bson.A{"a", "b"}), "name", true},
+		{"number for a string field", craftCursor(t, "name", 1), "name", true},
+		{"string for a date field", craftCursor(t, "created_at", "2024-01-01"), "created_at", true},
+		{"null", craftCursor(t, "name", nil), "name", true},
+		{"not base64", "!!!", "name", true},
+		{"not bson", base64.RawURLEncoding.EncodeToString([]byte("garbage")), "name", true},
+	}
+
+	sortFields := map[string]bsontype.Type{"name": bsontype.String, "created_at": bsontype.DateTime}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCursor(tt.cursor, tt.field, sortFields[tt.field])
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decodeCursor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type passwordResetRepository struct {
+	collection *mongo.Collection
+}
+
+func NewPasswordResetRepository(db *mongo.Database) *passwordResetRepository {
+	return &passwordResetRepository{
+		collection: db.Collection("password_resets"),
+	}
+}
+
+func (r *passwordResetRepository) Create(reset *models.PasswordReset) error {
+	reset.CreatedAt = time.Now()
+
+	result, err := r.collection.InsertOne(context.TODO(), reset)
+	if err != nil {
+		return err
+	}
+
+	reset.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetValidByHash returns an unused, unexpired token without consuming it
+func (r *passwordResetRepository) GetValidByHash(tokenHash string) (*models.PasswordReset, error) {
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"is_used":    false,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+
+	var reset models.PasswordReset
+	err := r.collection.FindOne(context.TODO(), filter).Decode(&reset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reset, nil
+}
+
+// Consume atomically marks a valid token as used and returns it, so a token
+// can never be redeemed twice
+func (r *passwordResetRepository) Consume(tokenHash string) (*models.PasswordReset, error) {
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"is_used":    false,
+		"expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"is_used": true,
+			"used_at": &now,
+		},
+	}
+
+	var reset models.PasswordReset
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.collection.FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(&reset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reset, nil
+}
+
+// InvalidateByUserID marks every outstanding token of the user as used
+func (r *passwordResetRepository) InvalidateByUserID(userID primitive.ObjectID) error {
+	now := time.Now()
+	filter := bson.M{
+		"user_id": userID,
+		"is_used": false,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"is_used": true,
+			"used_at": &now,
+		},
+	}
+
+	_, err := r.collection.UpdateMany(context.TODO(), filter, update)
+	return err
+}
@@ -0,0 +1,96 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type refreshTokenRepository struct {
+	collection *mongo.Collection
+}
+
+func NewRefreshTokenRepository(db *mongo.Database) *refreshTokenRepository {
+	return &refreshTokenRepository{
+		collection: db.Collection("refresh_tokens"),
+	}
+}
+
+func (r *refreshTokenRepository) Create(token *models.RefreshToken) error {
+	token.CreatedAt = time.Now()
+
+	result, err := r.collection.InsertOne(context.TODO(), token)
+	if err != nil {
+		return err
+	}
+
+	token.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetByHash returns the token regardless of its state so callers can detect reuse
+func (r *refreshTokenRepository) GetByHash(tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.collection.FindOne(context.TODO(), bson.M{"token_hash": tokenHash}).Decode(&token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// MarkRotated flags a live token as used. It reports false when the token was
+// already rotated or revoked, which lets concurrent refreshes be detected.
+func (r *refreshTokenRepository) MarkRotated(id primitive.ObjectID) (bool, error) {
+	filter := bson.M{
+		"_id":        id,
+		"rotated_at": nil,
+		"revoked_at": nil,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"rotated_at": time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *refreshTokenRepository) RevokeFamily(familyID primitive.ObjectID) error {
+	filter := bson.M{
+		"family_id":  familyID,
+		"revoked_at": nil,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"revoked_at": time.Now(),
+		},
+	}
+
+	_, err := r.collection.UpdateMany(context.TODO(), filter, update)
+	return err
+}
+
+func (r *refreshTokenRepository) RevokeByUserID(userID primitive.ObjectID) error {
+	filter := bson.M{
+		"user_id":    userID,
+		"revoked_at": nil,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"revoked_at": time.Now(),
+		},
+	}
+
+	_, err := r.collection.UpdateMany(context.TODO(), filter, update)
+	return err
+}
@@ -0,0 +1,117 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type roleGrantRepository struct {
+	collection *mongo.Collection
+}
+
+func NewRoleGrantRepository(db *mongo.Database) *roleGrantRepository {
+	return &roleGrantRepository{
+		collection: db.Collection("role_grants"),
+	}
+}
+
+func (r *roleGrantRepository) Create(grant *models.RoleGrant) error {
+	grant.CreatedAt = time.Now()
+
+	result, err := r.collection.InsertOne(context.TODO(), grant)
+	if err != nil {
+		return err
+	}
+
+	grant.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *roleGrantRepository) GetByID(id primitive.ObjectID) (*models.RoleGrant, error) {
+	var grant models.RoleGrant
+	err := r.collection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&grant)
+	if err != nil {
+		return nil, err
+	}
+
+	return &grant, nil
+}
+
+// ListByUserID returns the user's grants, most recent first
+func (r *roleGrantRepository) ListByUserID(userID primitive.ObjectID) ([]*models.RoleGrant, error) {
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	return r.find(bson.M{"user_id": userID}, opts)
+}
+
+// ListUnexpiredByUserID returns the user's grants that haven't ended yet,
+// including those that haven't started
+func (r *roleGrantRepository) ListUnexpiredByUserID(userID primitive.ObjectID, now time.Time) ([]*models.RoleGrant, error) {
+	return r.find(bson.M{
+		"user_id":    userID,
+		"expires_at": bson.M{"$gt": now},
+	})
+}
+
+// ListDue returns ended grants the sweeper hasn't processed yet
+func (r *roleGrantRepository) ListDue(now time.Time) ([]*models.RoleGrant, error) {
+	return r.find(bson.M{
+		"expired":    false,
+		"expires_at": bson.M{"$lte": now},
+	})
+}
+
+// MarkExpired flags the grant as processed. It reports false when another
+// instance got there first.
+func (r *roleGrantRepository) MarkExpired(id primitive.ObjectID) (bool, error) {
+	filter := bson.M{"_id": id, "expired": false}
+	update := bson.M{"$set": bson.M{"expired": true}}
+
+	result, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *roleGrantRepository) Delete(id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(context.TODO(), bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (r *roleGrantRepository) find(filter bson.M, opts ...*options.FindOptions) ([]*models.RoleGrant, error) {
+	cursor, err := r.collection.Find(context.TODO(), filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var grants []*models.RoleGrant
+	for cursor.Next(context.TODO()) {
+		var grant models.RoleGrant
+		if err := cursor.Decode(&grant); err != nil {
+			return nil, err
+		}
+		grants = append(grants, &grant)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
@@ -5,13 +5,20 @@ import (
 	"time"
 
 	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type roleRepository struct {
 	collection *mongo.Collection
+	// tenant, when set, limits every call to one organization's roles. Roles
+	// without a tenant are shared: any tenant can read them, only the zero
+	// (default) scope can change them.
+	tenant *primitive.ObjectID
 }
 
 func NewRoleRepository(db *mongo.Database) *roleRepository {
@@ -20,11 +27,69 @@ func NewRoleRepository(db *mongo.Database) *roleRepository {
 	}
 }
 
+// ForTenant returns a copy of the repository scoped to the organization
+func (r *roleRepository) ForTenant(tenantID primitive.ObjectID) repository.RoleRepository {
+	return &roleRepository{
+		collection: r.collection,
+		tenant:     &tenantID,
+	}
+}
+
+// readScope adds the tenant condition for reads, which include shared roles
+func (r *roleRepository) readScope(filter bson.M) bson.M {
+	if r.tenant == nil {
+		return filter
+	}
+
+	if r.tenant.IsZero() {
+		filter["tenant_id"] = bson.M{"$exists": false}
+	} else {
+		filter["$or"] = []bson.M{
+			{"tenant_id": *r.tenant},
+			{"tenant_id": bson.M{"$exists": false}},
+		}
+	}
+
+	return filter
+}
+
+// writeScope adds the tenant condition for writes, which only touch the tenant's own roles
+func (r *roleRepository) writeScope(filter bson.M) bson.M {
+	if r.tenant == nil {
+		return filter
+	}
+
+	if r.tenant.IsZero() {
+		filter["tenant_id"] = bson.M{"$exists": false}
+	} else {
+		filter["tenant_id"] = *r.tenant
+	}
+
+	return filter
+}
+
+// nameFilter matches a role by name. Names are only unique within a tenant,
+// so the unscoped repository looks up shared roles.
+func (r *roleRepository) nameFilter(name string) bson.M {
+	filter := bson.M{"name": name}
+	if r.tenant == nil {
+		filter["tenant_id"] = bson.M{"$exists": false}
+		return filter
+	}
+	return r.readScope(filter)
+}
+
 func (r *roleRepository) Create(role *models.Role) error {
 	role.CreatedAt = time.Now()
 	role.UpdatedAt = time.Now()
+	if r.tenant != nil {
+		role.TenantID = *r.tenant
+	}
 
 	result, err := r.collection.InsertOne(context.TODO(), role)
+	if mongo.IsDuplicateKeyError(err) {
+		return repository.ErrRoleNameTaken
+	}
 	if err != nil {
 		return err
 	}
@@ -35,7 +100,7 @@ func (r *roleRepository) Create(role *models.Role) error {
 
 func (r *roleRepository) GetByID(id primitive.ObjectID) (*models.Role, error) {
 	var role models.Role
-	err := r.collection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&role)
+	err := r.collection.FindOne(context.TODO(), r.readScope(bson.M{"_id": id})).Decode(&role)
 	if err != nil {
 		return nil, err
 	}
@@ -43,9 +108,10 @@ func (r *roleRepository) GetByID(id primitive.ObjectID) (*models.Role, error) {
 	return &role, nil
 }
 
+// GetByName finds a role by name
 func (r *roleRepository) GetByName(name string) (*models.Role, error) {
 	var role models.Role
-	err := r.collection.FindOne(context.TODO(), bson.M{"name": name}).Decode(&role)
+	err := r.collection.FindOne(context.TODO(), r.nameFilter(name)).Decode(&role)
 	if err != nil {
 		return nil, err
 	}
@@ -54,23 +120,252 @@ func (r *roleRepository) GetByName(name string) (*models.Role, error) {
 }
 
 func (r *roleRepository) Update(id primitive.ObjectID, role *models.Role) error {
+	return r.update(context.TODO(), id, role)
+}
+
+func (r *roleRepository) update(ctx context.Context, id primitive.ObjectID, role *models.Role) error {
 	role.UpdatedAt = time.Now()
 	role.ID = id
+	if r.tenant != nil {
+		role.TenantID = *r.tenant
+	}
 
-	filter := bson.M{"_id": id}
+	filter := r.writeScope(bson.M{"_id": id})
 	update := bson.M{"$set": role}
 
-	_, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	_, err := r.collection.UpdateOne(ctx, filter, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return repository.ErrRoleNameTaken
+	}
+	return err
+}
+
+// UpdateKeepingAdmins updates the role unless afterwards no active user of
+// the tenant would hold one of adminRoleIDs
+func (r *roleRepository) UpdateKeepingAdmins(id primitive.ObjectID, role *models.Role, adminRoleIDs []primitive.ObjectID) error {
+	return r.keepingAdmins(adminRoleIDs, func(ctx mongo.SessionContext) error {
+		return r.update(ctx, id, role)
+	})
+}
+
+// AssignKeepingAdmins moves the user to the role in the tenant, their
+// account's role in the default scope or their membership in an
+// organization, unless afterwards no active user of the tenant would hold
+// one of adminRoleIDs
+func (r *roleRepository) AssignKeepingAdmins(userID, roleID primitive.ObjectID, adminRoleIDs []primitive.ObjectID) error {
+	db := r.collection.Database()
+
+	return r.keepingAdmins(adminRoleIDs, func(ctx mongo.SessionContext) error {
+		now := time.Now()
+		if r.tenant == nil || r.tenant.IsZero() {
+			_, err := db.Collection("user_auth").UpdateOne(ctx,
+				bson.M{"user_id": userID},
+				bson.M{"$set": bson.M{"role_id": roleID, "updated_at": now}},
+			)
+			return err
+		}
+
+		_, err := db.Collection("memberships").UpdateOne(ctx,
+			bson.M{"organization_id": *r.tenant, "user_id": userID},
+			bson.M{
+				"$set":         bson.M{"role_id": roleID, "updated_at": now},
+				"$setOnInsert": bson.M{"created_at": now},
+			},
+			options.Update().SetUpsert(true),
+		)
+		return err
+	})
+}
+
+// keepingAdmins runs write in a transaction, which needs a replica set, and
+// aborts it with repository.ErrLastAdmin when no active user of the tenant
+// holds one of adminRoleIDs afterwards. Every guarded write also bumps the
+// tenant's admin guard document, so two concurrent demotions conflict and
+// the retried one sees the other instead of both counting the same admins.
+func (r *roleRepository) keepingAdmins(adminRoleIDs []primitive.ObjectID, write func(ctx mongo.SessionContext) error) error {
+	session, err := r.collection.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.TODO())
+
+	db := r.collection.Database()
+	tenantID := primitive.NilObjectID
+	if r.tenant != nil {
+		tenantID = *r.tenant
+	}
+
+	_, err = session.WithTransaction(context.TODO(), func(ctx mongo.SessionContext) (interface{}, error) {
+		if _, err := db.Collection("admin_guards").UpdateOne(ctx,
+			bson.M{"_id": tenantID},
+			bson.M{"$inc": bson.M{"version": 1}},
+			options.Update().SetUpsert(true),
+		); err != nil {
+			return nil, err
+		}
+
+		if err := write(ctx); err != nil {
+			return nil, err
+		}
+
+		holders := db.Collection("user_auth")
+		filter := bson.M{"role_id": bson.M{"$in": adminRoleIDs}, "is_active": true}
+		if !tenantID.IsZero() {
+			holders = db.Collection("memberships")
+			filter = bson.M{"role_id": bson.M{"$in": adminRoleIDs}, "organization_id": tenantID}
+		}
+
+		admins, err := holders.CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		if admins == 0 {
+			return nil, repository.ErrLastAdmin
+		}
+
+		return nil, nil
+	})
 	return err
 }
 
 func (r *roleRepository) Delete(id primitive.ObjectID) error {
-	_, err := r.collection.DeleteOne(context.TODO(), bson.M{"_id": id})
+	_, err := r.collection.DeleteOne(context.TODO(), r.writeScope(bson.M{"_id": id}))
+	return err
+}
+
+// roleSortFields are the fields role lists can be sorted by, with the type
+// of their values
+var roleSortFields = map[string]bsontype.Type{"name": bsontype.String, "created_at": bsontype.DateTime}
+
+// ListPage returns one page of the roles matching the filter
+func (r *roleRepository) ListPage(filter models.RoleFilter, query models.PageQuery) ([]*models.Role, *models.Page, error) {
+	conditions := bson.M{}
+	if filter.Name != "" {
+		conditions["name"] = containsFilter(filter.Name)
+	}
+	if filter.IsActive != nil {
+		conditions["is_active"] = *filter.IsActive
+	}
+
+	return findPage[models.Role](r.collection, r.readScope(conditions), query, roleSortFields)
+}
+
+// EnsureIndexes makes role names unique within each tenant, and among
+// shared roles
+func (r *roleRepository) EnsureIndexes() error {
+	_, err := r.collection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetName("roles_tenant_name").SetUnique(true),
+	})
+	return err
+}
+
+// MarkSystem flags the named shared roles as system roles
+func (r *roleRepository) MarkSystem(names []string) error {
+	filter := bson.M{
+		"name":      bson.M{"$in": names},
+		"tenant_id": bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{"is_system": true}}
+
+	_, err := r.collection.UpdateMany(context.TODO(), filter, update)
+	return err
+}
+
+// RemoveParent drops the role from every role that inherits from it
+func (r *roleRepository) RemoveParent(parentID primitive.ObjectID) error {
+	filter := bson.M{"parent_ids": parentID}
+	update := bson.M{"$pull": bson.M{"parent_ids": parentID}}
+
+	_, err := r.collection.UpdateMany(context.TODO(), filter, update)
+	return err
+}
+
+// DeleteAndReassign moves every user of the role to the replacement and
+// deletes the role in a single transaction, which needs a replica set.
+// Within an organization the users' memberships are moved instead. A shared
+// role can also be held through memberships, so deleting one moves those in
+// every organization as well. Without a replacement the holders are counted
+// inside the transaction, after the role is deleted, so a user assigned the
+// role since the caller last looked aborts the deletion.
+func (r *roleRepository) DeleteAndReassign(id, replacementID primitive.ObjectID) (int64, error) {
+	session, err := r.collection.Database().Client().StartSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.EndSession(context.TODO())
+
+	db := r.collection.Database()
+	holders := []*mongo.Collection{db.Collection("user_auth"), db.Collection("memberships")}
+	holderFilter := bson.M{"role_id": id}
+	if r.tenant != nil && !r.tenant.IsZero() {
+		holders = []*mongo.Collection{db.Collection("memberships")}
+		holderFilter["organization_id"] = *r.tenant
+	}
+
+	result, err := session.WithTransaction(context.TODO(), func(ctx mongo.SessionContext) (interface{}, error) {
+		if replacementID.IsZero() {
+			return int64(0), r.deleteUnheld(ctx, id, holders, holderFilter)
+		}
+
+		var reassigned int64
+		for _, collection := range holders {
+			moved, err := collection.UpdateMany(ctx,
+				holderFilter,
+				bson.M{"$set": bson.M{"role_id": replacementID, "updated_at": time.Now()}},
+			)
+			if err != nil {
+				return nil, err
+			}
+			reassigned += moved.ModifiedCount
+		}
+
+		if _, err := r.collection.UpdateMany(ctx,
+			bson.M{"parent_ids": id},
+			bson.M{"$pull": bson.M{"parent_ids": id}},
+		); err != nil {
+			return nil, err
+		}
+
+		if _, err := r.collection.DeleteOne(ctx, r.writeScope(bson.M{"_id": id})); err != nil {
+			return nil, err
+		}
+
+		return reassigned, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.(int64), nil
+}
+
+// deleteUnheld deletes the role and drops it as a parent, failing with
+// repository.ErrRoleInUse when any holder is left
+func (r *roleRepository) deleteUnheld(ctx mongo.SessionContext, id primitive.ObjectID, holders []*mongo.Collection, holderFilter bson.M) error {
+	if _, err := r.collection.DeleteOne(ctx, r.writeScope(bson.M{"_id": id})); err != nil {
+		return err
+	}
+
+	for _, collection := range holders {
+		count, err := collection.CountDocuments(ctx, holderFilter, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return repository.ErrRoleInUse
+		}
+	}
+
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"parent_ids": id},
+		bson.M{"$pull": bson.M{"parent_ids": id}},
+	)
 	return err
 }
 
 func (r *roleRepository) List() ([]*models.Role, error) {
-	cursor, err := r.collection.Find(context.TODO(), bson.M{})
+	cursor, err := r.collection.Find(context.TODO(), r.readScope(bson.M{}))
 	if err != nil {
 		return nil, err
 	}
@@ -91,24 +386,3 @@ func (r *roleRepository) List() ([]*models.Role, error) {
 
 	return roles, nil
 }
-
-func (r *roleRepository) HasPermission(roleID primitive.ObjectID, resource, action string) (bool, error) {
-	var role models.Role
-	err := r.collection.FindOne(context.TODO(), bson.M{
-		"_id":       roleID,
-		"is_active": true,
-	}).Decode(&role)
-
-	if err != nil {
-		return false, err
-	}
-
-	permission := models.NewPermission(resource, action)
-	for _, p := range role.Permissions {
-		if p.Resource == permission.Resource && p.Action == permission.Action {
-			return true, nil
-		}
-	}
-
-	return false, nil
-}
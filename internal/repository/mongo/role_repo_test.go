@@ -0,0 +1,90 @@
+package mongo
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRoleRepositoryNameFilter(t *testing.T) {
+	orgA := primitive.NewObjectID()
+	shared := bson.M{"$exists": false}
+
+	tests := []struct {
+		name string
+		repo *roleRepository
+		want bson.M
+	}{
+		// Registration resolves the default role without a tenant, and must
+		// never pick an organization's role of the same name
+		{"unscoped finds shared roles only", &roleRepository{}, bson.M{"name": "user", "tenant_id": shared}},
+		{"default scope finds shared roles", &roleRepository{tenant: &primitive.NilObjectID}, bson.M{"name": "user", "tenant_id": shared}},
+		{"organization finds its own and shared roles", &roleRepository{tenant: &orgA}, bson.M{"name": "user", "$or": []bson.M{
+			{"tenant_id": orgA},
+			{"tenant_id": shared},
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.repo.nameFilter("user"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nameFilter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleRepositoryScopes(t *testing.T) {
+	id := primitive.NewObjectID()
+	orgA := primitive.NewObjectID()
+	shared := bson.M{"$exists": false}
+
+	tests := []struct {
+		name  string
+		repo  *roleRepository
+		write bool
+		want  bson.M
+	}{
+		{"unscoped read", &roleRepository{}, false, bson.M{"_id": id}},
+		{"unscoped write", &roleRepository{}, true, bson.M{"_id": id}},
+		{"default scope read sees shared roles", &roleRepository{tenant: &primitive.NilObjectID}, false, bson.M{"_id": id, "tenant_id": shared}},
+		{"default scope write changes shared roles", &roleRepository{tenant: &primitive.NilObjectID}, true, bson.M{"_id": id, "tenant_id": shared}},
+		{"organization read sees its own and shared roles", &roleRepository{tenant: &orgA}, false, bson.M{"_id": id, "$or": []bson.M{
+			{"tenant_id": orgA},
+			{"tenant_id": shared},
+		}}},
+		// Organizations can read shared roles but never change them
+		{"organization write changes its own roles only", &roleRepository{tenant: &orgA}, true, bson.M{"_id": id, "tenant_id": orgA}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bson.M
+			if tt.write {
+				got = tt.repo.writeScope(bson.M{"_id": id})
+			} else {
+				got = tt.repo.readScope(bson.M{"_id": id})
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleRepositoryForTenant(t *testing.T) {
+	orgA := primitive.NewObjectID()
+	orgB := primitive.NewObjectID()
+
+	repo := &roleRepository{}
+	scopedA := repo.ForTenant(orgA).(*roleRepository)
+	scopedB := repo.ForTenant(orgB).(*roleRepository)
+
+	// Each scope keeps its own tenant and the base repository stays unscoped
+	if *scopedA.tenant != orgA || *scopedB.tenant != orgB || repo.tenant != nil {
+		t.Errorf("ForTenant() tenants = %v, %v, base %v", *scopedA.tenant, *scopedB.tenant, repo.tenant)
+	}
+}
@@ -0,0 +1,145 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/madhiyono/base-api-nosql/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type sessionRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSessionRepository(db *mongo.Database) *sessionRepository {
+	return &sessionRepository{
+		collection: db.Collection("sessions"),
+	}
+}
+
+// Create stores a session. The ID is kept when already set, since it is shared
+// with the refresh token family.
+func (r *sessionRepository) Create(session *models.Session) error {
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+	session.CreatedAt = time.Now()
+	session.LastSeenAt = session.CreatedAt
+
+	_, err := r.collection.InsertOne(context.TODO(), session)
+	return err
+}
+
+func (r *sessionRepository) GetByID(id primitive.ObjectID) (*models.Session, error) {
+	var session models.Session
+	err := r.collection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// ListActiveByUserID returns sessions that are neither revoked nor expired,
+// most recently used first
+func (r *sessionRepository) ListActiveByUserID(userID primitive.ObjectID) ([]*models.Session, error) {
+	filter := bson.M{
+		"user_id":    userID,
+		"revoked_at": nil,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	opts := options.Find().SetSort(bson.M{"last_seen_at": -1})
+
+	cursor, err := r.collection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var sessions []*models.Session
+	for cursor.Next(context.TODO()) {
+		var session models.Session
+		if err := cursor.Decode(&session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (r *sessionRepository) UpdateLastSeen(id primitive.ObjectID) error {
+	filter := bson.M{"_id": id}
+	update := bson.M{
+		"$set": bson.M{
+			"last_seen_at": time.Now(),
+		},
+	}
+
+	_, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	return err
+}
+
+// Extend moves the expiry of a session forward, e.g. after a refresh
+// SetTenant records the organization selected for the session
+func (r *sessionRepository) SetTenant(id, tenantID primitive.ObjectID) error {
+	filter := bson.M{"_id": id}
+	update := bson.M{"$set": bson.M{"tenant_id": tenantID}}
+	if tenantID.IsZero() {
+		update = bson.M{"$unset": bson.M{"tenant_id": ""}}
+	}
+
+	_, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	return err
+}
+
+func (r *sessionRepository) Extend(id primitive.ObjectID, expiresAt time.Time) error {
+	filter := bson.M{"_id": id}
+	update := bson.M{
+		"$set": bson.M{
+			"last_seen_at": time.Now(),
+			"expires_at":   expiresAt,
+		},
+	}
+
+	_, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	return err
+}
+
+func (r *sessionRepository) Revoke(id primitive.ObjectID) error {
+	filter := bson.M{
+		"_id":        id,
+		"revoked_at": nil,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"revoked_at": time.Now(),
+		},
+	}
+
+	_, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	return err
+}
+
+func (r *sessionRepository) RevokeByUserID(userID primitive.ObjectID) error {
+	filter := bson.M{
+		"user_id":    userID,
+		"revoked_at": nil,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"revoked_at": time.Now(),
+		},
+	}
+
+	_, err := r.collection.UpdateMany(context.TODO(), filter, update)
+	return err
+}
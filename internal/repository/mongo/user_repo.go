@@ -2,16 +2,23 @@ package mongo
 
 import (
 	"context"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/madhiyono/base-api-nosql/internal/models"
+	"github.com/madhiyono/base-api-nosql/internal/repository"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type userRepository struct {
 	collection *mongo.Collection
+	// tenant, when set, limits every call to members of one organization
+	tenant primitive.ObjectID
 }
 
 func NewUserRepository(db *mongo.Database) *userRepository {
@@ -20,9 +27,39 @@ func NewUserRepository(db *mongo.Database) *userRepository {
 	}
 }
 
+// ForTenant returns a copy of the repository scoped to the organization
+func (r *userRepository) ForTenant(tenantID primitive.ObjectID) repository.UserRepository {
+	return &userRepository{
+		collection: r.collection,
+		tenant:     tenantID,
+	}
+}
+
+// scope adds the tenant condition to a filter. The default scope is the
+// platform itself and sees every user.
+func (r *userRepository) scope(filter bson.M) bson.M {
+	if !r.tenant.IsZero() {
+		filter["organization_ids"] = r.tenant
+	}
+	return filter
+}
+
+// writeScope adds the tenant condition for changes. Within an organization
+// only users who belong to no other organization can be changed, as the
+// document is shared by every organization the user is a member of.
+func (r *userRepository) writeScope(filter bson.M) bson.M {
+	if !r.tenant.IsZero() {
+		filter["organization_ids"] = []primitive.ObjectID{r.tenant}
+	}
+	return filter
+}
+
 func (r *userRepository) Create(user *models.User) error {
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
+	if !r.tenant.IsZero() {
+		user.OrganizationIDs = []primitive.ObjectID{r.tenant}
+	}
 
 	result, err := r.collection.InsertOne(context.TODO(), user)
 
@@ -41,7 +78,7 @@ func (r *userRepository) GetByID(id string) (*models.User, error) {
 	}
 
 	var user models.User
-	err = r.collection.FindOne(context.TODO(), bson.M{"_id": objectID}).Decode(&user)
+	err = r.collection.FindOne(context.TODO(), r.scope(bson.M{"_id": objectID})).Decode(&user)
 
 	if err != nil {
 		return nil, err
@@ -59,7 +96,7 @@ func (r *userRepository) Update(id string, user *models.User) error {
 	user.UpdatedAt = time.Now()
 	user.ID = objectID
 
-	filter := bson.M{"_id": objectID}
+	filter := r.writeScope(bson.M{"_id": objectID})
 	update := bson.M{"$set": user}
 
 	_, err = r.collection.UpdateOne(context.TODO(), filter, update)
@@ -72,12 +109,12 @@ func (r *userRepository) Delete(id string) error {
 		return err
 	}
 
-	_, err = r.collection.DeleteOne(context.TODO(), bson.M{"_id": objectID})
+	_, err = r.collection.DeleteOne(context.TODO(), r.writeScope(bson.M{"_id": objectID}))
 	return err
 }
 
 func (r *userRepository) List() ([]*models.User, error) {
-	cursor, err := r.collection.Find(context.TODO(), bson.M{})
+	cursor, err := r.collection.Find(context.TODO(), r.scope(bson.M{}))
 	if err != nil {
 		return nil, err
 	}
@@ -99,13 +136,142 @@ func (r *userRepository) List() ([]*models.User, error) {
 	return users, nil
 }
 
+// userSortFields are the fields user lists can be sorted by, with the type
+// of their values
+var userSortFields = map[string]bsontype.Type{"name": bsontype.String, "email": bsontype.String, "created_at": bsontype.DateTime}
+
+// ListPage returns one page of the users matching the filter
+func (r *userRepository) ListPage(filter models.UserFilter, query models.PageQuery) ([]*models.User, *models.Page, error) {
+	conditions := bson.M{}
+	if filter.Name != "" {
+		conditions["name"] = containsFilter(filter.Name)
+	}
+	if filter.Email != "" {
+		conditions["email"] = containsFilter(filter.Email)
+	}
+	if !filter.CreatedFrom.IsZero() || !filter.CreatedTo.IsZero() {
+		createdAt := bson.M{}
+		if !filter.CreatedFrom.IsZero() {
+			createdAt["$gte"] = filter.CreatedFrom
+		}
+		if !filter.CreatedTo.IsZero() {
+			createdAt["$lte"] = filter.CreatedTo
+		}
+		conditions["created_at"] = createdAt
+	}
+
+	return findPage[models.User](r.collection, r.scope(conditions), query, userSortFields)
+}
+
+// maxSearchLength caps the search term, in characters
+const maxSearchLength = 100
+
+// Search finds users by name or email. Whole words are matched through the
+// text index and ranked by relevance; when nothing matches, names and
+// emails starting with the term are returned instead, sorted by name.
+// Only offset pagination is supported.
+func (r *userRepository) Search(term string, query models.PageQuery) ([]*models.User, *models.Page, error) {
+	term = sanitizeSearchTerm(term)
+	if term == "" {
+		return []*models.User{}, &models.Page{}, nil
+	}
+
+	textFilter := r.scope(bson.M{"$text": bson.M{"$search": term}})
+	total, err := r.collection.CountDocuments(context.TODO(), textFilter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if total > 0 {
+		score := bson.M{"$meta": "textScore"}
+		opts := options.Find().
+			SetProjection(bson.M{"score": score}).
+			SetSort(bson.D{{Key: "score", Value: score}, {Key: "_id", Value: 1}}).
+			SetSkip(query.Offset).
+			SetLimit(query.Limit)
+		return r.findSearchPage(textFilter, total, opts)
+	}
+
+	// Partial words aren't in the text index, so fall back to prefixes
+	prefix := regexp.QuoteMeta(term)
+	prefixFilter := r.scope(bson.M{"$or": []bson.M{
+		{"name": bson.M{"$regex": `(^|\s)` + prefix, "$options": "i"}},
+		{"email": bson.M{"$regex": "^" + prefix, "$options": "i"}},
+	}})
+	total, err = r.collection.CountDocuments(context.TODO(), prefixFilter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(query.Offset).
+		SetLimit(query.Limit)
+	return r.findSearchPage(prefixFilter, total, opts)
+}
+
+func (r *userRepository) findSearchPage(filter bson.M, total int64, opts *options.FindOptions) ([]*models.User, *models.Page, error) {
+	cursor, err := r.collection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	users := []*models.User{}
+	for cursor.Next(context.TODO()) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return nil, nil, err
+		}
+		users = append(users, &user)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return users, &models.Page{Total: total}, nil
+}
+
+// sanitizeSearchTerm drops the text search syntax (quoted phrases and
+// negation), so the term is only ever a list of words
+func sanitizeSearchTerm(term string) string {
+	term = strings.ReplaceAll(term, `"`, " ")
+
+	words := strings.Fields(term)
+	for i, word := range words {
+		words[i] = strings.TrimLeft(word, "-")
+	}
+	term = strings.Join(strings.Fields(strings.Join(words, " ")), " ")
+
+	if runes := []rune(term); len(runes) > maxSearchLength {
+		term = string(runes[:maxSearchLength])
+	}
+	return term
+}
+
+// EnsureIndexes creates the indexes user lists and search rely on
+func (r *userRepository) EnsureIndexes() error {
+	_, err := r.collection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "name", Value: "text"}, {Key: "email", Value: "text"}},
+			Options: options.Index().SetName("users_text").SetWeights(bson.M{"name": 2, "email": 1}),
+		},
+		{Keys: bson.D{{Key: "name", Value: 1}}},
+		{Keys: bson.D{{Key: "email", Value: 1}}},
+		{Keys: bson.D{{Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "organization_ids", Value: 1}}},
+	})
+	return err
+}
+
 func (r *userRepository) UpdateProfilePhoto(id string, photoURL string) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return err
 	}
 
-	filter := bson.M{"_id": objectID}
+	filter := r.writeScope(bson.M{"_id": objectID})
 	update := bson.M{
 		"$set": bson.M{
 			"profile_photo": photoURL,
@@ -116,3 +282,39 @@ func (r *userRepository) UpdateProfilePhoto(id string, photoURL string) error {
 	_, err = r.collection.UpdateOne(context.TODO(), filter, update)
 	return err
 }
+
+func (r *userRepository) UpdateEmail(id string, email string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	filter := r.writeScope(bson.M{"_id": objectID})
+	update := bson.M{
+		"$set": bson.M{
+			"email":      email,
+			"updated_at": time.Now(),
+		},
+	}
+
+	_, err = r.collection.UpdateOne(context.TODO(), filter, update)
+	return err
+}
+
+// AddOrganization records a membership on the user document
+func (r *userRepository) AddOrganization(userID, organizationID primitive.ObjectID) error {
+	filter := bson.M{"_id": userID}
+	update := bson.M{"$addToSet": bson.M{"organization_ids": organizationID}}
+
+	_, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	return err
+}
+
+// RemoveOrganization drops a membership from the user document
+func (r *userRepository) RemoveOrganization(userID, organizationID primitive.ObjectID) error {
+	filter := bson.M{"_id": userID}
+	update := bson.M{"$pull": bson.M{"organization_ids": organizationID}}
+
+	_, err := r.collection.UpdateOne(context.TODO(), filter, update)
+	return err
+}
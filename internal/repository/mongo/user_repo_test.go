@@ -0,0 +1,44 @@
+package mongo
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUserRepositoryScopes(t *testing.T) {
+	id := primitive.NewObjectID()
+	orgA := primitive.NewObjectID()
+
+	tests := []struct {
+		name   string
+		tenant primitive.ObjectID
+		write  bool
+		want   bson.M
+	}{
+		{"default scope read", primitive.NilObjectID, false, bson.M{"_id": id}},
+		{"default scope write", primitive.NilObjectID, true, bson.M{"_id": id}},
+		{"organization read matches any member", orgA, false, bson.M{"_id": id, "organization_ids": orgA}},
+		// An exact array match leaves out users who also belong to orgB
+		{"organization write matches sole members", orgA, true, bson.M{"_id": id, "organization_ids": []primitive.ObjectID{orgA}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &userRepository{tenant: tt.tenant}
+
+			var got bson.M
+			if tt.write {
+				got = repo.writeScope(bson.M{"_id": id})
+			} else {
+				got = repo.scope(bson.M{"_id": id})
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
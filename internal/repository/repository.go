@@ -1,17 +1,44 @@
 package repository
 
 import (
+	"errors"
+	"time"
+
 	"github.com/madhiyono/base-api-nosql/internal/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	// ErrInvalidCursor is returned for a pagination cursor that wasn't issued
+	// for the requested sort
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidSort is returned when sorting by a field that isn't allowed
+	ErrInvalidSort = errors.New("invalid sort field")
+	// ErrRoleNameTaken is returned when a tenant already has a role with the name
+	ErrRoleNameTaken = errors.New("role name already exists")
+	// ErrLastAdmin is returned when a write would leave a tenant without an
+	// active administrator
+	ErrLastAdmin = errors.New("cannot remove the last administrator")
+	// ErrRoleInUse is returned when deleting a role without a replacement
+	// while users still hold it
+	ErrRoleInUse = errors.New("role is assigned to users, a replacement role is required")
+)
+
 type UserRepository interface {
 	Create(user *models.User) error
 	GetByID(id string) (*models.User, error)
 	Update(id string, user *models.User) error
 	Delete(id string) error
 	List() ([]*models.User, error)
+	ListPage(filter models.UserFilter, query models.PageQuery) ([]*models.User, *models.Page, error)
+	Search(term string, query models.PageQuery) ([]*models.User, *models.Page, error)
+	EnsureIndexes() error
 	UpdateProfilePhoto(id string, photoURL string) error
+	UpdateEmail(id string, email string) error
+	AddOrganization(userID, organizationID primitive.ObjectID) error
+	RemoveOrganization(userID, organizationID primitive.ObjectID) error
+	// ForTenant scopes every call to the organization's members
+	ForTenant(tenantID primitive.ObjectID) UserRepository
 }
 
 type AuthRepository interface {
@@ -19,8 +46,17 @@ type AuthRepository interface {
 	GetByEmail(email string) (*models.UserAuth, error)
 	GetByUserID(userID primitive.ObjectID) (*models.UserAuth, error)
 	UpdatePassword(userID primitive.ObjectID, password string) error
+	UpdateEmail(userID primitive.ObjectID, email string) error
 	UpdateRole(userID, roleID primitive.ObjectID) error
+	ListByRoleID(roleID primitive.ObjectID) ([]*models.UserAuth, error)
+	CountByRoleID(roleID primitive.ObjectID) (int64, error)
+	CountActiveByRoleIDs(roleIDs []primitive.ObjectID) (int64, error)
 	ActivateUser(userID primitive.ObjectID) error
+	SetMFASecret(userID primitive.ObjectID, secret string) error
+	EnableMFA(userID primitive.ObjectID, recoveryCodes []string) error
+	DisableMFA(userID primitive.ObjectID) error
+	SetRecoveryCodes(userID primitive.ObjectID, recoveryCodes []string) error
+	UseRecoveryCode(userID primitive.ObjectID, recoveryCode string) (bool, error)
 }
 
 type RoleRepository interface {
@@ -28,9 +64,23 @@ type RoleRepository interface {
 	GetByID(id primitive.ObjectID) (*models.Role, error)
 	GetByName(name string) (*models.Role, error)
 	Update(id primitive.ObjectID, role *models.Role) error
+	// UpdateKeepingAdmins and AssignKeepingAdmins fail with ErrLastAdmin,
+	// atomically, when no active user of the tenant would hold one of
+	// adminRoleIDs afterwards
+	UpdateKeepingAdmins(id primitive.ObjectID, role *models.Role, adminRoleIDs []primitive.ObjectID) error
+	AssignKeepingAdmins(userID, roleID primitive.ObjectID, adminRoleIDs []primitive.ObjectID) error
 	Delete(id primitive.ObjectID) error
 	List() ([]*models.Role, error)
-	HasPermission(roleID primitive.ObjectID, resource, action string) (bool, error)
+	ListPage(filter models.RoleFilter, query models.PageQuery) ([]*models.Role, *models.Page, error)
+	MarkSystem(names []string) error
+	EnsureIndexes() error
+	RemoveParent(parentID primitive.ObjectID) error
+	// DeleteAndReassign moves the role's users to replacementID and deletes
+	// the role. With a zero replacementID it fails with ErrRoleInUse when
+	// anyone holds the role at the time of deletion.
+	DeleteAndReassign(id, replacementID primitive.ObjectID) (int64, error)
+	// ForTenant scopes every call to the organization's roles plus shared ones
+	ForTenant(tenantID primitive.ObjectID) RoleRepository
 }
 
 type VerificationRepository interface {
@@ -39,3 +89,88 @@ type VerificationRepository interface {
 	MarkAsUsed(id primitive.ObjectID) error
 	GetByUserID(userID primitive.ObjectID) (*models.EmailVerification, error)
 }
+
+type RefreshTokenRepository interface {
+	Create(token *models.RefreshToken) error
+	GetByHash(tokenHash string) (*models.RefreshToken, error)
+	MarkRotated(id primitive.ObjectID) (bool, error)
+	RevokeFamily(familyID primitive.ObjectID) error
+	RevokeByUserID(userID primitive.ObjectID) error
+}
+
+type PasswordResetRepository interface {
+	Create(reset *models.PasswordReset) error
+	GetValidByHash(tokenHash string) (*models.PasswordReset, error)
+	Consume(tokenHash string) (*models.PasswordReset, error)
+	InvalidateByUserID(userID primitive.ObjectID) error
+}
+
+type LoginHistoryRepository interface {
+	Create(event *models.LoginEvent) error
+	ListByUserID(userID primitive.ObjectID, limit int64) ([]*models.LoginEvent, error)
+}
+
+type IdentityRepository interface {
+	Create(identity *models.Identity) error
+	GetByProviderSubject(provider, subject string) (*models.Identity, error)
+	ListByUserID(userID primitive.ObjectID) ([]*models.Identity, error)
+	UpdateLastLogin(id primitive.ObjectID) error
+}
+
+type APIKeyRepository interface {
+	Create(key *models.APIKey) error
+	GetByHash(keyHash string) (*models.APIKey, error)
+	ListByUserID(userID primitive.ObjectID) ([]*models.APIKey, error)
+	Revoke(id, userID primitive.ObjectID) error
+	UpdateLastUsed(id primitive.ObjectID) error
+}
+
+type SessionRepository interface {
+	Create(session *models.Session) error
+	GetByID(id primitive.ObjectID) (*models.Session, error)
+	ListActiveByUserID(userID primitive.ObjectID) ([]*models.Session, error)
+	UpdateLastSeen(id primitive.ObjectID) error
+	Extend(id primitive.ObjectID, expiresAt time.Time) error
+	SetTenant(id, tenantID primitive.ObjectID) error
+	Revoke(id primitive.ObjectID) error
+	RevokeByUserID(userID primitive.ObjectID) error
+}
+
+type MagicLinkRepository interface {
+	Create(link *models.MagicLink) error
+	Consume(tokenHash string) (*models.MagicLink, error)
+	InvalidateByUserID(userID primitive.ObjectID) error
+}
+
+type AuditLogRepository interface {
+	Create(entry *models.AuditLog) error
+	ListByUserID(userID primitive.ObjectID, limit int64) ([]*models.AuditLog, error)
+}
+
+type OrganizationRepository interface {
+	Create(organization *models.Organization) error
+	GetByID(id primitive.ObjectID) (*models.Organization, error)
+	List() ([]*models.Organization, error)
+}
+
+type MembershipRepository interface {
+	Upsert(membership *models.Membership) error
+	Get(organizationID, userID primitive.ObjectID) (*models.Membership, error)
+	ListByUserID(userID primitive.ObjectID) ([]*models.Membership, error)
+	ListByOrganizationID(organizationID primitive.ObjectID) ([]*models.Membership, error)
+	ListByRoleID(organizationID, roleID primitive.ObjectID) ([]*models.Membership, error)
+	// ListAllByRoleID returns the role's memberships in every organization
+	ListAllByRoleID(roleID primitive.ObjectID) ([]*models.Membership, error)
+	CountByRoleIDs(organizationID primitive.ObjectID, roleIDs []primitive.ObjectID) (int64, error)
+	Delete(organizationID, userID primitive.ObjectID) error
+}
+
+type RoleGrantRepository interface {
+	Create(grant *models.RoleGrant) error
+	GetByID(id primitive.ObjectID) (*models.RoleGrant, error)
+	ListByUserID(userID primitive.ObjectID) ([]*models.RoleGrant, error)
+	ListUnexpiredByUserID(userID primitive.ObjectID, now time.Time) ([]*models.RoleGrant, error)
+	ListDue(now time.Time) ([]*models.RoleGrant, error)
+	MarkExpired(id primitive.ObjectID) (bool, error)
+	Delete(id primitive.ObjectID) error
+}
@@ -11,7 +11,9 @@ func Setup(
 	e *echo.Echo,
 	userHandler *handlers.UserHandler,
 	authHandler *handlers.AuthHandler,
+	accountHandler *handlers.AccountHandler,
 	roleHandler *handlers.RoleHandler,
+	organizationHandler *handlers.OrganizationHandler,
 	emailHandler *handlers.EmailHandler,
 	wsHandler *handlers.WebSocketHandler,
 	authMiddleware *auth.Middleware,
@@ -27,7 +29,13 @@ func Setup(
 	})
 
 	// Auth Routes (No Authentication Required)
-	authHandler.RegisterRoutes(e)
+	authHandler.RegisterRoutes(e, authMiddleware)
+
+	// Account Routes (Authenticated User's Own Account)
+	accountHandler.RegisterRoutes(e, authMiddleware)
+
+	// Organization Routes
+	organizationHandler.RegisterRoutes(e, authMiddleware)
 
 	// Email routes (no authentication required for stats)
 	emailHandler.RegisterRoutes(e, authMiddleware)
@@ -42,31 +50,43 @@ func Setup(
 	// Role Management Routes (Admin Only)
 	roleRoutes := protected.Group("/roles")
 	roleRoutes.Use(authMiddleware.RequireAdmin())
+	roleRoutes.Use(authMiddleware.DenyImpersonation)
 	{
 		roleRoutes.POST("", roleHandler.CreateRole)
+		roleRoutes.GET("/catalog", roleHandler.ListPermissionCatalog)
 		roleRoutes.GET("/:id", roleHandler.GetRole)
+		roleRoutes.GET("/:id/permissions", roleHandler.GetRolePermissions)
+		roleRoutes.GET("/:id/users", roleHandler.ListRoleUsers)
 		roleRoutes.PUT("/:id", roleHandler.UpdateRole)
 		roleRoutes.DELETE("/:id", roleHandler.DeleteRole)
 		roleRoutes.GET("", roleHandler.ListRoles)
 	}
 
-	// User Routes (Authenticated Users)
+	// User Routes (Authenticated Users). Users may read, update and delete
+	// their own record without the corresponding permission. Deleting is
+	// never done while impersonating, so an admin acting as a user can't
+	// delete the account through the owner exception.
+	// Role grants scoped to a user ID apply to that user's routes.
+	userOwner := auth.ParamOwner("id")
+	userScope := auth.ParamScope("id")
 	userRoutes := protected.Group("/users")
 	{
 		userRoutes.POST("", userHandler.CreateUser, authMiddleware.RequirePermission(models.ResourceUsers, models.ActionCreate))
-		userRoutes.GET("/:id", userHandler.GetUser, authMiddleware.RequirePermission(models.ResourceUsers, models.ActionRead))
-		userRoutes.PUT("/:id", userHandler.UpdateUser, authMiddleware.RequirePermission(models.ResourceUsers, models.ActionUpdate))
-		userRoutes.DELETE("/:id", userHandler.DeleteUser, authMiddleware.RequirePermission(models.ResourceUsers, models.ActionDelete))
+		userRoutes.GET("/:id", userHandler.GetUser, authMiddleware.Authorize(auth.Allow(models.ResourceUsers, models.ActionRead).OrOwner(userOwner).WithScope(userScope)))
+		userRoutes.PUT("/:id", userHandler.UpdateUser, authMiddleware.Authorize(auth.Allow(models.ResourceUsers, models.ActionUpdate).OrOwner(userOwner).WithScope(userScope)))
+		userRoutes.DELETE("/:id", userHandler.DeleteUser, authMiddleware.DenyImpersonation, authMiddleware.Authorize(auth.Allow(models.ResourceUsers, models.ActionDelete).OrOwner(userOwner).WithScope(userScope)))
 		userRoutes.GET("", userHandler.ListUsers, authMiddleware.RequirePermission(models.ResourceUsers, models.ActionRead))
+		userRoutes.GET("/search", userHandler.SearchUsers, authMiddleware.RequirePermission(models.ResourceUsers, models.ActionRead))
 
 		// Profile photo routes
-		userRoutes.POST("/:id/photo", userHandler.UploadProfilePhoto, authMiddleware.RequirePermission(models.ResourceUsers, models.ActionUpdate))
-		userRoutes.DELETE("/:id/photo", userHandler.DeleteProfilePhoto, authMiddleware.RequirePermission(models.ResourceUsers, models.ActionUpdate))
+		userRoutes.POST("/:id/photo", userHandler.UploadProfilePhoto, authMiddleware.Authorize(auth.Allow(models.ResourceUserPhotos, models.ActionUpdate).OrOwner(userOwner).WithScope(userScope)))
+		userRoutes.DELETE("/:id/photo", userHandler.DeleteProfilePhoto, authMiddleware.Authorize(auth.Allow(models.ResourceUserPhotos, models.ActionUpdate).OrOwner(userOwner).WithScope(userScope)))
 	}
 
 	// Admin Only Example
 	adminRoutes := protected.Group("/admin")
 	adminRoutes.Use(authMiddleware.RequireAdmin())
+	adminRoutes.Use(authMiddleware.DenyImpersonation)
 	{
 		adminRoutes.GET("", func(c echo.Context) error {
 			return c.JSON(200, "Admin Access Only!")
@@ -42,10 +42,12 @@ func (s *WebSocketService) GetUpgrader() *websocket.Upgrader {
 	return &s.upgrader
 }
 
-func (s *WebSocketService) HandleConnection(conn *websocket.Conn, userID primitive.ObjectID) {
+func (s *WebSocketService) HandleConnection(conn *websocket.Conn, userID primitive.ObjectID, tokenID, sessionID string) {
 	wsConn := &models.WebSocketConnection{
 		ID:        primitive.NewObjectID(),
 		UserID:    userID,
+		TokenID:   tokenID,
+		SessionID: sessionID,
 		Conn:      conn,
 		Channels:  []string{},
 		Connected: true,
@@ -169,6 +171,39 @@ func (s *WebSocketService) disconnectUser(userID primitive.ObjectID) {
 	}
 }
 
+// DisconnectUser closes the user's live socket, e.g. after their sessions are revoked
+func (s *WebSocketService) DisconnectUser(userID primitive.ObjectID) {
+	s.disconnectUser(userID)
+}
+
+// DisconnectToken closes the user's live socket only if it was opened with the given token
+func (s *WebSocketService) DisconnectToken(userID primitive.ObjectID, tokenID string) {
+	s.mutex.RLock()
+	conn, exists := s.connections[userID]
+	matches := exists && conn.TokenID == tokenID
+	s.mutex.RUnlock()
+
+	if matches {
+		s.disconnectUser(userID)
+	}
+}
+
+// DisconnectSession closes the user's live socket only if it belongs to the given session
+func (s *WebSocketService) DisconnectSession(userID primitive.ObjectID, sessionID string) {
+	if sessionID == "" {
+		return
+	}
+
+	s.mutex.RLock()
+	conn, exists := s.connections[userID]
+	matches := exists && conn.SessionID == sessionID
+	s.mutex.RUnlock()
+
+	if matches {
+		s.disconnectUser(userID)
+	}
+}
+
 func (s *WebSocketService) BroadcastToChannel(channel string, message models.WebSocketMessage) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
@@ -28,5 +28,5 @@ func (l *Logger) Error(format string, v ...interface{}) {
 }
 
 func (l *Logger) Fatal(format string, v ...interface{}) {
-	l.fatalLogger.Printf(format, v...)
+	l.fatalLogger.Fatalf(format, v...)
 }
\ No newline at end of file
@@ -11,9 +11,18 @@ type Response struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
+	Meta    *Meta       `json:"meta,omitempty"`
 	Error   string      `json:"error,omitempty"`
 }
 
+// Meta describes the page of a paginated list
+type Meta struct {
+	Total      int64  `json:"total"`
+	Limit      int64  `json:"limit"`
+	Offset     int64  `json:"offset"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
 // Success response
 func Success(c echo.Context, message string, data interface{}) error {
 	return c.JSON(http.StatusOK, Response{
@@ -23,6 +32,16 @@ func Success(c echo.Context, message string, data interface{}) error {
 	})
 }
 
+// Paginated response for one page of a list
+func Paginated(c echo.Context, message string, data interface{}, meta Meta) error {
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: message,
+		Data:    data,
+		Meta:    &meta,
+	})
+}
+
 // Created response
 func Created(c echo.Context, message string, data interface{}) error {
 	return c.JSON(http.StatusCreated, Response{
@@ -51,6 +70,15 @@ func BadRequest(c echo.Context, message string, err error) error {
 	return Error(c, http.StatusBadRequest, message, err)
 }
 
+// BadRequestWithData response carries structured details, e.g. the rules a password broke
+func BadRequestWithData(c echo.Context, message string, data interface{}) error {
+	return c.JSON(http.StatusBadRequest, Response{
+		Success: false,
+		Message: message,
+		Data:    data,
+	})
+}
+
 // NotFound response
 func NotFound(c echo.Context, message string) error {
 	return Error(c, http.StatusNotFound, message, nil)